@@ -0,0 +1,191 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// openLoopQueueSize is open-loopで開始予定時刻を過ぎてもまだ開始できていないRunを溜めておける数
+// これを超えた分は開始せずに捨てて、Droppedとして数える
+const openLoopQueueSize = 1 << 16
+
+// ArrivalProcess is open-loopでRunを開始する間隔を決める
+//
+// WithArrivalを指定すると、AppRunnnerはworkerの空きに関係なく、ArrivalProcessが決めた時刻にRunを開始する予定を立てる
+// workerが詰まっている場合は予定がBacklogとして溜まり、latencyは予定時刻から計測するので、
+// DBが遅くなった時にoffered loadが下がってlatencyが良く見えてしまう(coordinated omission)ことがない
+type ArrivalProcess interface {
+	// Interval is ratePerSecの時、次のRunまでの間隔を返す. randomに決める場合はrを使う
+	Interval(r *rand.Rand, ratePerSec float64) time.Duration
+}
+
+// ConstantArrival is 一定間隔でRunを開始する
+type ConstantArrival struct{}
+
+// Interval is 1/ratePerSec を返す
+func (a *ConstantArrival) Interval(r *rand.Rand, ratePerSec float64) time.Duration {
+	return time.Duration(float64(time.Second) / ratePerSec)
+}
+
+// PoissonArrival is ポアソン過程に従ってRunを開始する
+// 間隔は平均 1/ratePerSec の指数分布になる
+type PoissonArrival struct{}
+
+// Interval is 平均 1/ratePerSec の指数分布に従う間隔を返す
+func (a *PoissonArrival) Interval(r *rand.Rand, ratePerSec float64) time.Duration {
+	return time.Duration(r.ExpFloat64() / ratePerSec * float64(time.Second))
+}
+
+// ParseArrival is "constant" か "poisson" をArrivalProcessにする
+// "closed" か空文字の場合はnilを返し、これまで通りclosed-loopで動く
+func ParseArrival(spec string) (ArrivalProcess, error) {
+	switch strings.TrimSpace(spec) {
+	case "", "closed":
+		return nil, nil
+	case "constant":
+		return &ConstantArrival{}, nil
+	case "poisson":
+		return &PoissonArrival{}, nil
+	default:
+		return nil, fmt.Errorf("invalid arrival %s : want closed, constant or poisson", spec)
+	}
+}
+
+// WithArrival is open-loopで動かす
+// rateはArrivalProcessの平均rateとして使う。LoadProfileやSetRateでの変更も反映される
+// RunやRunMixを複数回呼んだ場合も、rateはAppRunnner全体のrateで、動いているworkerGroupの間で等分する
+// open-loopではRunが失敗してもBackoffPolicyによる待ちは行わない
+func WithArrival(arrival ArrivalProcess) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.arrival = arrival
+	}
+}
+
+// Backlog is open-loopで開始予定時刻を過ぎているのに、まだ開始できていないRunの数を返す
+func (ar *AppRunnner) Backlog() int {
+	ar.workersMu.Lock()
+	defer ar.workersMu.Unlock()
+
+	var ret int
+	for _, g := range ar.groups {
+		ret += len(g.arrivals)
+	}
+	return ret
+}
+
+// Dropped is open-loopでBacklogが溢れて開始しなかったRunの数を返す
+func (ar *AppRunnner) Dropped() int64 {
+	return atomic.LoadInt64(&ar.dropped)
+}
+
+// schedule is ArrivalProcessに従ってRunの開始予定時刻をg.arrivalsに入れる
+// WithIterationsの回数に到達したらg.arrivalsをcloseする
+// 間隔はworkerとは別の、seedとgの名前から作ったrandで決める
+// AppRunnner全体でRateになるように、各scheduleは Rate / 動いているscheduleの数 で予定を立てる
+func (ar *AppRunnner) schedule(g *workerGroup) {
+	atomic.AddInt64(&ar.schedulers, 1)
+	defer atomic.AddInt64(&ar.schedulers, -1)
+
+	r := workerRand(ar.seed, g.name+"/arrival", 0)
+	intended := time.Now()
+	for {
+		if ar.Paused() {
+			if !ar.waitResume(g.ctx, nil) {
+				return
+			}
+			// Pause中の分はBacklogにしない
+			intended = time.Now()
+		}
+		intended = intended.Add(ar.arrival.Interval(r, ar.scheduleRate()))
+		if !sleepUntil(ar.stopCtx, g.ctx, intended) {
+			return
+		}
+		if !ar.claimIteration() {
+			// 予定済みのRunはworkerが実行し終わってから終了する
+			close(g.arrivals)
+			return
+		}
+		select {
+		case g.arrivals <- intended:
+		default:
+			n := atomic.AddInt64(&ar.dropped, 1)
+			if n == 1 || n%1000 == 0 {
+				fmt.Printf("backlog overflow %s. dropped=%d\n", g.name, n)
+			}
+		}
+	}
+}
+
+// scheduleRate is 1つのscheduleが使うrateを返す
+func (ar *AppRunnner) scheduleRate() float64 {
+	n := atomic.LoadInt64(&ar.schedulers)
+	if n < 1 {
+		n = 1
+	}
+	return ar.Rate() / float64(n)
+}
+
+// openLoopRun is g.arrivalsから開始予定時刻を受け取ってRunを実行する
+// latencyは開始予定時刻から計測する
+func (ar *AppRunnner) openLoopRun(g *workerGroup, r *rand.Rand, quit <-chan struct{}) {
+	defer ar.wg.Done()
+
+	source := ar.name
+	if source == "" {
+		source = g.name
+	}
+
+	// errorCounts is funcNameごとの連続エラー回数
+	errorCounts := make(map[string]int)
+	for {
+		select {
+		case <-ar.stopCtx.Done():
+			fmt.Printf("stop run %s\n", g.name)
+			return
+		case <-g.ctx.Done():
+			fmt.Printf("stop run %s\n", g.name)
+			return
+		case <-quit:
+			return
+		case intended, ok := <-g.arrivals:
+			if !ok {
+				return
+			}
+			runnner, stats := g.next(r)
+			stats.RecordStartDelay(time.Since(intended))
+			runCtx, keys := ar.runContext(g.ctx, r, stats)
+			err := runnner.Run(runCtx)
+			elapsed := time.Since(intended)
+			stats.recordRun(runCtx, source, elapsed, err)
+			stats.recordKeys(keys, elapsed, err)
+			if err != nil {
+				errorCounts[stats.funcName]++
+				fmt.Printf("failed %s. errCount=%d code=%s err=%s\n", stats.funcName, errorCounts[stats.funcName], ErrorCode(err), err)
+				continue
+			}
+			delete(errorCounts, stats.funcName)
+		}
+	}
+}
+
+// sleepUntil is tまで待つ。どちらかのctxが終了した場合はfalseを返す
+func sleepUntil(ctx1 context.Context, ctx2 context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx1.Err() == nil && ctx2.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx1.Done():
+		return false
+	case <-ctx2.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,120 @@
+package srunner
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseArrival(t *testing.T) {
+	cases := []struct {
+		spec    string
+		want    ArrivalProcess
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"closed", nil, false},
+		{"constant", &ConstantArrival{}, false},
+		{"poisson", &PoissonArrival{}, false},
+		{"hoge", nil, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseArrival(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != nil && g == nil || e == nil && g != nil {
+				t.Errorf("want %T but got %T", e, g)
+			}
+		})
+	}
+}
+
+func TestPoissonArrival_Interval(t *testing.T) {
+	a := &PoissonArrival{}
+	r := rand.New(rand.NewSource(1))
+	const n = 10000
+	var total time.Duration
+	for i := 0; i < n; i++ {
+		total += a.Interval(r, 100)
+	}
+	mean := total / n
+	// 平均は 1/100 sec = 10ms になる
+	if mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+		t.Errorf("want mean about 10ms but got %s", mean)
+	}
+}
+
+func TestAppRunnner_OpenLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1 workerで20ms/Runしかさばけないところに、200/secでarrivalを発生させる
+	ar := NewAppRunner(ctx, 200, 1, WithArrival(&ConstantArrival{}), WithIterations(20))
+	r := &slowRunner{d: 20 * time.Millisecond}
+	ar.Run(ctx, "Slow", r)
+
+	time.Sleep(150 * time.Millisecond)
+	if ar.Backlog() == 0 {
+		t.Errorf("want Backlog > 0")
+	}
+	// Iterationsに到達しても、Backlogに溜まっているRunは実行してから終了する
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if e, g := int64(20), atomic.LoadInt64(&r.finished); e != g {
+		t.Errorf("want finished %d but got %d", e, g)
+	}
+
+	v, ok := ar.StatsByFuncName("Slow")
+	if !ok {
+		t.Fatal("Slow stats not found")
+	}
+	if e, g := int64(20), v.Count; e != g {
+		t.Errorf("want Count %d but got %d", e, g)
+	}
+	if v.LateStarts == 0 {
+		t.Errorf("want LateStarts > 0")
+	}
+	// latencyは開始予定時刻から計測するので、Run自体の時間より長くなる
+	if v.Max <= 100*time.Millisecond {
+		t.Errorf("want Max > 100ms but got %s", v.Max)
+	}
+}
+
+func TestAppRunnner_OpenLoop_MultipleGroups(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 2回Runしても、AppRunnner全体で100/secになる
+	ar := NewAppRunner(ctx, 100, 2, WithArrival(&ConstantArrival{}))
+	r1 := &countRunner{}
+	r2 := &countRunner{}
+	ar.Run(ctx, "First", r1)
+	ar.Run(ctx, "Second", r2)
+
+	time.Sleep(time.Second)
+	if err := ar.Drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := atomic.LoadInt64(&r1.count), atomic.LoadInt64(&r2.count)
+	if total := c1 + c2; total < 70 || total > 130 {
+		t.Errorf("want about 100 runs but got %d", total)
+	}
+	if c1 == 0 || c2 == 0 {
+		t.Errorf("want runs in both groups but got %d, %d", c1, c2)
+	}
+}
@@ -0,0 +1,228 @@
+package srunner
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackoffPolicy is Runが失敗した後、次のRunまでに待つ時間を決める
+type BackoffPolicy interface {
+	// Backoff is errorCount回連続でRunが失敗した後に待つ時間を返す
+	// jitterはrで決めるので、workerのrandを渡すと同じseedで同じ時間を待つ
+	Backoff(r *rand.Rand, err error, errorCount int) time.Duration
+}
+
+// DefaultBackoffPolicy is BackoffPolicyを指定しなかった場合に使われるBackoffPolicy
+// 600sec * 連続エラー回数 + 0~600secのjitterを待つ
+var DefaultBackoffPolicy BackoffPolicy = &LinearBackoff{
+	Unit:   600 * time.Second,
+	Jitter: 600 * time.Second,
+}
+
+// NoBackoff is 失敗してもすぐに次のRunを行う
+type NoBackoff struct{}
+
+func (b *NoBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	return 0
+}
+
+// ConstantBackoff is 失敗した回数に関わらず Interval + 0~Jitter を待つ
+type ConstantBackoff struct {
+	Interval time.Duration
+	Jitter   time.Duration
+}
+
+func (b *ConstantBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	return b.Interval + jitter(r, b.Jitter)
+}
+
+// LinearBackoff is Unit * 連続エラー回数 + 0~Jitter を待つ
+type LinearBackoff struct {
+	Unit   time.Duration
+	Jitter time.Duration
+}
+
+func (b *LinearBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	return b.Unit*time.Duration(errorCount) + jitter(r, b.Jitter)
+}
+
+// ExponentialBackoff is Initialから開始して、失敗するごとにMultiplier倍待つ時間を伸ばす
+// 待つ時間はMaxを超えない
+// Jitterが0より大きい場合、待つ時間の Jitter 割合をランダムに減らす (Full Jitterの場合は1.0)
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+func (b *ExponentialBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	if errorCount < 1 {
+		errorCount = 1
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	v := float64(b.Initial) * math.Pow(multiplier, float64(errorCount-1))
+	if b.Max > 0 && v > float64(b.Max) {
+		v = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		j := math.Min(b.Jitter, 1)
+		v = v * (1 - j*r.Float64())
+	}
+	return time.Duration(v)
+}
+
+// ClassifiedBackoff is エラーの種類ごとにBackoffPolicyを使い分ける
+// 指定されていないErrorClassの場合はDefaultを使う
+type ClassifiedBackoff struct {
+	Contention BackoffPolicy
+	Overload   BackoffPolicy
+	Permanent  BackoffPolicy
+	Default    BackoffPolicy
+}
+
+func (b *ClassifiedBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	var p BackoffPolicy
+	switch ClassifyError(err) {
+	case ErrorClassContention:
+		p = b.Contention
+	case ErrorClassOverload:
+		p = b.Overload
+	case ErrorClassPermanent:
+		p = b.Permanent
+	}
+	if p == nil {
+		p = b.Default
+	}
+	if p == nil {
+		p = DefaultBackoffPolicy
+	}
+	return p.Backoff(r, err, errorCount)
+}
+
+func jitter(r *rand.Rand, max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int63n(int64(max)))
+}
+
+// ParseBackoffPolicy is $SRUNNER_RUNNERS に指定されたBackoffPolicyの文字列をParseする
+//
+// specは以下のformatを期待している
+//
+//	none
+//	constant,{interval}[,{jitter}]                   e.g. constant,1s,500ms
+//	linear,{unit}[,{jitter}]                         e.g. linear,600s,600s
+//	exponential,{initial},{max}[,{multiplier}[,{jitter}]] e.g. exponential,100ms,1m,2,0.5
+//
+// ErrorClassごとに指定する場合は {class}={policy} を / で区切って並べる
+// classは contention, overload, permanent, default のいずれか
+//
+//	contention=none/overload=exponential,1s,5m/default=constant,10s
+func ParseBackoffPolicy(spec string) (BackoffPolicy, error) {
+	if !strings.Contains(spec, "=") {
+		return parseSingleBackoffPolicy(spec)
+	}
+
+	ret := &ClassifiedBackoff{}
+	for _, v := range strings.Split(spec, "/") {
+		l := strings.SplitN(v, "=", 2)
+		if len(l) != 2 {
+			return nil, fmt.Errorf("invalid backoff policy %s : want {class}={policy}", spec)
+		}
+		p, err := parseSingleBackoffPolicy(l[1])
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(strings.TrimSpace(l[0])) {
+		case "contention", "aborted":
+			ret.Contention = p
+		case "overload":
+			ret.Overload = p
+		case "permanent":
+			ret.Permanent = p
+		case "default":
+			ret.Default = p
+		default:
+			return nil, fmt.Errorf("invalid backoff policy %s : unsupported error class %s", spec, l[0])
+		}
+	}
+	return ret, nil
+}
+
+func parseSingleBackoffPolicy(spec string) (BackoffPolicy, error) {
+	l := strings.Split(spec, ",")
+	name := strings.ToLower(strings.TrimSpace(l[0]))
+	params := l[1:]
+
+	durations := func(min int, max int) ([]time.Duration, error) {
+		if len(params) < min || len(params) > max {
+			return nil, fmt.Errorf("invalid %s backoff policy %s : want %d~%d params", name, spec, min, max)
+		}
+		var ret []time.Duration
+		for _, p := range params {
+			d, err := time.ParseDuration(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s backoff policy %s : %w", name, spec, err)
+			}
+			ret = append(ret, d)
+		}
+		for len(ret) < max {
+			ret = append(ret, 0)
+		}
+		return ret, nil
+	}
+
+	switch name {
+	case "none":
+		return &NoBackoff{}, nil
+	case "constant":
+		v, err := durations(1, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &ConstantBackoff{Interval: v[0], Jitter: v[1]}, nil
+	case "linear":
+		v, err := durations(1, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &LinearBackoff{Unit: v[0], Jitter: v[1]}, nil
+	case "exponential":
+		if len(params) < 2 || len(params) > 4 {
+			return nil, fmt.Errorf("invalid exponential backoff policy %s : want exponential,{initial},{max}[,{multiplier}[,{jitter}]]", spec)
+		}
+		initial, err := time.ParseDuration(params[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponential backoff policy %s : %w", spec, err)
+		}
+		max, err := time.ParseDuration(params[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponential backoff policy %s : %w", spec, err)
+		}
+		ret := &ExponentialBackoff{Initial: initial, Max: max, Multiplier: 2}
+		if len(params) > 2 {
+			ret.Multiplier, err = strconv.ParseFloat(params[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exponential backoff policy %s : %w", spec, err)
+			}
+		}
+		if len(params) > 3 {
+			ret.Jitter, err = strconv.ParseFloat(params[3], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exponential backoff policy %s : %w", spec, err)
+			}
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("unsupported backoff policy %s", spec)
+	}
+}
@@ -0,0 +1,142 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"nil", nil, codes.OK},
+		{"grpc", status.Error(codes.Aborted, "aborted"), codes.Aborted},
+		{"wrapped grpc", fmt.Errorf("failed Deposit : %w", status.Error(codes.ResourceExhausted, "busy")), codes.ResourceExhausted},
+		{"pg serialization failure", &pgconn.PgError{Code: "40001"}, codes.Aborted},
+		{"pg too many connections", fmt.Errorf("failed : %w", &pgconn.PgError{Code: "53300"}), codes.ResourceExhausted},
+		{"pg syntax error", &pgconn.PgError{Code: "42601"}, codes.InvalidArgument},
+		{"pg undefined column", &pgconn.PgError{Code: "42703"}, codes.NotFound},
+		{"context deadline", fmt.Errorf("failed : %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{"unknown", errors.New("hoge"), codes.Unknown},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if g := ErrorCode(tt.err); tt.want != g {
+				t.Errorf("want %s but got %s", tt.want, g)
+			}
+		})
+	}
+}
+
+func TestClassifiedBackoff(t *testing.T) {
+	b := &ClassifiedBackoff{
+		Contention: &NoBackoff{},
+		Overload:   &ConstantBackoff{Interval: time.Minute},
+		Default:    &ConstantBackoff{Interval: time.Hour},
+	}
+
+	cases := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"aborted", status.Error(codes.Aborted, ""), 0},
+		{"resource exhausted", status.Error(codes.ResourceExhausted, ""), time.Minute},
+		{"invalid argument", status.Error(codes.InvalidArgument, ""), time.Hour},
+		{"unknown", errors.New("hoge"), time.Hour},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if g := b.Backoff(nil, tt.err, 1); tt.want != g {
+				t.Errorf("want %s but got %s", tt.want, g)
+			}
+		})
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	cases := []struct {
+		errorCount int
+		want       time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{100, time.Second},
+	}
+	for _, tt := range cases {
+		if g := b.Backoff(nil, nil, tt.errorCount); tt.want != g {
+			t.Errorf("errorCount %d: want %s but got %s", tt.errorCount, tt.want, g)
+		}
+	}
+
+	jb := &ExponentialBackoff{Initial: time.Second, Max: time.Second, Jitter: 0.5}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		g := jb.Backoff(r, nil, 1)
+		if g < 500*time.Millisecond || g > time.Second {
+			t.Fatalf("want 500ms~1s but got %s", g)
+		}
+	}
+
+	// 同じseedのrandなら同じjitterになる
+	if e, g := jb.Backoff(rand.New(rand.NewSource(2)), nil, 1), jb.Backoff(rand.New(rand.NewSource(2)), nil, 1); e != g {
+		t.Errorf("want same backoff %s but got %s", e, g)
+	}
+}
+
+func TestParseBackoffPolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		err     error
+		want    time.Duration
+		wantErr bool
+	}{
+		{"none", "none", nil, 0, false},
+		{"constant", "constant,3s", nil, 3 * time.Second, false},
+		{"linear", "linear,10s", nil, 20 * time.Second, false},
+		{"exponential", "exponential,1s,1m,3", nil, 3 * time.Second, false},
+		{"classified contention", "contention=none/default=constant,1m", status.Error(codes.Aborted, ""), 0, false},
+		{"classified default", "contention=none/default=constant,1m", status.Error(codes.InvalidArgument, ""), time.Minute, false},
+		{"invalid class", "hoge=none", nil, 0, true},
+		{"invalid duration", "constant,hoge", nil, 0, true},
+		{"missing params", "exponential,1s", nil, 0, true},
+		{"unsupported", "hoge", nil, 0, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBackoffPolicy(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error but got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g := got.Backoff(nil, tt.err, 2); tt.want != g {
+				t.Errorf("want %s but got %s", tt.want, g)
+			}
+		})
+	}
+}
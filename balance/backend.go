@@ -0,0 +1,66 @@
+package balance
+
+import (
+	"context"
+	"time"
+
+	"github.com/sinmetal/srunner"
+)
+
+// Backend is Spanner(Store)とAlloyDB(StoreAlloy)で同じworkloadを実行するためのinterface
+type Backend interface {
+	// CreateUserAccount is UserAccountを作成する
+	CreateUserAccount(ctx context.Context, userAccount *UserAccount) (*UserAccount, error)
+
+	// Deposit is UserDepositHistoryを追加して、UserBalanceに加算する
+	// UserBalanceがまだない場合は作成する
+	// 同じDepositIDのUserDepositHistoryが既にある場合は加算せずに、AlreadyApplied=trueのUserDepositHistoryを返すので、同じDepositIDでretryできる
+	// commitの結果がわからなかった場合は ErrOutcomeUnknown を返す
+	Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (*UserBalance, *UserDepositHistory, error)
+
+	// ReadUserBalances is 指定した複数のUserIDのUserBalanceを取得する
+	// primary=falseの場合は、AlloyDBではread replicaから、Spannerではstale readで取得する
+	ReadUserBalances(ctx context.Context, userIDs []string, primary bool) ([]*UserBalance, error)
+
+	// FindUserDepositHistories is 指定したUserIDのUserDepositHistoryを取得する
+	// primary=falseの場合は、AlloyDBではread replicaから、Spannerではstale readで取得する
+	FindUserDepositHistories(ctx context.Context, userID string, primary bool) ([]*UserDepositHistory, error)
+}
+
+var (
+	_ Backend = &Store{}
+	_ Backend = &StoreAlloy{}
+)
+
+// OperationRecorder is Runの処理時間をOperation Tableに記録する
+// operation.Store と operation.StoreAlloy が実装している
+type OperationRecorder interface {
+	Record(ctx context.Context, operationName string, elapsed time.Duration) error
+}
+
+// RandomDeposit is DepositTypeと、それに応じたamount, pointをrandomに決める
+func RandomDeposit(ctx context.Context) (depositType DepositType, amount int64, point int64) {
+	rnd := srunner.RandFromContext(ctx)
+	depositType = RandomDepositType(ctx)
+	switch depositType {
+	case DepositTypeBank:
+		switch rnd.Intn(5) {
+		case 1:
+			amount = 10000
+		case 2:
+			amount = 20000
+		case 3:
+			amount = 30000
+		default:
+			amount = int64(1000 + rnd.Intn(200000))
+		}
+	case DepositTypeCampaignPoint:
+		point = int64(10 + rnd.Intn(1000))
+	case DepositTypeRefund:
+		amount = int64(10 + rnd.Intn(1000))
+	case DepositTypeSales:
+		amount = int64(500 + rnd.Intn(10000))
+		point = int64(500 + rnd.Intn(10000))
+	}
+	return depositType, amount, point
+}
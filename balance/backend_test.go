@@ -0,0 +1,327 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sinmetal/srunner"
+)
+
+// fakeBackend is memory上でDepositを記録するBackend. 同じDepositIDのDepositは1回だけ記録する
+type fakeBackend struct {
+	balances  map[string]*UserBalance
+	histories []*UserDepositHistory
+
+	// unknownOutcomes is 先頭から順番に、DepositIDの最初のDepositでErrOutcomeUnknownを返す. trueの場合はDepositを記録してから返す
+	unknownOutcomes []bool
+	attempted       map[string]bool
+
+	// failures is unknownOutcomesの後に、Depositで返すerror
+	failures []error
+}
+
+func (b *fakeBackend) CreateUserAccount(ctx context.Context, userAccount *UserAccount) (*UserAccount, error) {
+	return userAccount, nil
+}
+
+func (b *fakeBackend) Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (*UserBalance, *UserDepositHistory, error) {
+	if len(b.unknownOutcomes) > 0 && !b.attempted[depositID] {
+		if b.attempted == nil {
+			b.attempted = make(map[string]bool)
+		}
+		b.attempted[depositID] = true
+		committed := b.unknownOutcomes[0]
+		b.unknownOutcomes = b.unknownOutcomes[1:]
+		if committed {
+			b.deposit(userID, depositID, depositType, amount, point)
+		}
+		return nil, nil, ErrOutcomeUnknown
+	}
+	if len(b.failures) > 0 {
+		err := b.failures[0]
+		b.failures = b.failures[1:]
+		return nil, nil, err
+	}
+	ub, udh := b.deposit(userID, depositID, depositType, amount, point)
+	return ub, udh, nil
+}
+
+func (b *fakeBackend) deposit(userID string, depositID string, depositType DepositType, amount int64, point int64) (*UserBalance, *UserDepositHistory) {
+	for _, v := range b.histories {
+		if v.UserID == userID && v.DepositID == depositID {
+			applied := *v
+			applied.AlreadyApplied = true
+			return b.balances[userID], &applied
+		}
+	}
+	ub, ok := b.balances[userID]
+	if !ok {
+		ub = &UserBalance{UserID: userID}
+		b.balances[userID] = ub
+	}
+	ub.Amount += amount
+	ub.Point += point
+	udh := &UserDepositHistory{UserID: userID, DepositID: depositID, DepositType: depositType, Amount: amount, Point: point}
+	b.histories = append(b.histories, udh)
+	return ub, udh
+}
+
+func (b *fakeBackend) ReadUserBalances(ctx context.Context, userIDs []string, primary bool) ([]*UserBalance, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) FindUserDepositHistories(ctx context.Context, userID string, primary bool) ([]*UserDepositHistory, error) {
+	return nil, nil
+}
+
+type fakeOperationRecorder struct {
+	names []string
+}
+
+func (r *fakeOperationRecorder) Record(ctx context.Context, operationName string, elapsed time.Duration) error {
+	r.names = append(r.names, operationName)
+	return nil
+}
+
+func TestDepositRunner_Run(t *testing.T) {
+	ctx := context.Background()
+
+	b := &fakeBackend{balances: make(map[string]*UserBalance)}
+	ope := &fakeOperationRecorder{}
+	r := &DepositRunner{Backend: b, OperationStore: ope}
+	for i := 0; i < 100; i++ {
+		if err := r.Run(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(b.histories) != 100 {
+		t.Errorf("want 100 histories but got %d", len(b.histories))
+	}
+	if len(ope.names) != 100 || ope.names[0] != "BalanceStore.Deposit" {
+		t.Errorf("unexpected operations %v", ope.names)
+	}
+	var amount, point int64
+	for _, v := range b.balances {
+		amount += v.Amount
+		point += v.Point
+	}
+	for _, v := range b.histories {
+		amount -= v.Amount
+		point -= v.Point
+	}
+	if amount != 0 || point != 0 {
+		t.Errorf("balance and histories mismatch amount=%d point=%d", amount, point)
+	}
+}
+
+func TestDepositRunner_Run_OutcomeUnknown(t *testing.T) {
+	ctx := context.Background()
+
+	b := &fakeBackend{
+		balances:        make(map[string]*UserBalance),
+		unknownOutcomes: []bool{true, false, true},
+	}
+	r := &DepositRunner{
+		Backend:        b,
+		OperationStore: &fakeOperationRecorder{},
+		Reconciler:     &DepositReconciler{Backend: b, Interval: time.Millisecond},
+	}
+	ar := srunner.NewAppRunner(ctx, 1000, 1, srunner.WithIterations(5), srunner.WithBackoffPolicy(&srunner.NoBackoff{}))
+	ar.Run(ctx, "Balance.Deposit", r)
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// commitされていなかった1回はReconcileで加算されるので、5回とも1回ずつ加算される
+	if e, g := 5, len(b.histories); e != g {
+		t.Errorf("want %d histories but got %d", e, g)
+	}
+	v, ok := ar.StatsByFuncName("Balance.Deposit")
+	if !ok {
+		t.Fatal("Balance.Deposit stats not found")
+	}
+	if e, g := int64(0), v.ErrorCount; e != g {
+		t.Errorf("want ErrorCount %d but got %d", e, g)
+	}
+	want := map[string]int64{OutcomeUnknown: 3, OutcomeResolvedCommitted: 2, OutcomeResolvedAbsent: 1}
+	for outcome, e := range want {
+		if g := v.Outcomes[outcome]; e != g {
+			t.Errorf("want %s %d but got %d", outcome, e, g)
+		}
+	}
+}
+
+func TestDepositReconciler_Reconcile(t *testing.T) {
+	ctx := context.Background()
+
+	b := &fakeBackend{balances: make(map[string]*UserBalance)}
+	b.deposit("u1", "d1", DepositTypeBank, 100, 0)
+	reconciler := &DepositReconciler{Backend: b, Interval: time.Millisecond}
+
+	committed, err := reconciler.Reconcile(ctx, "u1", "d1", DepositTypeBank, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Errorf("want committed deposit")
+	}
+
+	// 1回目のDepositが失敗しても、MaxAttemptsまで試す
+	b.failures = []error{errors.New("unavailable")}
+	committed, err = reconciler.Reconcile(ctx, "u1", "d2", DepositTypeBank, 200, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed {
+		t.Errorf("want absent deposit")
+	}
+	if e, g := int64(300), b.balances["u1"].Amount; e != g {
+		t.Errorf("want amount %d but got %d", e, g)
+	}
+}
+
+func TestDepositReconciler_Reconcile_Exhausted(t *testing.T) {
+	ctx := context.Background()
+
+	failure := errors.New("unavailable")
+	b := &fakeBackend{
+		balances: make(map[string]*UserBalance),
+		failures: []error{failure, failure, failure},
+	}
+	reconciler := &DepositReconciler{Backend: b, MaxAttempts: 3, Interval: time.Millisecond}
+	_, err := reconciler.Reconcile(ctx, "u1", "d1", DepositTypeBank, 100, 0)
+	if !errors.Is(err, failure) {
+		t.Errorf("want %s but got %v", failure, err)
+	}
+	if len(b.histories) != 0 {
+		t.Errorf("want no histories but got %d", len(b.histories))
+	}
+}
+
+func TestDepositReconciler_Reconcile_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &fakeBackend{balances: make(map[string]*UserBalance)}
+	b.deposit("u1", "d1", DepositTypeBank, 100, 0)
+	cancel()
+
+	// Depositのctxが終了していても解決できる
+	reconciler := &DepositReconciler{Backend: &ctxCheckBackend{b}}
+	committed, err := reconciler.Reconcile(ctx, "u1", "d1", DepositTypeBank, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !committed {
+		t.Errorf("want committed deposit")
+	}
+
+	// ctxが終了している場合は、失敗したDepositを再度試さない
+	failure := errors.New("unavailable")
+	b.failures = []error{failure, failure}
+	_, err = reconciler.Reconcile(ctx, "u1", "d2", DepositTypeBank, 200, 0)
+	if !errors.Is(err, failure) || !errors.Is(err, context.Canceled) {
+		t.Errorf("want %s and %s but got %v", failure, context.Canceled, err)
+	}
+	if e, g := 1, len(b.failures); e != g {
+		t.Errorf("want remaining failures %d but got %d", e, g)
+	}
+}
+
+func TestDepositReconciler_Reconcile_MaxElapsed(t *testing.T) {
+	ctx := context.Background()
+
+	failure := errors.New("unavailable")
+	b := &fakeBackend{
+		balances: make(map[string]*UserBalance),
+		failures: []error{failure, failure},
+	}
+	// IntervalだけwaitするとMaxElapsedを超えるので、再度試さずに終わる
+	reconciler := &DepositReconciler{Backend: b, Interval: time.Hour, MaxElapsed: time.Second}
+	start := time.Now()
+	_, err := reconciler.Reconcile(ctx, "u1", "d1", DepositTypeBank, 100, 0)
+	if !errors.Is(err, failure) || !errors.Is(err, errReconcileDeadline) {
+		t.Errorf("want %s and %s but got %v", failure, errReconcileDeadline, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("want reconcile within MaxElapsed but took %s", elapsed)
+	}
+}
+
+// ctxCheckBackend is ctxが終了している場合はerrorを返すBackend
+type ctxCheckBackend struct {
+	*fakeBackend
+}
+
+func (b *ctxCheckBackend) Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (*UserBalance, *UserDepositHistory, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return b.fakeBackend.Deposit(ctx, userID, depositID, depositType, amount, point)
+}
+
+func TestIsOutcomeUnknown(t *testing.T) {
+	spannerErr := fmt.Errorf("failed commit : %w", &spanner.TransactionOutcomeUnknownError{})
+	if !isSpannerOutcomeUnknown(spannerErr) {
+		t.Errorf("want outcome unknown %s", spannerErr)
+	}
+	for _, err := range []error{
+		context.DeadlineExceeded,
+		spanner.ToSpannerError(context.DeadlineExceeded),
+		errors.New("context deadline exceeded, transaction outcome unknown"),
+	} {
+		if isSpannerOutcomeUnknown(err) {
+			t.Errorf("want not outcome unknown %s", err)
+		}
+	}
+
+	for _, err := range []error{
+		&pgconn.PgError{Code: "40001", Message: "could not serialize access"},
+		fmt.Errorf("commit : %w", pgx.ErrTxCommitRollback),
+	} {
+		if isCommitOutcomeUnknown(err) {
+			t.Errorf("want not outcome unknown %s", err)
+		}
+	}
+	if err := (&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}); !isCommitOutcomeUnknown(err) {
+		t.Errorf("want outcome unknown %s", err)
+	}
+}
+
+func TestRandomDeposit(t *testing.T) {
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		depositType, amount, point := RandomDeposit(ctx)
+		switch depositType {
+		case DepositTypeBank:
+			if amount < 1000 || point != 0 {
+				t.Errorf("invalid bank deposit amount=%d point=%d", amount, point)
+			}
+		case DepositTypeCampaignPoint:
+			if amount != 0 || point < 10 {
+				t.Errorf("invalid campaign point deposit amount=%d point=%d", amount, point)
+			}
+		case DepositTypeRefund:
+			if amount < 10 || point != 0 {
+				t.Errorf("invalid refund deposit amount=%d point=%d", amount, point)
+			}
+		case DepositTypeSales:
+			if amount < 500 || point < 500 {
+				t.Errorf("invalid sales deposit amount=%d point=%d", amount, point)
+			}
+		default:
+			t.Errorf("unexpected deposit type %v", depositType)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
+	"github.com/sinmetal/srunner/operation"
+)
+
+const selectUserDepositHistorySQL = `
+SELECT
+  UserID,
+	DepositID,
+	DepositType,
+	Amount,
+	Point,
+	SupplementaryInformation,
+	CreatedAt
+FROM UserDepositHistory
+WHERE UserID = @UserID
+ORDER BY CreatedAt DESC
+LIMIT @Limit
+`
+
+const findUserDepositHistoryKeysSQL = "SELECT UserID, DepositID FROM UserDepositHistory WHERE UserID = @UserID ORDER BY CreatedAt DESC LIMIT 100"
+
+// insertDepositHistoryStatement is DepositDMLでUserDepositHistoryをINSERTするStatement
+func (s *Store) insertDepositHistoryStatement(userID string, depositID string, depositType DepositType, amount int64, point int64) spanner.Statement {
+	st := spanner.NewStatement(
+		fmt.Sprintf("INSERT %s (UserID, DepositID, DepositType, Amount, Point, CreatedAt)"+
+			" VALUES (@UserID, @DepositID, @DepositType, @Amount, @Point, PENDING_COMMIT_TIMESTAMP())"+
+			" THEN RETURN UserID, DepositID, DepositType, Amount, Point", s.UserDepositHistoryTable()),
+	)
+	st.Params = map[string]interface{}{
+		"UserID":      userID,
+		"DepositID":   depositID,
+		"DepositType": depositType.ToIntn(),
+		"Amount":      amount,
+		"Point":       point,
+	}
+	return st
+}
+
+// updateUserBalanceStatement is DepositDMLでUserBalanceに加算するStatement
+func (s *Store) updateUserBalanceStatement(userID string, amount int64, point int64) spanner.Statement {
+	st := spanner.NewStatement(
+		fmt.Sprintf("UPDATE %s SET Amount = Amount + @Amount, Point = Point + @Point, UpdatedAt = PENDING_COMMIT_TIMESTAMP()"+
+			" WHERE UserID = @UserID"+
+			" THEN RETURN UserID, Amount, Point", s.UserBalanceTable()),
+	)
+	st.Params = map[string]interface{}{
+		"UserID": userID,
+		"Amount": amount,
+		"Point":  point,
+	}
+	return st
+}
+
+// selectUserDepositHistoryStatement is SelectUserDepositHistoryのStatement
+func selectUserDepositHistoryStatement(userID string, limit int) spanner.Statement {
+	st := spanner.NewStatement(selectUserDepositHistorySQL)
+	st.Params = map[string]interface{}{
+		"UserID": userID,
+		"Limit":  limit,
+	}
+	return st
+}
+
+// findUserDepositHistoryKeysStatement is FindUserDepositHistoriesでPKを取得するStatement
+func findUserDepositHistoryKeysStatement(userID string) spanner.Statement {
+	st := spanner.NewStatement(findUserDepositHistoryKeysSQL)
+	st.Params = map[string]interface{}{"UserID": userID}
+	return st
+}
+
+// Statements is Storeが実行するSQLを、実行時と同じ型のParamsで返す
+// srunner.Preflightで負荷をかける前に確認するために使う
+func (s *Store) Statements() []*srunner.Statement {
+	return []*srunner.Statement{
+		srunner.NewSpannerStatement("Balance.DepositDML.InsertDepositHistory", s.insertDepositHistoryStatement("", "", DepositTypeBank, 0, 0), true),
+		srunner.NewSpannerStatement("Balance.DepositDML.UpdateUserBalance", s.updateUserBalanceStatement("", 0, 0), true),
+		srunner.NewSpannerStatement("Balance.SelectUserDepositHistory", selectUserDepositHistoryStatement("", 1), false),
+		srunner.NewSpannerStatement("Balance.FindUserDepositHistories", findUserDepositHistoryKeysStatement(""), false),
+	}
+}
+
+// spannerStatements is Spannerに負荷をかけるRunnerのStatementsFunc
+func spannerStatements(ctx context.Context, env *srunner.RunnerEnv) ([]*srunner.Statement, error) {
+	bs, _, err := newSpannerStores(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	return bs.Statements(), nil
+}
+
+// alloyStatements is AlloyDBに負荷をかけるRunnerのStatementsFunc
+// 処理時間を記録するOperation TableのStatementも含む
+func alloyStatements(ctx context.Context, env *srunner.RunnerEnv) ([]*srunner.Statement, error) {
+	if env.AlloyDB == nil {
+		return nil, fmt.Errorf("alloydb pool is required")
+	}
+	ret := NewStoreAlloy(env.AlloyDB, env.AlloyDBReadReplicas).Statements()
+	ret = append(ret, operation.NewStoreAlloy(env.AlloyDB).Statements()...)
+	return ret, nil
+}
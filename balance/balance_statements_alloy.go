@@ -0,0 +1,131 @@
+package balance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sinmetal/srunner"
+)
+
+const insertUserBalanceSQL = `
+INSERT INTO UserBalance (UserID, Amount, Point) VALUES
+    (@UserID, @Amount, @Point);
+`
+
+const selectLatestDepositHistoriesSQL = `
+		SELECT UserId, DepositId FROM UserDepositHistory WHERE UserID = @UserID ORDER BY CreatedAt DESC
+		`
+
+func (s *StoreAlloy) createUserAccountSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (UserID, Age, Height, Weight) VALUES (@UserID, @Age, @Height, @Weight)"+
+		" RETURNING CreatedAt, UpdatedAt", s.UserAccountTable())
+}
+
+// insertDepositHistorySQL is 同じDepositIDのRowが既にある場合はINSERTせず、Rowを返さない
+func (s *StoreAlloy) insertDepositHistorySQL() string {
+	return fmt.Sprintf("INSERT INTO %s (UserID, DepositID, DepositType, Amount, Point)"+
+		" VALUES (@UserID, @DepositID, @DepositType, @Amount, @Point)"+
+		" ON CONFLICT (UserID, DepositID) DO NOTHING"+
+		" RETURNING CreatedAt",
+		s.UserDepositHistoryTable(),
+	)
+}
+
+func (s *StoreAlloy) readDepositHistorySQL() string {
+	return fmt.Sprintf("SELECT UserID, DepositID, DepositType, Amount, Point, CreatedAt FROM %s"+
+		" WHERE UserID = @UserID AND DepositID = @DepositID",
+		s.UserDepositHistoryTable(),
+	)
+}
+
+func (s *StoreAlloy) readUserBalanceSQL() string {
+	return fmt.Sprintf("SELECT UserID, Amount, Point, CreatedAt, UpdatedAt FROM %s WHERE UserID = @UserID", s.UserBalanceTable())
+}
+
+func (s *StoreAlloy) upsertUserBalanceSQL() string {
+	return fmt.Sprintf("INSERT INTO %s AS b (UserID, Amount, Point) VALUES (@UserID, @Amount, @Point)"+
+		" ON CONFLICT (UserID) DO UPDATE SET Amount = b.Amount + EXCLUDED.Amount, Point = b.Point + EXCLUDED.Point, UpdatedAt = NOW()"+
+		" RETURNING UserID, Amount, Point, CreatedAt, UpdatedAt", s.UserBalanceTable(),
+	)
+}
+
+// readUserBalancesSQL is n件のUserIDを @UserID0, @UserID1, ... で指定するSQL
+func readUserBalancesSQL(n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("@UserID%d", i)
+	}
+	return fmt.Sprintf(`
+SELECT UserID, Amount, Point FROM UserBalance WHERE UserID IN (%s)
+`, strings.Join(placeholders, ","))
+}
+
+// readUserDepositHistoriesSQL is n件のPKを (@UserID0, @DepositID0), ... で指定するSQL
+func readUserDepositHistoriesSQL(n int) string {
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("(@UserID%d, @DepositID%d)", i, i)
+	}
+	return fmt.Sprintf(`
+SELECT UserID, DepositID, DepositType, Amount, Point FROM UserDepositHistory
+WHERE (UserID, DepositID) IN (
+    %s
+);
+`, strings.Join(placeholders, ","))
+}
+
+// Statements is StoreAlloyが実行するSQLを、実行時と同じ型のParamsで返す
+// srunner.Preflightで負荷をかける前にEXPLAINで確認するために使う
+func (s *StoreAlloy) Statements() []*srunner.Statement {
+	return []*srunner.Statement{
+		{
+			Name:   "BalanceAlloy.CreateUserAccount",
+			SQL:    s.createUserAccountSQL(),
+			Params: map[string]interface{}{"UserID": "", "Age": int64(0), "Height": int64(0), "Weight": int64(0)},
+			DML:    true,
+		},
+		{
+			Name:   "BalanceAlloy.Deposit.InsertDepositHistory",
+			SQL:    s.insertDepositHistorySQL(),
+			Params: map[string]interface{}{"UserID": "", "DepositID": "", "DepositType": DepositTypeBank, "Amount": int64(0), "Point": int64(0)},
+			DML:    true,
+		},
+		{
+			Name:   "BalanceAlloy.Deposit.UpsertUserBalance",
+			SQL:    s.upsertUserBalanceSQL(),
+			Params: map[string]interface{}{"UserID": "", "Amount": int64(0), "Point": int64(0)},
+			DML:    true,
+		},
+		{
+			Name:   "BalanceAlloy.Deposit.ReadUserBalance",
+			SQL:    s.readUserBalanceSQL(),
+			Params: map[string]interface{}{"UserID": ""},
+		},
+		{
+			Name:   "BalanceAlloy.Deposit.ReadDepositHistory",
+			SQL:    s.readDepositHistorySQL(),
+			Params: map[string]interface{}{"UserID": "", "DepositID": ""},
+		},
+		{
+			Name:   "BalanceAlloy.InsertUserBalance",
+			SQL:    insertUserBalanceSQL,
+			Params: map[string]interface{}{"UserID": "", "Amount": int64(0), "Point": int64(0)},
+			DML:    true,
+		},
+		{
+			Name:   "BalanceAlloy.ReadUserBalances",
+			SQL:    readUserBalancesSQL(1),
+			Params: map[string]interface{}{"UserID0": ""},
+		},
+		{
+			Name:   "BalanceAlloy.FindUserDepositHistories.Keys",
+			SQL:    selectLatestDepositHistoriesSQL,
+			Params: map[string]interface{}{"UserID": ""},
+		},
+		{
+			Name:   "BalanceAlloy.FindUserDepositHistories",
+			SQL:    readUserDepositHistoriesSQL(1),
+			Params: map[string]interface{}{"UserID0": "", "DepositID0": ""},
+		},
+	}
+}
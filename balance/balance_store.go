@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/rand"
+	"sort"
 	"time"
 
 	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
+	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/internal/trace"
 	"github.com/sinmetal/srunner/spanners"
 	"google.golang.org/api/iterator"
@@ -63,6 +63,9 @@ type UserDepositHistory struct {
 	SumVersion               string
 	SupplementaryInformation *SupplementaryInformation `spanner:"-"`
 	CreatedAt                time.Time
+
+	// AlreadyApplied is Depositを呼んだ時に、同じDepositIDのUserDepositHistoryが既にあって加算しなかった
+	AlreadyApplied bool `spanner:"-"`
 }
 
 type SupplementaryInformation struct {
@@ -188,14 +191,41 @@ func (s *Store) CreateUserAccount(ctx context.Context, userAccount *UserAccount)
 	return userAccount, nil
 }
 
+// userDepositHistoryKeyColumns is DepositIDのUserDepositHistoryがあるかを確認する時に読むColumn
+// SupplementaryInformationは大きいので読まない
+var userDepositHistoryKeyColumns = []string{"UserID", "DepositID", "DepositType", "Amount", "Point", "CreatedAt"}
+
+// Deposit is UserDepositHistoryを追加して、UserBalanceに加算する
+// 同じDepositIDのUserDepositHistoryが既にある場合は加算せずに、その時点のUserBalanceとUserDepositHistoryを返すので、同じDepositIDでretryできる
+// commitの結果がわからなかった場合は ErrOutcomeUnknown を返す
 func (s *Store) Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (userBalance *UserBalance, userDepositHistories *UserDepositHistory, err error) {
 	ctx, _ = trace.StartSpan(ctx, "BalanceStore.Deposit")
 	defer func() { trace.EndSpan(ctx, err) }()
 
 	var ub UserBalance
 	var udh UserDepositHistory
+	var applied bool
 	resp, err := s.sc.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		applied = false
 		var mus []*spanner.Mutation
+		udhRow, err := tx.ReadRowWithOptions(ctx, s.UserDepositHistoryTable(),
+			spanner.Key{userID, depositID},
+			userDepositHistoryKeyColumns,
+			&spanner.ReadOptions{
+				RequestTag: spanners.AppTag(),
+			})
+		if err == nil {
+			existing, err := udh.FromRow(udhRow)
+			if err != nil {
+				return fmt.Errorf("failed UserDepositHistory.FromRow : %w", err)
+			}
+			udh = *existing
+			udh.AlreadyApplied = true
+			applied = true
+		} else if spanner.ErrCode(err) != codes.NotFound {
+			return fmt.Errorf("failed read UserDepositHistory : %w", err)
+		}
+
 		row, err := tx.ReadRowWithOptions(ctx, s.UserBalanceTable(),
 			spanner.Key{userID},
 			[]string{"UserID", "Amount", "Point", "CreatedAt", "UpdatedAt"},
@@ -205,8 +235,6 @@ func (s *Store) Deposit(ctx context.Context, userID string, depositID string, de
 		if spanner.ErrCode(err) == codes.NotFound {
 			ub = UserBalance{
 				UserID:    userID,
-				Amount:    amount,
-				Point:     point,
 				CreatedAt: spanner.CommitTimestamp,
 			}
 		} else if err != nil {
@@ -215,9 +243,13 @@ func (s *Store) Deposit(ctx context.Context, userID string, depositID string, de
 			if err := row.ToStruct(&ub); err != nil {
 				return fmt.Errorf("failed spanner.Row.ToStruct to UserBalance : %w", err)
 			}
-			ub.Amount += amount
-			ub.Point += point
 		}
+		if applied {
+			// 前回のDepositで加算済みなので、何も書き込まない
+			return nil
+		}
+		ub.Amount += amount
+		ub.Point += point
 		ub.UpdatedAt = spanner.CommitTimestamp
 		ubMu, err := spanner.InsertOrUpdateStruct(s.UserBalanceTable(), ub)
 		if err != nil {
@@ -226,10 +258,10 @@ func (s *Store) Deposit(ctx context.Context, userID string, depositID string, de
 		mus = append(mus, ubMu)
 
 		info := SupplementaryInformation{
-			Name:   uuid.New().String(),
-			Rating: rand.Float64(),
-			Open:   RandomOpen(),
-			Tags:   RandomTags(),
+			Name:   srunner.NewUUID(ctx).String(),
+			Rating: srunner.RandFromContext(ctx).Float64(),
+			Open:   RandomOpen(ctx),
+			Tags:   RandomTags(ctx),
 		}
 
 		udh = UserDepositHistory{
@@ -252,8 +284,14 @@ func (s *Store) Deposit(ctx context.Context, userID string, depositID string, de
 		TransactionTag: spanners.AppTag(),
 	})
 	if err != nil {
+		if isSpannerOutcomeUnknown(err) {
+			return nil, nil, fmt.Errorf("%w : %w", ErrOutcomeUnknown, err)
+		}
 		return nil, nil, err
 	}
+	if applied {
+		return &ub, &udh, nil
+	}
 	ub.CreatedAt = resp.CommitTs
 	udh.CreatedAt = resp.CommitTs
 
@@ -267,18 +305,7 @@ func (s *Store) DepositDML(ctx context.Context, userID string, depositID string,
 	var ub UserBalance
 	var udh *UserDepositHistory
 	_, err = s.sc.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-		insertDepositHistory := spanner.NewStatement(
-			fmt.Sprintf("INSERT %s (UserID, DepositID, DepositType, Amount, Point, CreatedAt)"+
-				" VALUES (@UserID, @DepositID, @DepositType, @Amount, @Point, PENDING_COMMIT_TIMESTAMP())"+
-				" THEN RETURN UserID, DepositID, DepositType, Amount, Point", s.UserDepositHistoryTable()),
-		)
-		insertDepositHistory.Params = map[string]interface{}{
-			"UserID":      userID,
-			"DepositID":   depositID,
-			"DepositType": depositType.ToIntn(),
-			"Amount":      amount,
-			"Point":       point,
-		}
+		insertDepositHistory := s.insertDepositHistoryStatement(userID, depositID, depositType, amount, point)
 		iter := tx.Query(ctx, insertDepositHistory)
 		for {
 			row, err := iter.Next()
@@ -293,16 +320,7 @@ func (s *Store) DepositDML(ctx context.Context, userID string, depositID string,
 			}
 		}
 
-		updateUserBalance := spanner.NewStatement(
-			fmt.Sprintf("UPDATE %s SET Amount = Amount + @Amount, Point = Point + @Point, UpdatedAt = PENDING_COMMIT_TIMESTAMP()"+
-				" WHERE UserID = @UserID"+
-				" THEN RETURN UserID, Amount, Point", s.UserBalanceTable()),
-		)
-		updateUserBalance.Params = map[string]interface{}{
-			"UserID": userID,
-			"Amount": amount,
-			"Point":  point,
-		}
+		updateUserBalance := s.updateUserBalanceStatement(userID, amount, point)
 		iter = tx.Query(ctx, updateUserBalance)
 		for {
 			row, err := iter.Next()
@@ -332,26 +350,7 @@ func (s *Store) SelectUserDepositHistory(ctx context.Context, userID string, lim
 	ctx, _ = trace.StartSpan(ctx, "BalanceStore.SelectUserDepositHistory")
 	defer func() { trace.EndSpan(ctx, err) }()
 
-	const q = `
-SELECT 
-  UserID,
-	DepositID,
-	DepositType,
-	Amount,
-	Point,
-	SupplementaryInformation,
-	CreatedAt
-FROM UserDepositHistory
-WHERE UserID = @UserID
-ORDER BY CreatedAt DESC
-LIMIT @Limit
-`
-
-	stm := spanner.NewStatement(q)
-	stm.Params = map[string]interface{}{
-		"UserID": userID,
-		"Limit":  limit,
-	}
+	stm := selectUserDepositHistoryStatement(userID, limit)
 
 	iter := s.sc.Single().Query(ctx, stm)
 	for {
@@ -400,18 +399,62 @@ func (s *Store) InsertOrUpdateUserDepositHistorySum(ctx context.Context, tx *spa
 	return nil
 }
 
+// staleReadBound is primary=falseの時のTimestampBound
+// AlloyDBのread replicaと同じく、少し古いデータを読む代わりにleaderに問い合わせずに済むようにする
+var staleReadBound = spanner.ExactStaleness(10 * time.Second)
+
+// readOnlyTransaction is primary=trueの場合はstrong read, falseの場合はstale readのReadOnlyTransactionを返す
+func (s *Store) readOnlyTransaction(primary bool) *spanner.ReadOnlyTransaction {
+	if primary {
+		return s.sc.ReadOnlyTransaction()
+	}
+	return s.sc.ReadOnlyTransaction().WithTimestampBound(staleReadBound)
+}
+
+// ReadUserBalances is 指定した複数のUserIDのBalanceを取得する
+// primary=falseの場合はstale readで取得する
+func (s *Store) ReadUserBalances(ctx context.Context, userIDs []string, primary bool) (models []*UserBalance, err error) {
+	ctx, _ = trace.StartSpan(ctx, "BalanceStore.ReadUserBalances")
+	defer func() { trace.EndSpan(ctx, err) }()
+
+	ro := s.readOnlyTransaction(primary)
+	defer ro.Close()
+
+	keys := make([]spanner.Key, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = spanner.Key{userID}
+	}
+	iter := ro.ReadWithOptions(ctx, s.UserBalanceTable(), spanner.KeySetFromKeys(keys...),
+		[]string{"UserID", "Amount", "Point", "CreatedAt", "UpdatedAt"},
+		&spanner.ReadOptions{
+			RequestTag: spanners.AppTag(),
+		})
+	err = iter.Do(func(row *spanner.Row) error {
+		var v UserBalance
+		if err := row.ToStruct(&v); err != nil {
+			return fmt.Errorf("failed row.ToStruct() UserBalance : %w", err)
+		}
+		models = append(models, &v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed ReadUserBalances : %w", err)
+	}
+	return models, nil
+}
+
 // FindUserDepositHistories is 指定したuserIDのUserDepositHistoryの最新100件を取得する
 // SQLで最初から取得すれば良いが、GetMultiをやるめたにワンクッション置いている
-func (s *Store) FindUserDepositHistories(ctx context.Context, userID string) (models []*UserDepositHistory, err error) {
+// primary=falseの場合はstale readで取得する
+func (s *Store) FindUserDepositHistories(ctx context.Context, userID string, primary bool) (models []*UserDepositHistory, err error) {
 	ctx, _ = trace.StartSpan(ctx, "BalanceStore.FindUserDepositHistories")
 	defer func() { trace.EndSpan(ctx, err) }()
 
-	ro := s.sc.ReadOnlyTransaction().WithTimestampBound(spanner.ExactStaleness(10 * time.Second))
+	ro := s.readOnlyTransaction(primary)
 	defer ro.Close()
 	var userDepositHistoryKeys []spanner.Key
 	{
-		stm := spanner.NewStatement("SELECT UserID, DepositID FROM UserDepositHistory WHERE UserID = @UserID ORDER BY CreatedAt DESC LIMIT 100")
-		stm.Params = map[string]interface{}{"UserID": userID}
+		stm := findUserDepositHistoryKeysStatement(userID)
 		iter := ro.Query(ctx, stm)
 		defer iter.Stop()
 		for {
@@ -459,20 +502,18 @@ func CreateUserID(ctx context.Context, id int64) string {
 	return fmt.Sprintf("u%010d", id)
 }
 
+// RandomUserID is RunnerSpecのkeyDistributionに従って、1 ~ UserAccountIDMax()-1 のUserIDを選ぶ
 func RandomUserID(ctx context.Context) string {
-	v := rand.Int63n(UserAccountIDMax())
-	if v == 0 {
-		return CreateUserID(ctx, 1)
-	}
-	return CreateUserID(ctx, v)
+	return CreateUserID(ctx, srunner.PickKey(ctx, UserAccountIDMax()-1)+1)
 }
 
+// CreateDepositID is workerのrandでDepositIDを作る. 同じseedで実行すると同じDepositIDになる
 func CreateDepositID(ctx context.Context) string {
-	return fmt.Sprintf("Deposit:%s", uuid.New().String())
+	return fmt.Sprintf("Deposit:%s", srunner.NewUUID(ctx).String())
 }
 
 func RandomDepositType(ctx context.Context) DepositType {
-	i := rand.Intn(10)
+	i := srunner.RandFromContext(ctx).Intn(10)
 	switch {
 	case i == 8:
 		return DepositTypeCampaignPoint
@@ -485,11 +526,12 @@ func RandomDepositType(ctx context.Context) DepositType {
 	}
 }
 
-func RandomOpen() map[string]bool {
+func RandomOpen(ctx context.Context) map[string]bool {
+	rnd := srunner.RandFromContext(ctx)
 	m := map[string]bool{}
-	count := rand.Intn(7)
+	count := rnd.Intn(7)
 	for i := 0; count > i; i++ {
-		n := rand.Intn(10)
+		n := rnd.Intn(10)
 		switch n {
 		case 0:
 			m["monday"] = true
@@ -511,11 +553,12 @@ func RandomOpen() map[string]bool {
 	return m
 }
 
-func RandomTags() []string {
+func RandomTags(ctx context.Context) []string {
+	rnd := srunner.RandFromContext(ctx)
 	m := map[string]bool{}
-	count := rand.Intn(10)
+	count := rnd.Intn(10)
 	for i := 0; count > i; i++ {
-		n := rand.Intn(9)
+		n := rnd.Intn(9)
 		switch n {
 		case 1:
 			m["ComputeEngine"] = true
@@ -541,5 +584,7 @@ func RandomTags() []string {
 	for k, _ := range m {
 		tags = append(tags, k)
 	}
+	// 同じseedで同じ値になるように、mapの順番に左右されないようにする
+	sort.Strings(tags)
 	return tags
 }
@@ -4,25 +4,45 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sinmetal/srunner/internal/alloy"
 	"github.com/sinmetal/srunner/internal/trace"
 )
 
 type StoreAlloy struct {
-	pool            *pgxpool.Pool
-	readReplicaPool []*pgxpool.Pool
+	pool         *pgxpool.Pool
+	readReplicas *alloy.ReplicaSet
 }
 
-func NewStoreAlloy(pool *pgxpool.Pool, readReplicaPool []*pgxpool.Pool) *StoreAlloy {
+// NewStoreAlloy is StoreAlloyを作る
+// readReplicasがnilの場合は、primary=falseでもprimary instanceから読む
+func NewStoreAlloy(pool *pgxpool.Pool, readReplicas *alloy.ReplicaSet) *StoreAlloy {
 	return &StoreAlloy{
-		pool:            pool,
-		readReplicaPool: readReplicaPool,
+		pool:         pool,
+		readReplicas: readReplicas,
 	}
 }
 
+// readPool is primary=falseの場合はReplicaSetからread replicaを選ぶ
+// healthyなread replicaがない場合はprimary instanceを返す
+// 返したdoneにはqueryの結果を渡す
+func (s *StoreAlloy) readPool(ctx context.Context, primary bool) (pool *pgxpool.Pool, done func(err error)) {
+	if primary {
+		return s.pool, func(err error) {}
+	}
+	replica, done := s.readReplicas.Acquire(ctx)
+	if replica == nil {
+		return s.pool, done
+	}
+	return replica.Pool, done
+}
+
+func (s *StoreAlloy) UserAccountTable() string {
+	return "UserAccount"
+}
+
 func (s *StoreAlloy) UserDepositHistoryTable() string {
 	return "UserDepositHistory"
 }
@@ -31,13 +51,36 @@ func (s *StoreAlloy) UserBalanceTable() string {
 	return "UserBalance"
 }
 
-func (s *StoreAlloy) Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (err error) {
+// CreateUserAccount is UserAccountを作成する
+func (s *StoreAlloy) CreateUserAccount(ctx context.Context, userAccount *UserAccount) (resultUserAccount *UserAccount, err error) {
+	ctx, _ = trace.StartSpan(ctx, "BalanceStoreAlloy.CreateUserAccount")
+	defer func() { trace.EndSpan(ctx, err) }()
+
+	err = s.pool.QueryRow(ctx, s.createUserAccountSQL(),
+		pgx.NamedArgs{
+			"UserID": userAccount.UserID,
+			"Age":    userAccount.Age,
+			"Height": userAccount.Height,
+			"Weight": userAccount.Weight,
+		},
+	).Scan(&userAccount.CreatedAt, &userAccount.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert user account: %w", err)
+	}
+	return userAccount, nil
+}
+
+// Deposit is UserDepositHistoryをINSERTして、UserBalanceに加算する
+// UserBalanceがまだない場合はSpannerのStore.Depositと同じく作成する
+// 同じDepositIDのUserDepositHistoryが既にある場合は加算せずに、その時点のUserBalanceとUserDepositHistoryを返す
+// COMMITの結果がわからなかった場合は ErrOutcomeUnknown を返す
+func (s *StoreAlloy) Deposit(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (userBalance *UserBalance, userDepositHistory *UserDepositHistory, err error) {
 	ctx, _ = trace.StartSpan(ctx, "BalanceStoreAlloy.Deposit")
 	defer func() { trace.EndSpan(ctx, err) }()
 
 	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
 	}
 	defer func() {
 		if err != nil {
@@ -49,13 +92,14 @@ func (s *StoreAlloy) Deposit(ctx context.Context, userID string, depositID strin
 		}
 	}()
 
-	insertDepositHistorySQL :=
-		fmt.Sprintf("INSERT INTO %s (UserID, DepositID, DepositType, Amount, Point)"+
-			" VALUES (@UserID, @DepositID, @DepositType, @Amount, @Point)",
-			s.UserDepositHistoryTable(),
-		)
-	//fmt.Println(insertDepositHistorySQL)
-	_, err = tx.Exec(ctx, insertDepositHistorySQL,
+	udh := UserDepositHistory{
+		UserID:      userID,
+		DepositID:   depositID,
+		DepositType: depositType,
+		Amount:      amount,
+		Point:       point,
+	}
+	err = tx.QueryRow(ctx, s.insertDepositHistorySQL(),
 		pgx.NamedArgs{
 			"UserID":      userID,
 			"DepositID":   depositID,
@@ -63,33 +107,67 @@ func (s *StoreAlloy) Deposit(ctx context.Context, userID string, depositID strin
 			"Amount":      amount,
 			"Point":       point,
 		},
-	)
+	).Scan(&udh.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// 前回のDepositで加算済み
+		return s.readAppliedDeposit(ctx, tx, userID, depositID)
+	}
 	if err != nil {
-		return fmt.Errorf("insert deposit history: %w", err)
+		return nil, nil, fmt.Errorf("insert deposit history: %w", err)
 	}
 
-	updateUserBalanceSQL := fmt.Sprintf("UPDATE %s SET Amount = Amount + @Amount, Point = Point + @Point, UpdatedAt = NOW()"+
-		" WHERE UserID = @UserID", s.UserBalanceTable(),
-	)
-	//fmt.Println(updateUserBalanceSQL)
-	_, err = tx.Exec(ctx, updateUserBalanceSQL,
+	var ub UserBalance
+	err = tx.QueryRow(ctx, s.upsertUserBalanceSQL(),
 		pgx.NamedArgs{
-			"UserID":      userID,
-			"DepositID":   depositID,
-			"DepositType": depositType,
-			"Amount":      amount,
-			"Point":       point,
+			"UserID": userID,
+			"Amount": amount,
+			"Point":  point,
 		},
-	)
+	).Scan(&ub.UserID, &ub.Amount, &ub.Point, &ub.CreatedAt, &ub.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("update user balance: %w", err)
+		return nil, nil, fmt.Errorf("upsert user balance: %w", err)
 	}
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return fmt.Errorf("commit user balance: %w", err)
+		if isCommitOutcomeUnknown(err) {
+			return nil, nil, fmt.Errorf("%w : commit user balance: %w", ErrOutcomeUnknown, err)
+		}
+		return nil, nil, fmt.Errorf("commit user balance: %w", err)
+	}
+	return &ub, &udh, nil
+}
+
+// readAppliedDeposit is 既にあるUserDepositHistoryと、UserBalanceを読んでtxをcommitする
+func (s *StoreAlloy) readAppliedDeposit(ctx context.Context, tx pgx.Tx, userID string, depositID string) (userBalance *UserBalance, userDepositHistory *UserDepositHistory, err error) {
+	udh, err := scanUserDepositHistory(tx.QueryRow(ctx, s.readDepositHistorySQL(),
+		pgx.NamedArgs{"UserID": userID, "DepositID": depositID}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read deposit history: %w", err)
 	}
-	return nil
+	udh.AlreadyApplied = true
+
+	var ub UserBalance
+	err = tx.QueryRow(ctx, s.readUserBalanceSQL(), pgx.NamedArgs{"UserID": userID}).
+		Scan(&ub.UserID, &ub.Amount, &ub.Point, &ub.CreatedAt, &ub.UpdatedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read user balance: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit read deposit: %w", err)
+	}
+	return &ub, udh, nil
+}
+
+func scanUserDepositHistory(row pgx.Row) (*UserDepositHistory, error) {
+	var udh UserDepositHistory
+	var depositType int64
+	if err := row.Scan(&udh.UserID, &udh.DepositID, &depositType, &udh.Amount, &udh.Point, &udh.CreatedAt); err != nil {
+		return nil, err
+	}
+	udh.DepositType = DepositType(depositType)
+	return &udh, nil
 }
 
 func (s *StoreAlloy) InsertUserBalance(ctx context.Context, model *UserBalance) (err error) {
@@ -107,11 +185,7 @@ func (s *StoreAlloy) InsertUserBalance(ctx context.Context, model *UserBalance)
 		}
 	}()
 
-	sql := `
-INSERT INTO UserBalance (UserID, Amount, Point) VALUES
-    (@UserID, @Amount, @Point);
-`
-	_, err = tx.Exec(ctx, sql,
+	_, err = tx.Exec(ctx, insertUserBalanceSQL,
 		pgx.NamedArgs{
 			"UserID": model.UserID,
 			"Amount": model.Amount,
@@ -134,27 +208,15 @@ func (s *StoreAlloy) ReadUserBalances(ctx context.Context, userIDs []string, pri
 	ctx, _ = trace.StartSpan(ctx, "BalanceStoreAlloy.ReadUserBalances")
 	defer func() { trace.EndSpan(ctx, err) }()
 
-	var pool *pgxpool.Pool
-	if !primary && len(s.readReplicaPool) > 0 {
-		pool = s.readReplicaPool[0]
-	} else {
-		pool = s.pool
-	}
-	placeholders := make([]string, len(userIDs))
-	for i := range placeholders {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
-	sql := fmt.Sprintf(`
-SELECT UserID, Amount, Point FROM UserBalance WHERE UserID IN (%s)
-`, strings.Join(placeholders, ","))
-	//fmt.Println(sql)
-	var args []any
-	for _, userID := range userIDs {
-		args = append(args, userID)
+	pool, done := s.readPool(ctx, primary)
+	defer func() { done(err) }()
+	args := pgx.NamedArgs{}
+	for i, userID := range userIDs {
+		args[fmt.Sprintf("UserID%d", i)] = userID
 	}
 
 	var results []*UserBalance
-	rows, err := pool.Query(ctx, sql, args...)
+	rows, err := pool.Query(ctx, readUserBalancesSQL(len(userIDs)), args)
 	if err != nil {
 		return nil, fmt.Errorf("read user balances: %w", err)
 	}
@@ -170,6 +232,9 @@ SELECT UserID, Amount, Point FROM UserBalance WHERE UserID IN (%s)
 			Point:  columns[2].(int64),
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read user balances: %w", err)
+	}
 	return results, nil
 }
 
@@ -179,18 +244,11 @@ func (s *StoreAlloy) FindUserDepositHistories(ctx context.Context, userID string
 	ctx, _ = trace.StartSpan(ctx, "BalanceStoreAlloy.FindUserDepositHistories")
 	defer func() { trace.EndSpan(ctx, err) }()
 
-	var pool *pgxpool.Pool
-	if !primary && len(s.readReplicaPool) > 0 {
-		pool = s.readReplicaPool[0]
-	} else {
-		pool = s.pool
-	}
+	pool, done := s.readPool(ctx, primary)
+	defer func() { done(err) }()
 
 	var userDepositHistoryKeys []*UserDepositHistory
-	selectLatestDepositHistories := fmt.Sprintf(`
-		SELECT UserId, DepositId FROM UserDepositHistory WHERE UserID = @UserID ORDER BY CreatedAt DESC
-		`)
-	iter, err := pool.Query(ctx, selectLatestDepositHistories, pgx.NamedArgs{"UserID": userID})
+	iter, err := pool.Query(ctx, selectLatestDepositHistoriesSQL, pgx.NamedArgs{"UserID": userID})
 	if err != nil {
 		return nil, fmt.Errorf("read user deposit histories: %w", err)
 	}
@@ -205,35 +263,30 @@ func (s *StoreAlloy) FindUserDepositHistories(ctx context.Context, userID string
 			DepositID: columns[1].(string),
 		})
 	}
-
-	placeholders := make([]string, len(userDepositHistoryKeys))
-	for i := range placeholders {
-		a := 1 + i*2
-		placeholders[i] = fmt.Sprintf("($%d, $%d)", a, a+1)
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("read user deposit histories: %w", err)
+	}
+	if len(userDepositHistoryKeys) == 0 {
+		// IN () はSQLとして正しくないので、Depositしたことがないuserはここで返す
+		return nil, nil
 	}
-	sql := fmt.Sprintf(`
-SELECT UserID, DepositID, DepositType, Amount, Point FROM UserDepositHistory
-WHERE (UserID, DepositID) IN (
-    %s
-);
-`, strings.Join(placeholders, ","))
-	//fmt.Println(sql)
-	var args []any
-	for _, v := range userDepositHistoryKeys {
-		args = append(args, v.UserID)
-		args = append(args, v.DepositID)
+
+	args := pgx.NamedArgs{}
+	for i, v := range userDepositHistoryKeys {
+		args[fmt.Sprintf("UserID%d", i)] = v.UserID
+		args[fmt.Sprintf("DepositID%d", i)] = v.DepositID
 	}
 
 	var results []*UserDepositHistory
-	rows, err := pool.Query(ctx, sql, args...)
+	rows, err := pool.Query(ctx, readUserDepositHistoriesSQL(len(userDepositHistoryKeys)), args)
 	if err != nil {
-		return nil, fmt.Errorf("read user balances: %w", err)
+		return nil, fmt.Errorf("find user deposit histories: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		columns, err := rows.Values()
 		if err != nil {
-			return nil, fmt.Errorf("read user balances: %w", err)
+			return nil, fmt.Errorf("find user deposit histories: %w", err)
 		}
 		results = append(results, &UserDepositHistory{
 			UserID:      columns[0].(string),
@@ -243,5 +296,8 @@ WHERE (UserID, DepositID) IN (
 			Point:       columns[4].(int64),
 		})
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("find user deposit histories: %w", err)
+	}
 	return results, nil
 }
@@ -8,8 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/internal/alloy"
 	"github.com/sinmetal/srunner/internal/trace"
+	"github.com/sinmetal/srunner/pgtest"
 )
 
 // Userをいっぱい作るのに使っている。
@@ -61,3 +63,97 @@ func TestStoreAlloy_InsertUserBalance(t *testing.T) {
 		}
 	}
 }
+
+// newTestStoreAlloy is local PostgreSQLにddl/alloy/balance.sqlを適用したStoreAlloyを返す
+func newTestStoreAlloy(t *testing.T) *StoreAlloy {
+	pool := pgtest.Setup(t, "../ddl/alloy/balance.sql")
+	return NewStoreAlloy(pool, nil)
+}
+
+func TestStoreAlloy_Deposit(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStoreAlloy(t)
+
+	userID := CreateUserID(ctx, 1)
+	if _, err := s.CreateUserAccount(ctx, &UserAccount{UserID: userID, Age: 20, Height: 170, Weight: 60}); err != nil {
+		t.Fatal(err)
+	}
+	// UserBalanceがない状態からDepositできる
+	ub, udh, err := s.Deposit(ctx, userID, CreateDepositID(ctx), DepositTypeBank, 10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ub.Amount != 10000 || udh.Amount != 10000 {
+		t.Errorf("unexpected balance=%+v history=%+v", ub, udh)
+	}
+	ub, _, err = s.Deposit(ctx, userID, CreateDepositID(ctx), DepositTypeSales, 500, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ub.Amount != 10500 || ub.Point != 700 {
+		t.Errorf("unexpected balance=%+v", ub)
+	}
+
+	balances, err := s.ReadUserBalances(ctx, []string{userID, CreateUserID(ctx, 2)}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Amount != 10500 {
+		t.Errorf("unexpected balances %+v", balances)
+	}
+
+	histories, err := s.FindUserDepositHistories(ctx, userID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 2 {
+		t.Errorf("want 2 histories but got %d", len(histories))
+	}
+	histories, err = s.FindUserDepositHistories(ctx, CreateUserID(ctx, 2), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 0 {
+		t.Errorf("want no histories but got %d", len(histories))
+	}
+
+	report, err := s.Verify(ctx, VerifyOptions{UserIDMax: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.CheckedHistories != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestStoreAlloy_Deposit_Idempotent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStoreAlloy(t)
+
+	userID := CreateUserID(ctx, 1)
+	depositID := CreateDepositID(ctx)
+	if _, _, err := s.Deposit(ctx, userID, depositID, DepositTypeBank, 10000, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 同じDepositIDでretryしても、2回加算しない
+	ub, udh, err := s.Deposit(ctx, userID, depositID, DepositTypeBank, 10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ub.Amount != 10000 || udh.DepositID != depositID || udh.Amount != 10000 || !udh.AlreadyApplied {
+		t.Errorf("unexpected balance=%+v history=%+v", ub, udh)
+	}
+}
+
+func TestStoreAlloy_Statements(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStoreAlloy(t)
+
+	report, err := srunner.Preflight(ctx, &srunner.RunnerEnv{AlloyDB: s.pool}, srunner.BackendAlloyDB, s.Statements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range report.Invalid() {
+		t.Errorf("%s : %s", v.Statement.Name, v.Err)
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"cloud.google.com/go/spanner"
 	"github.com/k0kubun/pp"
+	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/balance"
 	"github.com/sinmetal/srunner/internal/trace"
+	"github.com/sinmetal/srunner/spannertest"
 )
 
 func TestStore_Deposit(t *testing.T) {
@@ -17,29 +20,57 @@ func TestStore_Deposit(t *testing.T) {
 
 	trace.Init(ctx, "unit-test", "v0.0.0")
 
-	spannerProjectID := os.Getenv("SRUNNER_SPANNER_PROJECT_ID")
-	spannerInstanceID := os.Getenv("SRUNNER_SPANNER_INSTANCE_ID")
-	spannerDatabaseID := os.Getenv("SRUNNER_SPANNER_DATABASE_ID")
-
-	dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s", spannerProjectID, spannerInstanceID, spannerDatabaseID)
-
-	sCli, err := spanner.NewClient(ctx, dbName)
-	if err != nil {
-		t.Fatal(err)
-	}
+	sCli := spannertest.Setup(t, "balance")
 	s, err := balance.NewStore(ctx, sCli)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for {
+	const userID = "u0000000001"
+	for i := 1; i <= 2; i++ {
 		depositID := balance.CreateDepositID(ctx)
-		ub, udh, err := s.Deposit(ctx, "u0000000001", depositID, balance.DepositTypeBank, 10000, 0)
+		ub, udh, err := s.Deposit(ctx, userID, depositID, balance.DepositTypeBank, 10000, 0)
 		if err != nil {
 			t.Fatal(err)
 		}
-		pp.Print(ub)
-		pp.Print(udh)
+		if e, g := int64(10000*i), ub.Amount; e != g {
+			t.Errorf("Amount want %d but got %d", e, g)
+		}
+		if e, g := depositID, udh.DepositID; e != g {
+			t.Errorf("DepositID want %s but got %s", e, g)
+		}
+	}
+}
+
+func TestStore_Deposit_Idempotent(t *testing.T) {
+	ctx := context.Background()
+
+	trace.Init(ctx, "unit-test", "v0.0.0")
+
+	sCli := spannertest.Setup(t, "balance")
+	s, err := balance.NewStore(ctx, sCli)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const userID = "u0000000001"
+	depositID := balance.CreateDepositID(ctx)
+	if _, _, err := s.Deposit(ctx, userID, depositID, balance.DepositTypeBank, 10000, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 同じDepositIDでretryしても、2回加算しない
+	ub, udh, err := s.Deposit(ctx, userID, depositID, balance.DepositTypeBank, 10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(10000), ub.Amount; e != g {
+		t.Errorf("Amount want %d but got %d", e, g)
+	}
+	if !udh.AlreadyApplied {
+		t.Errorf("want AlreadyApplied")
+	}
+	if e, g := depositID, udh.DepositID; e != g {
+		t.Errorf("DepositID want %s but got %s", e, g)
 	}
 }
 
@@ -102,3 +133,25 @@ func TestStore_SelectUserDepositHistory(t *testing.T) {
 	}
 	pp.Println(l)
 }
+
+func TestStore_Statements(t *testing.T) {
+	ctx := context.Background()
+
+	sCli := spannertest.Setup(t, "balance")
+	s, err := balance.NewStore(ctx, sCli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := srunner.Preflight(ctx, &srunner.RunnerEnv{Spanner: sCli}, srunner.BackendSpanner, s.Statements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range report.Invalid() {
+		// fakeはTHEN RETURNをサポートしていないので、THEN RETURNのStatementはEmulatorでだけ確認する
+		if !spannertest.IsSpannerEmulatorHost() && strings.Contains(v.Statement.SQL, "THEN RETURN") {
+			t.Logf("skip %s on in-memory fake : %s", v.Statement.Name, v.Err)
+			continue
+		}
+		t.Errorf("%s : %s", v.Statement.Name, v.Err)
+	}
+}
@@ -0,0 +1,160 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sinmetal/srunner"
+)
+
+// ErrOutcomeUnknown is Depositのcommitが成功したかどうかわからない
+// SpannerではcontextのtimeoutやcancelでCommitの結果を受け取れなかった時に "transaction outcome unknown" になる
+// 同じDepositIDで DepositReconciler.Reconcile すると、commitされていたかどうかがわかる
+var ErrOutcomeUnknown = errors.New("deposit outcome unknown")
+
+// DepositRunnerが srunner.RecordOutcome で記録するoutcome
+const (
+	// OutcomeUnknown is DepositがErrOutcomeUnknownになった
+	OutcomeUnknown = "unknown"
+
+	// OutcomeResolvedCommitted is ErrOutcomeUnknownになったDepositは、commitされていた
+	OutcomeResolvedCommitted = "resolved-committed"
+
+	// OutcomeResolvedAbsent is ErrOutcomeUnknownになったDepositは、commitされていなかったので、Reconcileで加算した
+	// DepositIDのUserDepositHistoryを読んで確認するだけではなく、ReconcileのDepositで加算しているので、
+	// resolved-absentでも残高にはDeposit 1回分が加算されている
+	OutcomeResolvedAbsent = "resolved-absent"
+)
+
+const (
+	// DefaultReconcileTimeout is DepositReconcilerでTimeoutを指定しなかった時に、1回のDepositにかける時間
+	DefaultReconcileTimeout = 10 * time.Second
+
+	// DefaultReconcileAttempts is DepositReconcilerでMaxAttemptsを指定しなかった時に、Depositを試す回数
+	DefaultReconcileAttempts = 3
+
+	// DefaultReconcileInterval is DepositReconcilerでIntervalを指定しなかった時に、失敗したDepositを再度試すまでの時間
+	DefaultReconcileInterval = 500 * time.Millisecond
+
+	// DefaultReconcileMaxElapsed is DepositReconcilerでMaxElapsedを指定しなかった時に、Reconcile全体にかける時間
+	// srunner.DefaultDrainTimeoutより短くして、Drainの間にReconcileが終わるようにする
+	DefaultReconcileMaxElapsed = 20 * time.Second
+)
+
+// DepositReconciler is ErrOutcomeUnknownになったDepositを、同じDepositIDでもう一度Depositして解決する
+//
+// Depositは同じDepositIDのUserDepositHistoryが既にあれば加算しないので、何度実行しても1回だけ加算される
+// 1回読むだけだと、client側が諦めた後にcommitされたDepositをcommitされていないと判断してしまうが、
+// Depositはtransactionの中で確認するので、元のDepositと同時にcommitされることはない
+type DepositReconciler struct {
+	Backend Backend
+
+	// Timeout is 1回のDepositにかける時間. 0の場合はDefaultReconcileTimeout
+	Timeout time.Duration
+
+	// MaxAttempts is Depositを試す回数. 0の場合はDefaultReconcileAttempts
+	MaxAttempts int
+
+	// Interval is 失敗したDepositを再度試すまでの時間. 0の場合はDefaultReconcileInterval
+	Interval time.Duration
+
+	// MaxElapsed is Reconcile全体にかける時間. 0の場合はDefaultReconcileMaxElapsed
+	MaxElapsed time.Duration
+}
+
+// Reconcile is 同じDepositIDでDepositを実行し、元のDepositがcommitされていたかどうかを返す
+// commitされていなかった場合は、このDepositで加算してfalseを返す
+// MaxAttempts回試してもDepositできなかった場合は、最後のerrorを返す
+// 元のDepositのctxはtimeoutしていることが多いので、Depositにはctxのcancelは引き継がずにTimeoutで実行する
+// 2回目以降は、ctxが終了した時、srunner.Stoppingがcloseされた時、MaxElapsedを超える時は試さずにerrorを返す
+func (r *DepositReconciler) Reconcile(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64) (committed bool, err error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReconcileTimeout
+	}
+	attempts := r.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultReconcileAttempts
+	}
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	maxElapsed := r.MaxElapsed
+	if maxElapsed <= 0 {
+		maxElapsed = DefaultReconcileMaxElapsed
+	}
+	deadline := time.Now().Add(maxElapsed)
+	depositCtx := context.WithoutCancel(ctx)
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if werr := wait(ctx, interval, deadline); werr != nil {
+				return false, fmt.Errorf("failed reconcile deposit %s after %d attempts : %w", depositID, i, errors.Join(err, werr))
+			}
+		}
+		var udh *UserDepositHistory
+		udh, err = r.deposit(depositCtx, min(timeout, time.Until(deadline)), userID, depositID, depositType, amount, point)
+		if err == nil {
+			return udh.AlreadyApplied, nil
+		}
+	}
+	return false, fmt.Errorf("failed reconcile deposit %s after %d attempts : %w", depositID, attempts, err)
+}
+
+// errReconcileDeadline is 次のDepositを試すとMaxElapsedを超える
+var errReconcileDeadline = errors.New("reconcile deadline exceeded")
+
+// wait is 次のDepositを試すまでintervalだけ待つ
+// ctxが終了した時、srunner.Stoppingがcloseされた時、deadlineまでにintervalが終わらない時は待たずにerrorを返す
+func wait(ctx context.Context, interval time.Duration, deadline time.Time) error {
+	if time.Until(deadline) <= interval {
+		return errReconcileDeadline
+	}
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-srunner.Stopping(ctx):
+		return srunner.ErrStopped
+	case <-t.C:
+		return nil
+	}
+}
+
+func (r *DepositReconciler) deposit(ctx context.Context, timeout time.Duration, userID string, depositID string, depositType DepositType, amount int64, point int64) (*UserDepositHistory, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, udh, err := r.Backend.Deposit(ctx, userID, depositID, depositType, amount, point)
+	return udh, err
+}
+
+// isSpannerOutcomeUnknown is Spannerのclientが、Commitの結果を受け取る前にcontextが終了したerrorかどうか
+// Spannerのclientは *spanner.Error の中に *spanner.TransactionOutcomeUnknownError をwrapして返す
+func isSpannerOutcomeUnknown(err error) bool {
+	return errors.As(err, new(*spanner.TransactionOutcomeUnknownError))
+}
+
+// isCommitOutcomeUnknown is PostgreSQLのCOMMITを送った後に、networkやIOのerrorで結果を受け取れなかったかどうか
+// serverがerrorを返した場合 (*pgconn.PgError, pgx.ErrTxCommitRollback) はcommitされていない
+// 送る前に失敗した場合 (pgconn.SafeToRetry) もcommitされていないので、outcome unknownにはしない
+func isCommitOutcomeUnknown(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return false
+	}
+	if errors.Is(err, pgx.ErrTxCommitRollback) {
+		return false
+	}
+	return !pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,108 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sinmetal/srunner"
+	"github.com/sinmetal/srunner/operation"
+)
+
+func init() {
+	for backend, newBackend := range map[srunner.Backend]backendFactory{
+		srunner.BackendSpanner: newSpannerBackend,
+		srunner.BackendAlloyDB: newAlloyBackend,
+	} {
+		srunner.RegisterRunner(backend, "DEPOSIT", "Balance.Deposit", depositRunnerFactory(newBackend))
+		srunner.RegisterRunner(backend, "READ_USER_BALANCES", "Balance.ReadUserBalances", readUserBalancesRunnerFactory(newBackend))
+		srunner.RegisterRunner(backend, "FIND_USER_DEPOSIT_HISTORIES", "Balance.FindUserDepositHistories", findUserDepositHistoriesRunnerFactory(newBackend))
+	}
+	srunner.RegisterRunner(srunner.BackendSpanner, "DEPOSIT_DML", "Balance.DepositDML", newDepositDMLRunner)
+
+	for backend, statements := range map[srunner.Backend]srunner.StatementsFunc{
+		srunner.BackendSpanner: spannerStatements,
+		srunner.BackendAlloyDB: alloyStatements,
+	} {
+		for _, name := range []string{"DEPOSIT", "READ_USER_BALANCES", "FIND_USER_DEPOSIT_HISTORIES"} {
+			srunner.RegisterStatements(backend, name, statements)
+		}
+	}
+	srunner.RegisterStatements(srunner.BackendSpanner, "DEPOSIT_DML", spannerStatements)
+}
+
+// backendFactory is RunnerEnvからBackendと、処理時間を記録するOperationRecorderを作る
+type backendFactory func(ctx context.Context, env *srunner.RunnerEnv) (Backend, OperationRecorder, error)
+
+func newSpannerStores(ctx context.Context, env *srunner.RunnerEnv) (*Store, *operation.Store, error) {
+	if env.Spanner == nil {
+		return nil, nil, fmt.Errorf("spanner client is required")
+	}
+	bs, err := NewStore(ctx, env.Spanner)
+	if err != nil {
+		return nil, nil, err
+	}
+	opes, err := operation.NewStore(ctx, env.Spanner)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bs, opes, nil
+}
+
+func newSpannerBackend(ctx context.Context, env *srunner.RunnerEnv) (Backend, OperationRecorder, error) {
+	return newSpannerStores(ctx, env)
+}
+
+func newAlloyBackend(ctx context.Context, env *srunner.RunnerEnv) (Backend, OperationRecorder, error) {
+	if env.AlloyDB == nil {
+		return nil, nil, fmt.Errorf("alloydb pool is required")
+	}
+	return NewStoreAlloy(env.AlloyDB, env.AlloyDBReadReplicas), operation.NewStoreAlloy(env.AlloyDB), nil
+}
+
+func depositRunnerFactory(newBackend backendFactory) srunner.RunnerFactory {
+	return func(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+		b, opes, err := newBackend(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		return &DepositRunner{
+			Backend:        b,
+			OperationStore: opes,
+		}, nil
+	}
+}
+
+func readUserBalancesRunnerFactory(newBackend backendFactory) srunner.RunnerFactory {
+	return func(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+		b, _, err := newBackend(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		return &ReadUserBalancesRunner{
+			Backend: b,
+		}, nil
+	}
+}
+
+func findUserDepositHistoriesRunnerFactory(newBackend backendFactory) srunner.RunnerFactory {
+	return func(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+		b, _, err := newBackend(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		return &FindUserDepositHistoriesRunner{
+			Backend: b,
+		}, nil
+	}
+}
+
+func newDepositDMLRunner(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+	bs, opes, err := newSpannerStores(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	return &DepositDMLRunner{
+		BalanceStore:   bs,
+		OperationStore: opes,
+	}, nil
+}
@@ -2,131 +2,132 @@ package balance
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"time"
 
-	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
-	"github.com/sinmetal/srunner/operation"
+	"github.com/sinmetal/srunner"
 )
 
+// readUserBalancesSize is ReadUserBalancesRunnerが1回で取得するUser数
+const readUserBalancesSize = 100
+
+// DepositRunner is BackendにDepositする
+// Spanner, AlloyDBどちらのBackendでも同じworkloadになる
+//
+// DepositがErrOutcomeUnknownになった場合は、DepositReconcilerで同じDepositIDでもう一度Depositして解決する
+// 解決できた場合は成功として扱い、unknown, resolved-committed, resolved-absent の数を srunner.RecordOutcome で記録する
+// resolved-absent は元のDepositがcommitされていなかったので、DepositReconcilerのDepositで加算したことを表す
 type DepositRunner struct {
-	BalanceStore   *Store
-	OperationStore *operation.Store
+	Backend        Backend
+	OperationStore OperationRecorder
+
+	// Reconciler is ErrOutcomeUnknownになったDepositを解決する. nilの場合はBackendでDepositする
+	Reconciler *DepositReconciler
 }
 
 func (r *DepositRunner) Run(ctx context.Context) error {
 	userAccountID := RandomUserID(ctx)
 	depositID := CreateDepositID(ctx)
-	var amount int64
-	var point int64
-	depositType := RandomDepositType(ctx)
-	switch depositType {
-	case DepositTypeBank:
-		switch rand.Intn(5) {
-		case 1:
-			amount = 10000
-		case 2:
-			amount = 20000
-		case 3:
-			amount = 30000
-		default:
-			amount = int64(1000 + rand.Intn(200000))
-		}
-	case DepositTypeCampaignPoint:
-		point = int64(10 + rand.Intn(1000))
-	case DepositTypeRefund:
-		amount = int64(10 + rand.Intn(1000))
-	case DepositTypeSales:
-		amount = int64(500 + rand.Intn(10000))
-		point = int64(500 + rand.Intn(10000))
-	default:
-		fmt.Println("unsupported DepositType")
-		return nil
-	}
+	depositType, amount, point := RandomDeposit(ctx)
+
 	start := time.Now()
-	_, _, err := r.BalanceStore.Deposit(ctx, userAccountID, depositID, depositType, amount, point)
+	_, _, err := r.Backend.Deposit(ctx, userAccountID, depositID, depositType, amount, point)
+	if errors.Is(err, ErrOutcomeUnknown) {
+		err = r.reconcile(ctx, userAccountID, depositID, depositType, amount, point, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed balance.Depoist err=%s\n", err)
+		return fmt.Errorf("failed balance.Depoist : %w", err)
 	}
-	elapsed := time.Since(start)
-	_, err = r.OperationStore.Insert(ctx, &operation.Operation{
-		OperationID:   uuid.New().String(),
-		OperationName: "BalanceStore.Deposit",
-		ElapsedTimeMS: elapsed.Milliseconds(),
-		Note:          spanner.NullJSON{},
-		CommitedAt:    spanner.CommitTimestamp,
-	})
+	if err := r.OperationStore.Record(ctx, "BalanceStore.Deposit", time.Since(start)); err != nil {
+		return fmt.Errorf("failed OperationStore.Insert : %w", err)
+	}
+	return nil
+}
+
+// reconcile is ErrOutcomeUnknownになったDepositを解決できればnilを、できなければdepositErrとReconcileのerrorを返す
+func (r *DepositRunner) reconcile(ctx context.Context, userID string, depositID string, depositType DepositType, amount int64, point int64, depositErr error) error {
+	srunner.RecordOutcome(ctx, OutcomeUnknown)
+
+	reconciler := r.Reconciler
+	if reconciler == nil {
+		reconciler = &DepositReconciler{Backend: r.Backend}
+	}
+	committed, err := reconciler.Reconcile(ctx, userID, depositID, depositType, amount, point)
 	if err != nil {
-		return fmt.Errorf("failed OperationStore.Insert err=%s\n", err)
+		return errors.Join(depositErr, err)
+	}
+	if committed {
+		srunner.RecordOutcome(ctx, OutcomeResolvedCommitted)
+	} else {
+		srunner.RecordOutcome(ctx, OutcomeResolvedAbsent)
 	}
 	return nil
 }
 
+// DepositDMLRunner is DMLでDepositする
+// DMLでの実装はSpannerのStoreにしかない
 type DepositDMLRunner struct {
 	BalanceStore   *Store
-	OperationStore *operation.Store
+	OperationStore OperationRecorder
 }
 
 func (r *DepositDMLRunner) Run(ctx context.Context) error {
 	userAccountID := RandomUserID(ctx)
 	depositID := CreateDepositID(ctx)
-	var amount int64
-	var point int64
-	depositType := RandomDepositType(ctx)
-	switch depositType {
-	case DepositTypeBank:
-		switch rand.Intn(5) {
-		case 1:
-			amount = 10000
-		case 2:
-			amount = 20000
-		case 3:
-			amount = 30000
-		default:
-			amount = int64(1000 + rand.Intn(200000))
-		}
-	case DepositTypeCampaignPoint:
-		point = int64(10 + rand.Intn(1000))
-	case DepositTypeRefund:
-		amount = int64(10 + rand.Intn(1000))
-	case DepositTypeSales:
-		amount = int64(500 + rand.Intn(10000))
-		point = int64(500 + rand.Intn(10000))
-	default:
-		fmt.Println("unsupported DepositType")
-		return nil
-	}
+	depositType, amount, point := RandomDeposit(ctx)
 
 	start := time.Now()
 	_, _, err := r.BalanceStore.DepositDML(ctx, userAccountID, depositID, depositType, amount, point)
 	if err != nil {
-		return fmt.Errorf("failed balance.DepositDML err=%s\n", err)
+		return fmt.Errorf("failed balance.DepositDML : %w", err)
 	}
-	elapsed := time.Since(start)
-	_, err = r.OperationStore.Insert(ctx, &operation.Operation{
-		OperationID:   uuid.New().String(),
-		OperationName: "BalanceStore.DepositDML",
-		ElapsedTimeMS: elapsed.Milliseconds(),
-		Note:          spanner.NullJSON{},
-		CommitedAt:    spanner.CommitTimestamp,
-	})
+	if err := r.OperationStore.Record(ctx, "BalanceStore.DepositDML", time.Since(start)); err != nil {
+		return fmt.Errorf("failed OperationStore.Insert : %w", err)
+	}
+	return nil
+}
+
+// ReadUserBalancesRunner is randomに選んだ100 UserのUserBalanceを取得する
+type ReadUserBalancesRunner struct {
+	Backend Backend
+
+	// Primary is trueの場合、AlloyDBではprimary instanceから、Spannerではstrong readで取得する
+	Primary bool
+}
+
+func (r *ReadUserBalancesRunner) Run(ctx context.Context) error {
+	m := make(map[string]bool)
+	var userAccountIDs []string
+	for len(userAccountIDs) < readUserBalancesSize && int64(len(userAccountIDs)) < UserAccountIDMax() {
+		userAccountID := RandomUserID(ctx)
+		if m[userAccountID] {
+			continue
+		}
+		userAccountIDs = append(userAccountIDs, userAccountID)
+		m[userAccountID] = true
+	}
+
+	_, err := r.Backend.ReadUserBalances(ctx, userAccountIDs, r.Primary)
 	if err != nil {
-		return fmt.Errorf("failed OperationStore.Insert err=%s\n", err)
+		return fmt.Errorf("failed ReadUserBalances : %w", err)
 	}
 	return nil
 }
 
+// FindUserDepositHistoriesRunner is randomに選んだUserのUserDepositHistoryを取得する
 type FindUserDepositHistoriesRunner struct {
-	BalanceStore *Store
+	Backend Backend
+
+	// Primary is trueの場合、AlloyDBではprimary instanceから、Spannerではstrong readで取得する
+	Primary bool
 }
 
 func (r *FindUserDepositHistoriesRunner) Run(ctx context.Context) error {
 	userID := RandomUserID(ctx)
-	_, err := r.BalanceStore.FindUserDepositHistories(ctx, userID)
+	_, err := r.Backend.FindUserDepositHistories(ctx, userID, r.Primary)
 	if err != nil {
-		return fmt.Errorf("failed FindUserDepositHistories err=%s\n", err)
+		return fmt.Errorf("failed FindUserDepositHistories : %w", err)
 	}
 	return nil
 }
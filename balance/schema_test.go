@@ -0,0 +1,23 @@
+package balance_test
+
+import (
+	"testing"
+
+	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/schemacheck"
+)
+
+func TestSchema(t *testing.T) {
+	s := schemacheck.Load(t, "balance")
+
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "UserAccount", balance.UserAccount{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "UserBalance", balance.UserBalance{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "UserDepositHistory", balance.UserDepositHistory{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "UserDepositHistorySum", balance.UserDepositHistorySum{}))
+
+	issues, err := schemacheck.CheckPackage(s, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemacheck.Verify(t, issues)
+}
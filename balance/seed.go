@@ -0,0 +1,46 @@
+package balance
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/sinmetal/srunner/seed"
+)
+
+// UserAccountSeedDataset is 1 ~ userIDMax のUserAccountを作るDataset
+// Age, Height, Weight は runCreateUserAccount で作っていた時と同じ範囲の値にする
+func UserAccountSeedDataset(userIDMax int64) *seed.Dataset {
+	return &seed.Dataset{
+		Name:             "UserAccount",
+		Table:            "UserAccount",
+		Columns:          []string{"UserID", "Age", "Height", "Weight"},
+		TimestampColumns: []string{"CreatedAt", "UpdatedAt"},
+		Indexes:          2,
+		Start:            1,
+		End:              userIDMax + 1,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			return []interface{}{
+				CreateUserID(context.Background(), id),
+				int64(r.Intn(100)),
+				int64(50 + r.Intn(150)),
+				int64(30 + r.Intn(100)),
+			}
+		},
+	}
+}
+
+// UserBalanceSeedDataset is 1 ~ userIDMax のAmount, Pointが0のUserBalanceを作るDataset
+// DepositDMLはUserBalanceをUPDATEするだけなので、先に作っておかないと更新するRowがない
+func UserBalanceSeedDataset(userIDMax int64) *seed.Dataset {
+	return &seed.Dataset{
+		Name:             "UserBalance",
+		Table:            "UserBalance",
+		Columns:          []string{"UserID", "Amount", "Point"},
+		TimestampColumns: []string{"CreatedAt", "UpdatedAt"},
+		Start:            1,
+		End:              userIDMax + 1,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			return []interface{}{CreateUserID(context.Background(), id), int64(0), int64(0)}
+		},
+	}
+}
@@ -0,0 +1,45 @@
+package balance_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/internal/trace"
+	"github.com/sinmetal/srunner/seed"
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+func TestSeedDatasets(t *testing.T) {
+	ctx := context.Background()
+
+	trace.Init(ctx, "unit-test", "v0.0.0")
+
+	sCli := spannertest.Setup(t, "balance", "seed")
+	const userIDMax = 30
+	results, err := seed.Run(ctx, seed.NewSpannerTarget(sCli), []*seed.Dataset{
+		balance.UserAccountSeedDataset(userIDMax),
+		balance.UserBalanceSeedDataset(userIDMax),
+	}, seed.Options{ChunkSize: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range results {
+		if e, g := int64(userIDMax), v.Inserted; e != g {
+			t.Errorf("%s : want Inserted %d but got %d", v.Dataset, e, g)
+		}
+	}
+
+	s, err := balance.NewStore(ctx, sCli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userIDs := []string{balance.CreateUserID(ctx, 1), balance.CreateUserID(ctx, userIDMax)}
+	ubs, err := s.ReadUserBalances(ctx, userIDs, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := len(userIDs), len(ubs); e != g {
+		t.Errorf("want %d UserBalance but got %d", e, g)
+	}
+}
@@ -0,0 +1,348 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultVerifyParallelism is VerifyOptionsでParallelismを指定しなかった場合の並列数
+	DefaultVerifyParallelism = 16
+
+	// DefaultVerifyChunkSize is VerifyOptionsでChunkSizeを指定しなかった場合の1回でscanするUser数
+	DefaultVerifyChunkSize = 10000
+)
+
+// FindingKind is Verifyで見つかった不整合の種類
+type FindingKind string
+
+const (
+	// FindingMismatch is UserBalanceのAmount, PointとUserDepositHistoryの合計が一致しない
+	FindingMismatch FindingKind = "mismatch"
+
+	// FindingMissingBalance is UserDepositHistoryがあるのにUserBalanceがない
+	// DepositDMLはUserBalanceがない場合にUPDATEが0件になるので、このFindingになる
+	FindingMissingBalance FindingKind = "missing_balance"
+
+	// FindingOrphanHistory is UserAccountがないUserのUserDepositHistory
+	FindingOrphanHistory FindingKind = "orphan_history"
+)
+
+// BalanceFinding is Verifyで見つかった1 User分の不整合
+type BalanceFinding struct {
+	Kind          FindingKind
+	UserID        string
+	BalanceAmount int64
+	BalancePoint  int64
+	HistoryAmount int64
+	HistoryPoint  int64
+	HistoryCount  int64
+}
+
+// VerifyOptions is Verifyの設定
+type VerifyOptions struct {
+	// Parallelism is 同時にscanするUser IDの範囲の数
+	Parallelism int
+
+	// ChunkSize is 1回でscanするUser数
+	ChunkSize int64
+
+	// UserIDMin, UserIDMax is scanするUser IDの範囲. CreateUserIDに渡すid
+	// UserIDMaxを指定しなかった場合はUserAccountIDMax()を使う
+	UserIDMin int64
+	UserIDMax int64
+}
+
+func (o *VerifyOptions) setDefaults() {
+	if o.Parallelism < 1 {
+		o.Parallelism = DefaultVerifyParallelism
+	}
+	if o.ChunkSize < 1 {
+		o.ChunkSize = DefaultVerifyChunkSize
+	}
+	if o.UserIDMin < 1 {
+		o.UserIDMin = 1
+	}
+	if o.UserIDMax < 1 {
+		o.UserIDMax = UserAccountIDMax()
+	}
+}
+
+// Verifier is Store と StoreAlloy
+type Verifier interface {
+	Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error)
+}
+
+// VerifyAndWrite is verifierでUserBalanceとUserDepositHistoryの整合性を確認して、VerifyReportをwに書き出す
+// cmd/serverで負荷をかけ終わった後に使う. Findingは100件まで書き出す. 不整合が見つからなければtrueを返す
+func VerifyAndWrite(ctx context.Context, verifier Verifier, w io.Writer) bool {
+	fmt.Fprintln(w, "start verify balance")
+	report, err := verifier.Verify(ctx, VerifyOptions{})
+	if err != nil {
+		fmt.Fprintf(w, "failed verify balance err=%s\n", err)
+		return false
+	}
+	if err := report.Write(w, 100); err != nil {
+		fmt.Fprintf(w, "failed write verify report err=%s\n", err)
+	}
+	return report.OK()
+}
+
+// VerifyReport is Verifyの結果
+type VerifyReport struct {
+	// Snapshot is scanしたsnapshot. Spannerの場合はread timestamp, AlloyDBの場合はsnapshot id
+	Snapshot string
+
+	CheckedUsers     int64
+	CheckedHistories int64
+	Findings         []*BalanceFinding
+	Elapsed          time.Duration
+}
+
+// OK is 不整合が見つからなかったかどうか
+func (r *VerifyReport) OK() bool {
+	return len(r.Findings) == 0
+}
+
+// Count is kindのFindingの数を返す
+func (r *VerifyReport) Count(kind FindingKind) int {
+	var ret int
+	for _, v := range r.Findings {
+		if v.Kind == kind {
+			ret++
+		}
+	}
+	return ret
+}
+
+// Write is VerifyReportをwに書き出す
+// Findingはlimit件まで書き出す. limitが0以下の場合はすべて書き出す
+func (r *VerifyReport) Write(w io.Writer, limit int) error {
+	_, err := fmt.Fprintf(w, "snapshot=%s users=%d histories=%d elapsed=%s mismatch=%d missing_balance=%d orphan_history=%d\n",
+		r.Snapshot, r.CheckedUsers, r.CheckedHistories, r.Elapsed.Round(time.Millisecond),
+		r.Count(FindingMismatch), r.Count(FindingMissingBalance), r.Count(FindingOrphanHistory))
+	if err != nil {
+		return err
+	}
+	if r.OK() {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Kind\tUserID\tBalanceAmount\tBalancePoint\tHistoryAmount\tHistoryPoint\tHistoryCount\t"); err != nil {
+		return err
+	}
+	for i, v := range r.Findings {
+		if limit > 0 && i >= limit {
+			break
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t\n",
+			v.Kind, v.UserID, v.BalanceAmount, v.BalancePoint, v.HistoryAmount, v.HistoryPoint, v.HistoryCount)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// userRangeSnapshot is User IDの範囲をscanした結果
+type userRangeSnapshot struct {
+	balances map[string]*UserBalance
+	sums     map[string]*UserDepositHistorySum
+	accounts map[string]bool
+}
+
+func newUserRangeSnapshot() *userRangeSnapshot {
+	return &userRangeSnapshot{
+		balances: make(map[string]*UserBalance),
+		sums:     make(map[string]*UserDepositHistorySum),
+		accounts: make(map[string]bool),
+	}
+}
+
+// verify is UserBalanceとUserDepositHistoryの合計を突き合わせる
+func (s *userRangeSnapshot) verify() (findings []*BalanceFinding, users int64, histories int64) {
+	userIDs := make(map[string]bool)
+	for userID := range s.balances {
+		userIDs[userID] = true
+	}
+	for userID, sum := range s.sums {
+		userIDs[userID] = true
+		histories += sum.Count
+	}
+
+	for userID := range userIDs {
+		b, hasBalance := s.balances[userID]
+		sum, hasHistory := s.sums[userID]
+		f := &BalanceFinding{UserID: userID}
+		if hasBalance {
+			f.BalanceAmount = b.Amount
+			f.BalancePoint = b.Point
+		}
+		if hasHistory {
+			f.HistoryAmount = sum.Amount
+			f.HistoryPoint = sum.Point
+			f.HistoryCount = sum.Count
+		}
+
+		switch {
+		case hasHistory && !s.accounts[userID]:
+			f.Kind = FindingOrphanHistory
+		case hasHistory && !hasBalance:
+			f.Kind = FindingMissingBalance
+		case f.BalanceAmount != f.HistoryAmount || f.BalancePoint != f.HistoryPoint:
+			f.Kind = FindingMismatch
+		default:
+			continue
+		}
+		findings = append(findings, f)
+	}
+	return findings, int64(len(userIDs)), histories
+}
+
+// userRangeReader is User IDの範囲 [start, end) を同じsnapshotでscanする
+type userRangeReader interface {
+	readUserRange(ctx context.Context, start string, end string) (*userRangeSnapshot, error)
+}
+
+// verifyUserRanges is VerifyOptionsのUser IDの範囲をChunkSizeごとに分けて、並列にscanして突き合わせる
+func verifyUserRanges(ctx context.Context, reader userRangeReader, opts VerifyOptions) (*VerifyReport, error) {
+	opts.setDefaults()
+	start := time.Now()
+
+	var mu sync.Mutex
+	report := &VerifyReport{}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(opts.Parallelism)
+	for lo := opts.UserIDMin; lo <= opts.UserIDMax; lo += opts.ChunkSize {
+		hi := lo + opts.ChunkSize
+		if hi > opts.UserIDMax+1 {
+			hi = opts.UserIDMax + 1
+		}
+		startUserID := CreateUserID(ctx, lo)
+		endUserID := CreateUserID(ctx, hi)
+		eg.Go(func() error {
+			snapshot, err := reader.readUserRange(ctx, startUserID, endUserID)
+			if err != nil {
+				return fmt.Errorf("failed verify user range %s-%s : %w", startUserID, endUserID, err)
+			}
+			findings, users, histories := snapshot.verify()
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Findings = append(report.Findings, findings...)
+			report.CheckedUsers += users
+			report.CheckedHistories += histories
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		return report.Findings[i].UserID < report.Findings[j].UserID
+	})
+	report.Elapsed = time.Since(start)
+	return report, nil
+}
+
+// spannerUserRangeReader is 同じread timestampでUserBalance, UserDepositHistory, UserAccountをscanする
+type spannerUserRangeReader struct {
+	store *Store
+	ts    time.Time
+}
+
+// Verify is UserBalanceのAmount, PointがUserDepositHistoryの合計と一致しているかを確認する
+// すべてのUser IDの範囲を同じread timestampでscanするので、負荷をかけている最中でも実行できる
+func (s *Store) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	ts, err := s.readTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report, err := verifyUserRanges(ctx, &spannerUserRangeReader{store: s, ts: ts}, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Snapshot = ts.Format(time.RFC3339Nano)
+	return report, nil
+}
+
+// readTimestamp is strong readを1回行って、その時のread timestampを返す
+func (s *Store) readTimestamp(ctx context.Context) (time.Time, error) {
+	ro := s.sc.ReadOnlyTransaction()
+	defer ro.Close()
+
+	iter := ro.Query(ctx, spanner.NewStatement("SELECT 1"))
+	if err := iter.Do(func(row *spanner.Row) error { return nil }); err != nil {
+		return time.Time{}, fmt.Errorf("failed read timestamp : %w", err)
+	}
+	ts, err := ro.Timestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed read timestamp : %w", err)
+	}
+	return ts, nil
+}
+
+func (r *spannerUserRangeReader) readUserRange(ctx context.Context, start string, end string) (*userRangeSnapshot, error) {
+	ro := r.store.sc.ReadOnlyTransaction().WithTimestampBound(spanner.ReadTimestamp(r.ts))
+	defer ro.Close()
+
+	params := map[string]interface{}{
+		"Start": start,
+		"End":   end,
+	}
+	ret := newUserRangeSnapshot()
+
+	stm := spanner.NewStatement(fmt.Sprintf("SELECT UserID, Amount, Point FROM %s WHERE UserID >= @Start AND UserID < @End", r.store.UserBalanceTable()))
+	stm.Params = params
+	err := ro.Query(ctx, stm).Do(func(row *spanner.Row) error {
+		var v UserBalance
+		if err := row.ToStruct(&v); err != nil {
+			return err
+		}
+		ret.balances[v.UserID] = &v
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed read UserBalance : %w", err)
+	}
+
+	stm = spanner.NewStatement(fmt.Sprintf("SELECT UserID, SUM(Amount) AS Amount, SUM(Point) AS Point, COUNT(*) AS Count FROM %s WHERE UserID >= @Start AND UserID < @End GROUP BY UserID", r.store.UserDepositHistoryTable()))
+	stm.Params = params
+	err = ro.Query(ctx, stm).Do(func(row *spanner.Row) error {
+		var v UserDepositHistorySum
+		if err := row.Columns(&v.UserID, &v.Amount, &v.Point, &v.Count); err != nil {
+			return err
+		}
+		ret.sums[v.UserID] = &v
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed read UserDepositHistory : %w", err)
+	}
+
+	stm = spanner.NewStatement(fmt.Sprintf("SELECT UserID FROM %s WHERE UserID >= @Start AND UserID < @End", r.store.UserAccountTable()))
+	stm.Params = params
+	err = ro.Query(ctx, stm).Do(func(row *spanner.Row) error {
+		var userID string
+		if err := row.Columns(&userID); err != nil {
+			return err
+		}
+		ret.accounts[userID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed read UserAccount : %w", err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,127 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// snapshotIDPattern is pg_export_snapshot()が返すsnapshot idのformat
+// SET TRANSACTION SNAPSHOT にはparameterを使えないので、埋め込む前に確認する
+var snapshotIDPattern = regexp.MustCompile(`^[0-9A-Fa-f]+-[0-9A-Fa-f]+(-[0-9A-Fa-f]+)?$`)
+
+// alloyUserRangeReader is pg_export_snapshot()でexportしたsnapshotを使ってscanする
+type alloyUserRangeReader struct {
+	store      *StoreAlloy
+	snapshotID string
+}
+
+// Verify is UserBalanceのAmount, PointがUserDepositHistoryの合計と一致しているかを確認する
+// primary instanceでexportしたsnapshotをすべてのworkerで共有するので、負荷をかけている最中でも実行できる
+func (s *StoreAlloy) Verify(ctx context.Context, opts VerifyOptions) (report *VerifyReport, err error) {
+	// snapshotをexportしたtxはscanが終わるまで開いておく必要がある
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err2 := tx.Rollback(ctx); err2 != nil && !errors.Is(err2, pgx.ErrTxClosed) && err == nil {
+			err = fmt.Errorf("rollback export snapshot tx: %w", err2)
+		}
+	}()
+
+	var snapshotID string
+	if err := tx.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&snapshotID); err != nil {
+		return nil, fmt.Errorf("export snapshot: %w", err)
+	}
+	if !snapshotIDPattern.MatchString(snapshotID) {
+		return nil, fmt.Errorf("invalid snapshot id %s", snapshotID)
+	}
+
+	report, err = verifyUserRanges(ctx, &alloyUserRangeReader{store: s, snapshotID: snapshotID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.Snapshot = snapshotID
+	return report, nil
+}
+
+func (r *alloyUserRangeReader) readUserRange(ctx context.Context, start string, end string) (ret *userRangeSnapshot, err error) {
+	tx, err := r.store.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err2 := tx.Rollback(ctx); err2 != nil && !errors.Is(err2, pgx.ErrTxClosed) && err == nil {
+			err = fmt.Errorf("rollback verify tx: %w", err2)
+		}
+	}()
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", r.snapshotID)); err != nil {
+		return nil, fmt.Errorf("set transaction snapshot: %w", err)
+	}
+
+	ret = newUserRangeSnapshot()
+	err = queryUserRange(ctx, tx, fmt.Sprintf("SELECT UserID, Amount, Point FROM %s WHERE UserID >= $1 AND UserID < $2", r.store.UserBalanceTable()),
+		start, end, func(rows pgx.Rows) error {
+			var v UserBalance
+			if err := rows.Scan(&v.UserID, &v.Amount, &v.Point); err != nil {
+				return err
+			}
+			ret.balances[v.UserID] = &v
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("read user balance: %w", err)
+	}
+
+	err = queryUserRange(ctx, tx, fmt.Sprintf("SELECT UserID, SUM(Amount)::bigint, SUM(Point)::bigint, COUNT(*) FROM %s WHERE UserID >= $1 AND UserID < $2 GROUP BY UserID", r.store.UserDepositHistoryTable()),
+		start, end, func(rows pgx.Rows) error {
+			var v UserDepositHistorySum
+			if err := rows.Scan(&v.UserID, &v.Amount, &v.Point, &v.Count); err != nil {
+				return err
+			}
+			ret.sums[v.UserID] = &v
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("read user deposit history: %w", err)
+	}
+
+	err = queryUserRange(ctx, tx, fmt.Sprintf("SELECT UserID FROM %s WHERE UserID >= $1 AND UserID < $2", r.store.UserAccountTable()),
+		start, end, func(rows pgx.Rows) error {
+			var userID string
+			if err := rows.Scan(&userID); err != nil {
+				return err
+			}
+			ret.accounts[userID] = true
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("read user account: %w", err)
+	}
+	return ret, nil
+}
+
+// queryUserRange is [start, end) を条件にqueryを実行して、1行ごとにfを呼ぶ
+func queryUserRange(ctx context.Context, tx pgx.Tx, sql string, start string, end string, f func(rows pgx.Rows) error) error {
+	rows, err := tx.Query(ctx, sql, start, end)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,163 @@
+package balance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeUserRangeReader is memory上のdataから範囲を切り出して返す
+type fakeUserRangeReader struct {
+	data *userRangeSnapshot
+}
+
+func (r *fakeUserRangeReader) readUserRange(ctx context.Context, start string, end string) (*userRangeSnapshot, error) {
+	ret := newUserRangeSnapshot()
+	in := func(userID string) bool {
+		return userID >= start && userID < end
+	}
+	for k, v := range r.data.balances {
+		if in(k) {
+			ret.balances[k] = v
+		}
+	}
+	for k, v := range r.data.sums {
+		if in(k) {
+			ret.sums[k] = v
+		}
+	}
+	for k, v := range r.data.accounts {
+		if in(k) {
+			ret.accounts[k] = v
+		}
+	}
+	return ret, nil
+}
+
+func TestVerifyUserRanges(t *testing.T) {
+	ctx := context.Background()
+
+	data := newUserRangeSnapshot()
+	add := func(id int64, account bool, balance *UserBalance, sum *UserDepositHistorySum) {
+		userID := CreateUserID(ctx, id)
+		if account {
+			data.accounts[userID] = true
+		}
+		if balance != nil {
+			balance.UserID = userID
+			data.balances[userID] = balance
+		}
+		if sum != nil {
+			sum.UserID = userID
+			data.sums[userID] = sum
+		}
+	}
+	// 一致している
+	add(1, true, &UserBalance{Amount: 100, Point: 10}, &UserDepositHistorySum{Amount: 100, Point: 10, Count: 2})
+	// まだDepositしていない
+	add(2, true, &UserBalance{}, nil)
+	add(3, true, nil, nil)
+	// 一致していない
+	add(15, true, &UserBalance{Amount: 100, Point: 10}, &UserDepositHistorySum{Amount: 90, Point: 10, Count: 1})
+	// Historyがないのに残高がある
+	add(16, true, &UserBalance{Amount: 100}, nil)
+	// DepositDMLでUserBalanceがない
+	add(27, true, nil, &UserDepositHistorySum{Amount: 50, Count: 1})
+	// UserAccountがない
+	add(28, false, &UserBalance{Amount: 50}, &UserDepositHistorySum{Amount: 50, Count: 1})
+	// 範囲外
+	add(31, true, &UserBalance{Amount: 1}, nil)
+
+	report, err := verifyUserRanges(ctx, &fakeUserRangeReader{data: data}, VerifyOptions{
+		Parallelism: 2,
+		ChunkSize:   7,
+		UserIDMax:   30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e, g := int64(6), report.CheckedUsers; e != g {
+		t.Errorf("want CheckedUsers %d but got %d", e, g)
+	}
+	if e, g := int64(5), report.CheckedHistories; e != g {
+		t.Errorf("want CheckedHistories %d but got %d", e, g)
+	}
+	want := []struct {
+		userID string
+		kind   FindingKind
+	}{
+		{CreateUserID(ctx, 15), FindingMismatch},
+		{CreateUserID(ctx, 16), FindingMismatch},
+		{CreateUserID(ctx, 27), FindingMissingBalance},
+		{CreateUserID(ctx, 28), FindingOrphanHistory},
+	}
+	if e, g := len(want), len(report.Findings); e != g {
+		t.Fatalf("want %d findings but got %d", e, g)
+	}
+	for i, w := range want {
+		got := report.Findings[i]
+		if e, g := w.userID, got.UserID; e != g {
+			t.Errorf("want UserID %s but got %s", e, g)
+		}
+		if e, g := w.kind, got.Kind; e != g {
+			t.Errorf("%s : want Kind %s but got %s", w.userID, e, g)
+		}
+	}
+	if report.OK() {
+		t.Errorf("want not OK")
+	}
+	if e, g := 2, report.Count(FindingMismatch); e != g {
+		t.Errorf("want mismatch %d but got %d", e, g)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf, 1); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if e, g := 3, len(lines); e != g {
+		t.Errorf("want %d lines but got %d\n%s", e, g, buf.String())
+	}
+}
+
+// fakeVerifier is 決まったVerifyReportかerrorを返すVerifier
+type fakeVerifier struct {
+	report *VerifyReport
+	err    error
+}
+
+func (v *fakeVerifier) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	return v.report, v.err
+}
+
+func TestVerifyAndWrite(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if !VerifyAndWrite(ctx, &fakeVerifier{report: &VerifyReport{CheckedUsers: 10}}, &buf) {
+		t.Errorf("want ok")
+	}
+	if !strings.Contains(buf.String(), "users=10") {
+		t.Errorf("want report but got %s", buf.String())
+	}
+
+	buf.Reset()
+	report := &VerifyReport{Findings: []*BalanceFinding{{Kind: FindingMismatch, UserID: "u0000000001"}}}
+	if VerifyAndWrite(ctx, &fakeVerifier{report: report}, &buf) {
+		t.Errorf("want not ok")
+	}
+	if !strings.Contains(buf.String(), "u0000000001") {
+		t.Errorf("want finding but got %s", buf.String())
+	}
+
+	buf.Reset()
+	if VerifyAndWrite(ctx, &fakeVerifier{err: errors.New("unavailable")}, &buf) {
+		t.Errorf("want not ok")
+	}
+	if !strings.Contains(buf.String(), "failed verify balance err=unavailable") {
+		t.Errorf("want error but got %s", buf.String())
+	}
+}
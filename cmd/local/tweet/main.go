@@ -23,20 +23,24 @@ func main() {
 		panic(err)
 	}
 
+	seed := time.Now().UnixNano()
+	fmt.Printf("seed=%d\n", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
 	ts := tweet.NewStore(sc)
 	for {
 		ctx := context.Background()
 		id := uuid.New().String()
 		now := time.Now()
-		author := randdata.GetAuthor()
-		favos := randdata.GetAuthors()
+		author := randdata.GetAuthor(rnd)
+		favos := randdata.GetAuthors(rnd)
 		fmt.Printf("INSERT %s %s(%s)\n", now, author, id)
 		_, err := ts.Insert(ctx, &tweet.Tweet{
 			TweetID:       id,
 			Author:        author,
 			Content:       fmt.Sprintf("Hello. My name is %s. %s (%s*%s*%s)", author, now, uuid.New().String(), uuid.New().String(), uuid.New().String()),
 			Favos:         favos,
-			Sort:          rand.Int63(),
+			Sort:          rnd.Int63(),
 			CreatedAt:     now,
 			UpdatedAt:     now,
 			CommitedAt:    spanner.CommitTimestamp,
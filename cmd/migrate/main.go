@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetal/srunner/ddl"
+	"github.com/sinmetal/srunner/internal/alloy"
+	"github.com/sinmetal/srunner/migrate"
+)
+
+// ddl/*.sql, ddl/alloy/*.sql を適用する
+// ddlにはFKで他のTableに依存するfileや、同じTableを別の定義で作るfileがあるので、-sets で適用するfileを依存する順番に指定する
+//
+//	go run ./cmd/migrate -backend spanner -sets balance,operation -dry-run
+//	go run ./cmd/migrate -backend spanner -sets balance,operation
+//	go run ./cmd/migrate -backend postgres -sets balance,operation
+//
+// Spannerの接続先は $SRUNNER_SPANNER_PROJECT_ID, $SRUNNER_SPANNER_INSTANCE_ID, $SRUNNER_SPANNER_DATABASE_ID で指定する
+// $SPANNER_EMULATOR_HOST が指定されている場合はEmulatorに適用する
+// PostgreSQL, AlloyDBの接続先は cmd/server/alloy と同じ環境変数で指定する
+func main() {
+	ctx := context.Background()
+
+	backend := flag.String("backend", "spanner", "spanner, postgres or alloydb")
+	dir := flag.String("dir", "", "directory of ddl files. default is ddl for spanner, ddl/alloy for postgres")
+	sets := flag.String("sets", "", "required. comma separated ddl file names without .sql, in dependency order. e.g. user,item_master,item_order")
+	dryRun := flag.Bool("dry-run", false, "print pending statements without applying them")
+	baseline := flag.Bool("baseline", false, "record pending statements as applied without applying them")
+	flag.Parse()
+	if strings.TrimSpace(*sets) == "" {
+		fmt.Println("-sets is required. e.g. -sets balance,operation")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var target migrate.Target
+	defaultDir := "ddl"
+	dialect := ddl.GoogleSQL
+	switch *backend {
+	case "spanner":
+		dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s",
+			os.Getenv("SRUNNER_SPANNER_PROJECT_ID"), os.Getenv("SRUNNER_SPANNER_INSTANCE_ID"), os.Getenv("SRUNNER_SPANNER_DATABASE_ID"))
+		fmt.Println(dbName)
+		t, err := migrate.NewSpannerTarget(ctx, dbName)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			if err := t.Close(); err != nil {
+				fmt.Printf("failed close : %s\n", err)
+			}
+		}()
+		target = t
+	case "postgres", "alloydb":
+		defaultDir = filepath.Join("ddl", "alloy")
+		dialect = ddl.PostgreSQL
+		connectOpts, err := alloy.ConnectOptionsFromEnv()
+		if err != nil {
+			panic(err)
+		}
+		if connectOpts.DSN == "" && connectOpts.Database == "" {
+			connectOpts.Database = "quickstart_db"
+		}
+		fmt.Println(connectOpts.Name())
+		pool, cleanup, err := alloy.Connect(ctx, connectOpts)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			pool.Close()
+			if err := cleanup(); err != nil {
+				fmt.Printf("failed cleanup : %s\n", err)
+			}
+		}()
+		target = migrate.NewPostgresTarget(pool)
+	default:
+		panic(fmt.Sprintf("unsupported backend %s", *backend))
+	}
+	if *dir == "" {
+		*dir = defaultDir
+	}
+
+	files, err := ddlFiles(*dir, *sets)
+	if err != nil {
+		panic(err)
+	}
+	stmts, err := migrate.LoadStatements(dialect, files...)
+	if err != nil {
+		panic(err)
+	}
+	plan, err := migrate.Run(ctx, target, stmts, migrate.Options{
+		DryRun:   *dryRun,
+		Baseline: *baseline,
+	})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := plan.Write(os.Stdout); err != nil {
+		panic(err)
+	}
+	switch {
+	case plan.Empty():
+	case *dryRun:
+		fmt.Println("dry run. nothing applied")
+	case *baseline:
+		fmt.Printf("recorded %d statements as applied\n", len(plan.Pending))
+	default:
+		fmt.Printf("applied %d statements\n", len(plan.Pending))
+	}
+}
+
+// ddlFiles is setsをdir内のfileにする. fileはsetsの順番に並ぶ
+func ddlFiles(dir string, sets string) ([]string, error) {
+	var files []string
+	for _, set := range strings.Split(sets, ",") {
+		set = strings.TrimSuffix(strings.TrimSpace(set), ".sql")
+		if set == "" {
+			continue
+		}
+		fn := filepath.Join(dir, set+".sql")
+		if _, err := os.Stat(fn); err != nil {
+			return nil, fmt.Errorf("invalid ddl set %s : %w", set, err)
+		}
+		files = append(files, fn)
+	}
+	return files, nil
+}
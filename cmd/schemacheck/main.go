@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/item"
+	"github.com/sinmetal/srunner/schemacheck"
+	"github.com/sinmetal/srunner/score"
+	"github.com/sinmetal/srunner/tweet"
+)
+
+// rows is structとTableの組み合わせ
+var rows = []struct {
+	table string
+	v     interface{}
+}{
+	{"Tweets", tweet.Tweet{}},
+	{"UserAccount", balance.UserAccount{}},
+	{"UserBalance", balance.UserBalance{}},
+	{"UserDepositHistory", balance.UserDepositHistory{}},
+	{"UserDepositHistorySum", balance.UserDepositHistorySum{}},
+	{"Score", score.Score{}},
+	{"ScoreUser", score.ScoreUser{}},
+	{"ItemMaster", item.ItemMaster{}},
+	{"ItemOrder", item.ItemOrder{}},
+	{"ItemOrderDummyFK", item.ItemOrderDummyFK{}},
+	{"ItemOrderNoFK", item.ItemOrderNOFK{}},
+	{"User", item.User{}},
+}
+
+// ddl/*.sql と、structやstoreのSQLのずれを確認する
+//
+//	go run ./cmd/schemacheck
+//	go run ./cmd/schemacheck -packages tweet -warnings
+//
+// repositoryのrootで実行する. Errorがある場合は exit code 1 で終了する
+func main() {
+	dir := flag.String("dir", "ddl", "directory of spanner ddl files")
+	packages := flag.String("packages", "balance,item,lock_try,operation,score,tweet", "comma separated package directories to check")
+	warnings := flag.Bool("warnings", false, "print warnings")
+	flag.Parse()
+
+	files, err := filepath.Glob(filepath.Join(*dir, "*.sql"))
+	if err != nil {
+		panic(err)
+	}
+	s, err := schemacheck.LoadSchema(files...)
+	if err != nil {
+		panic(err)
+	}
+
+	var issues []*schemacheck.Issue
+	for _, row := range rows {
+		issues = append(issues, schemacheck.CheckStruct(s, row.table, row.v)...)
+	}
+	for _, pkg := range strings.Split(*packages, ",") {
+		v, err := schemacheck.CheckPackage(s, pkg)
+		if err != nil {
+			panic(err)
+		}
+		issues = append(issues, v...)
+	}
+
+	var errCount int
+	for _, issue := range issues {
+		if !issue.Warning() {
+			errCount++
+		} else if !*warnings {
+			continue
+		}
+		fmt.Println(issue)
+	}
+	fmt.Printf("errors=%d warnings=%d\n", errCount, len(issues)-errCount)
+	if errCount > 0 {
+		os.Exit(1)
+	}
+}
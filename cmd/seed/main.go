@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
+	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/internal/alloy"
+	"github.com/sinmetal/srunner/item"
+	"github.com/sinmetal/srunner/score"
+	"github.com/sinmetal/srunner/seed"
+)
+
+// 負荷をかける前に、RunnerがaccessするRowを作る
+//
+//	go run ./cmd/seed -backend spanner -datasets UserAccount,UserBalance
+//	go run ./cmd/seed -backend spanner -datasets ItemMaster -items 100000 -parallelism 32
+//	go run ./cmd/seed -backend postgres
+//
+// 書き込んだ範囲は SeedProgress Tableに記録するので、中断しても同じコマンドを再実行すると続きから再開する
+// SeedProgressは cmd/migrate の -sets seed で作る
+// UserAccount, UserBalanceのUserIDの最大値は cmd/server と同じく $SRUNNER_USER_MAX で指定する
+// 接続先は cmd/migrate と同じ環境変数で指定する
+//
+// 複数のpodで分担する場合は -shard-index, -shard-count を指定する. 指定しない場合は srunner.ShardFromEnv の環境変数
+// (StatefulSetのpod ordinalなど) を使う. podごとにIDの範囲が分かれるので、AlreadyExistsで衝突しない
+//
+//	go run ./cmd/seed -datasets UserAccount,UserBalance -shard-index 0 -shard-count 4
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := flag.String("backend", "spanner", "spanner, postgres or alloydb")
+	datasetNames := flag.String("datasets", "", "comma separated datasets. UserAccount, UserBalance, ItemMaster, Score. default is all datasets supported by backend")
+	chunkSize := flag.Int64("chunk-size", seed.DefaultChunkSize, "rows per transaction. spanner uses smaller size if it exceeds the mutation limit")
+	parallelism := flag.Int("parallelism", seed.DefaultParallelism, "number of chunks written concurrently")
+	seedValue := flag.Int64("seed", 1, "seed of generated values")
+	items := flag.Int64("items", 0, "number of ItemMaster rows. default is all ids picked by runners")
+	scores := flag.Int64("scores", 0, "number of Score rows. default is all ids picked by runners")
+	shardIndex := flag.Int("shard-index", 0, "index of the id range written by this process. 0 ~ shard-count-1")
+	shardCount := flag.Int("shard-count", 0, "number of processes sharing the id range. default is $SRUNNER_SHARD_COUNT")
+	flag.Parse()
+
+	shard := srunner.Shard{Index: *shardIndex, Count: *shardCount}
+	if *shardCount == 0 {
+		var err error
+		shard, err = srunner.ShardFromEnv()
+		if err != nil {
+			panic(err)
+		}
+	}
+	if err := shard.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("shard=%s\n", shard)
+
+	if v := os.Getenv("SRUNNER_USER_MAX"); v != "" {
+		userMax, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("failed parse $SRUNNER_USER_MAX = %s : %w", v, err))
+		}
+		balance.SetUserAccountIDMax(userMax)
+	}
+
+	all := []*seed.Dataset{
+		balance.UserAccountSeedDataset(balance.UserAccountIDMax()),
+		balance.UserBalanceSeedDataset(balance.UserAccountIDMax()),
+		item.ItemMasterSeedDataset(*items),
+		score.ScoreSeedDataset(*scores),
+	}
+
+	var target seed.Target
+	postgres := false
+	switch *backend {
+	case "spanner":
+		dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s",
+			os.Getenv("SRUNNER_SPANNER_PROJECT_ID"), os.Getenv("SRUNNER_SPANNER_INSTANCE_ID"), os.Getenv("SRUNNER_SPANNER_DATABASE_ID"))
+		fmt.Println(dbName)
+		sc, err := spanner.NewClient(ctx, dbName)
+		if err != nil {
+			panic(err)
+		}
+		defer sc.Close()
+		target = seed.NewSpannerTarget(sc)
+	case "postgres", "alloydb":
+		postgres = true
+		connectOpts, err := alloy.ConnectOptionsFromEnv()
+		if err != nil {
+			panic(err)
+		}
+		if connectOpts.DSN == "" && connectOpts.Database == "" {
+			connectOpts.Database = "quickstart_db"
+		}
+		fmt.Println(connectOpts.Name())
+		pool, cleanup, err := alloy.Connect(ctx, connectOpts)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			pool.Close()
+			if err := cleanup(); err != nil {
+				fmt.Printf("failed cleanup : %s\n", err)
+			}
+		}()
+		target = seed.NewPostgresTarget(pool)
+	default:
+		panic(fmt.Sprintf("unsupported backend %s", *backend))
+	}
+
+	datasets, err := selectDatasets(all, *datasetNames, postgres)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Ctrl+Cで止めても、書き込み済みのchunkは次の実行でskipする
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalChan
+		fmt.Println("interrupted. rerun to resume")
+		cancel()
+	}()
+
+	results, err := seed.Run(ctx, target, datasets, seed.Options{
+		ChunkSize:   *chunkSize,
+		Parallelism: *parallelism,
+		Seed:        *seedValue,
+		Progress:    os.Stdout,
+		Shard:       shard,
+	})
+	if err := seed.WriteResults(os.Stdout, results); err != nil {
+		fmt.Printf("failed WriteResults : %s\n", err)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// selectDatasets is namesのDatasetを指定した順番で返す. namesが空の場合はbackendで使えるすべてのDataset
+func selectDatasets(all []*seed.Dataset, names string, postgres bool) ([]*seed.Dataset, error) {
+	m := make(map[string]*seed.Dataset)
+	for _, ds := range all {
+		m[ds.Name] = ds
+	}
+
+	var ret []*seed.Dataset
+	if names == "" {
+		for _, ds := range all {
+			if postgres && ds.SpannerOnly {
+				continue
+			}
+			ret = append(ret, ds)
+		}
+		return ret, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		ds, ok := m[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown dataset %s", name)
+		}
+		if postgres && ds.SpannerOnly {
+			return nil, fmt.Errorf("dataset %s is not supported on postgres", ds.Name)
+		}
+		ret = append(ret, ds)
+	}
+	return ret, nil
+}
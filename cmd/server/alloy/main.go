@@ -3,13 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
-	"github.com/sinmetal/srunner/operation"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/balance"
 	"github.com/sinmetal/srunner/internal/alloy"
@@ -26,7 +26,8 @@ const (
 // GRANT SELECT ON UserBalance TO "gke-worker-default@{PROJECT_ID}.iam";
 // https://cloud.google.com/alloydb/docs/manage-iam-authn#gcloud_1
 func main() {
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	fmt.Println("ignite")
 
@@ -34,30 +35,89 @@ func main() {
 	// SIGTERM handles Cloud Run termination signal.
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	runner := os.Getenv("RUNNER")
-	fmt.Printf("runner:%s\n", runner)
-	if runner == "" {
+	scenario, err := loadScenario()
+	if err != nil {
+		panic(err)
+	}
+	// scenarioのfileでbackendを省略するとspannerになるので、AlloyDB以外のscenarioで起動しないようにする
+	if scenario.Target.Backend != srunner.BackendAlloyDB {
+		panic(fmt.Sprintf("scenario target.backend is %s but this server runs %s. set target.backend: %s", scenario.Target.Backend, srunner.BackendAlloyDB, srunner.BackendAlloyDB))
+	}
+	if len(scenario.Runners) < 1 {
 		panic("runner is empty")
 	}
+	if err := scenario.Validate(); err != nil {
+		panic(err)
+	}
 
-	user := os.Getenv("USER")
-	fmt.Printf("user:%s\n", user)
+	// $SRUNNER_CONTROL_ADDR が指定されている場合は、実行中のRunnerをHTTPで操作できるようにする
+	// /metrics でPrometheusのformatのmetricsも返す
+	// POST, PATCHには $SRUNNER_CONTROL_TOKEN が必要. 指定していない場合はloopbackからだけ操作できる
+	controlServer := srunner.NewControlServer(ctx, scenario)
+	controlServer.SetToken(os.Getenv("SRUNNER_CONTROL_TOKEN"))
+	var controlHTTPServer *http.Server
+	if addr := os.Getenv("SRUNNER_CONTROL_ADDR"); addr != "" {
+		controlHTTPServer = controlServer.ListenAndServe(addr)
+	}
 
-	// "projects/{PROJECT_ID}/locations/asia-northeast1/clusters/playground/instances/playground-primary"
-	instanceName := os.Getenv("INSTANCE_NAME")
-	if instanceName == "" {
-		panic("instance name is empty")
+	// $DATABASE_URL が指定されている場合は、AlloyDBではなく普通のPostgreSQLに接続する
+	connectOpts, err := alloy.ConnectOptionsFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	if scenario.Target.Database != "" {
+		connectOpts.Database = scenario.Target.Database
 	}
-	fmt.Printf("instance name:%s\n", instanceName)
+	var readReplicaConnectOpts []*alloy.ConnectOptions
+	if connectOpts.DSN != "" {
+		fmt.Println("connect postgres with DATABASE_URL")
+		// $READ_REPLICA_DATABASE_URL にはカンマ区切りで複数のDSNを指定できる
+		for _, dsn := range splitList(os.Getenv("READ_REPLICA_DATABASE_URL")) {
+			replicaOpts := *connectOpts
+			replicaOpts.DSN = dsn
+			readReplicaConnectOpts = append(readReplicaConnectOpts, &replicaOpts)
+		}
+	} else {
+		fmt.Printf("user:%s\n", connectOpts.User)
 
-	readReplicaInstanceName := os.Getenv("READ_REPLICA_INSTANCE_NAME")
-	fmt.Printf("read replica instance name:%s\n", readReplicaInstanceName)
+		// "projects/{PROJECT_ID}/locations/asia-northeast1/clusters/playground/instances/playground-primary"
+		if scenario.Target.Instance != "" {
+			connectOpts.InstanceURI = scenario.Target.Instance
+		}
+		if connectOpts.InstanceURI == "" {
+			panic("instance name is empty")
+		}
+		fmt.Printf("instance name:%s\n", connectOpts.InstanceURI)
 
-	password := os.Getenv("PASSWORD") // TODO passwordを適当になんとかする hello alloy
-	if password == "" {
-		panic("password is empty")
+		if connectOpts.Password == "" { // TODO passwordを適当になんとかする hello alloy
+			panic("password is empty")
+		}
+		if connectOpts.Database == "" {
+			connectOpts.Database = "quickstart_db"
+		}
+
+		// $READ_REPLICA_INSTANCE_NAME にはカンマ区切りで複数のinstanceを指定できる
+		readReplicaInstanceNames := splitList(os.Getenv("READ_REPLICA_INSTANCE_NAME"))
+		if len(scenario.Target.ReadReplicaInstances) > 0 {
+			readReplicaInstanceNames = scenario.Target.ReadReplicaInstances
+		}
+		for _, instanceName := range readReplicaInstanceNames {
+			fmt.Printf("read replica instance name:%s\n", instanceName)
+			replicaOpts := *connectOpts
+			replicaOpts.InstanceURI = instanceName
+			readReplicaConnectOpts = append(readReplicaConnectOpts, &replicaOpts)
+		}
 	}
-	pgxCon, cleanup, err := alloy.ConnectPgx(ctx, instanceName, user, password, "quickstart_db")
+	readReplicaPolicy := os.Getenv("READ_REPLICA_POLICY")
+	if scenario.Target.ReadReplicaPolicy != "" {
+		readReplicaPolicy = scenario.Target.ReadReplicaPolicy
+	}
+	replicaPolicy, err := alloy.ParseReplicaPolicy(readReplicaPolicy)
+	if err != nil {
+		panic(err)
+	}
+
+	pgxCon, cleanup, err := alloy.Connect(ctx, connectOpts)
 	if err != nil {
 		panic(err)
 	}
@@ -75,9 +135,9 @@ func main() {
 		}
 	}()
 
-	var readReplicaPgxPool []*pgxpool.Pool
-	if len(readReplicaInstanceName) > 0 {
-		pgxCon, cleanup, err := alloy.ConnectPgx(ctx, instanceName, user, password, "quickstart_db")
+	var readReplicas []*alloy.Replica
+	for _, replicaOpts := range readReplicaConnectOpts {
+		pgxCon, cleanup, err := alloy.Connect(ctx, replicaOpts)
 		if err != nil {
 			panic(err)
 		}
@@ -94,7 +154,13 @@ func main() {
 				panic(fmt.Errorf("failed ping : %w", err))
 			}
 		}()
-		readReplicaPgxPool = append(readReplicaPgxPool, pgxCon)
+		readReplicas = append(readReplicas, alloy.NewReplica(replicaOpts.Name(), pgxCon))
+	}
+	var readReplicaSet *alloy.ReplicaSet
+	if len(readReplicas) > 0 {
+		fmt.Printf("read replicas:%d policy:%s\n", len(readReplicas), replicaPolicy)
+		readReplicaSet = alloy.NewReplicaSet(replicaPolicy, readReplicas...)
+		readReplicaSet.StartHealthCheck(ctx, alloy.DefaultHealthCheckInterval, alloy.DefaultHealthCheckFailureThreshold)
 	}
 
 	var serviceName = "srunner"
@@ -105,53 +171,104 @@ func main() {
 	fmt.Printf("SRUNNER_SERVICE_NAME=%s\n", serviceName)
 
 	trace.Init(ctx, serviceName, serviceVersion)
+	controlServer.Handle("/metrics", trace.MetricsHandler())
 	if err := profiler.Init(ctx, serviceName, serviceVersion); err != nil {
 		panic(err)
 	}
 
-	s := balance.NewStoreAlloy(pgxCon, readReplicaPgxPool)
-	operationStore := operation.NewStoreAlloy(pgxCon)
-	balanceRunner := &balance.DepositAlloyRunner{
-		Store:          s,
-		OperationStore: operationStore,
+	runnerEnv := &srunner.RunnerEnv{
+		AlloyDB:             pgxCon,
+		AlloyDBReadReplicas: readReplicaSet,
 	}
-	if runner == "DEPOSIT" {
-		ar := srunner.NewAppRunner(ctx, 50, 50)
-		ar.Run(ctx, "Balance.Deposit", balanceRunner)
+	// $SRUNNER_PREFLIGHT=false でなければ、負荷をかける前にRunnerが使うSQLが正しいかを確認し、正しくなければ終了する
+	if err := srunner.RunPreflight(ctx, scenario, runnerEnv, os.Stdout); err != nil {
+		panic(err)
 	}
-
-	readUserBalanceRunner := &balance.ReadUserBalancesAlloyRunner{
-		Store: s,
+	appRunners, err := scenario.Start(ctx, runnerEnv)
+	if err != nil {
+		panic(err)
 	}
-	if runner == "READ_USER_BALANCES" {
-		ar := srunner.NewAppRunner(ctx, 50, 50)
-		ar.Run(ctx, "Balance.ReadUserBalances", readUserBalanceRunner)
+	if err := controlServer.Attach(runnerEnv, appRunners...); err != nil {
+		panic(err)
 	}
 
-	findUserDepositHistoriesRunner := &balance.FindUserDepositHistoriesAlloyRunner{
-		Store: s,
-	}
-	if runner == "FIND_USER_DEPOSIT_HISTORIES" {
-		ar := srunner.NewAppRunner(ctx, 50, 50)
-		ar.Run(ctx, "Balance.FindUserDepositHistories", findUserDepositHistoriesRunner)
+	// DurationかIterationsが指定されている場合は、POST /runners で起動したものも含めて、すべてのRunnerが終わったら終了する
+	var completed <-chan struct{}
+	if scenario.Bounded() {
+		completed = controlServer.AllDone()
 	}
 
 	// Receive output from signalChan.
-	sig := <-signalChan
-	fmt.Printf("--%s signal caught--\n", sig)
-	time.Sleep(10)
+	select {
+	case sig := <-signalChan:
+		fmt.Printf("--%s signal caught--\n", sig)
+	case <-completed:
+		fmt.Println("--all runners completed--")
+	}
+	controlServer.SetReady(false)
+	exitCode := 0
+	drainTimeout := time.Duration(scenario.DrainTimeout)
+	if err := srunner.DrainAll(drainTimeout, controlServer.Runners()...); err != nil {
+		fmt.Printf("failed drain runners. timeout=%s err=%s\n", drainTimeout, err)
+		exitCode = 1
+	}
+	// $SRUNNER_VERIFY_BALANCE=true の場合は、負荷をかけ終わった後にUserBalanceとUserDepositHistoryの整合性を確認する
+	if os.Getenv("SRUNNER_VERIFY_BALANCE") == "true" {
+		if !balance.VerifyAndWrite(ctx, balance.NewStoreAlloy(pgxCon, readReplicaSet), os.Stdout) {
+			exitCode = 1
+		}
+	}
+	if controlHTTPServer != nil {
+		if err := controlHTTPServer.Shutdown(ctx); err != nil {
+			fmt.Printf("failed shutdown control server err=%s\n", err)
+		}
+	}
+	cancel()
+	if err := srunner.WriteReport(os.Stdout, controlServer.Runners()); err != nil {
+		fmt.Printf("failed WriteReport err=%s\n", err)
+	}
 	fmt.Println("Shutdown srunner")
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
 
-func CreateAlloyUser(ctx context.Context) {
-	//for i := 1; i < 10000000; i++ {
-	//	userID := balance.CreateUserID(ctx, int64(i))
-	//	if err := s.InsertUserBalance(ctx, &balance.UserBalance{
-	//		UserID: userID,
-	//		Amount: 0,
-	//		Point:  0,
-	//	}); err != nil {
-	//		panic(err)
-	//	}
-	//}
+// loadScenario is $SRUNNER_SCENARIO にfileが指定されていればそれを読み、なければ環境変数から作る
+// $SRUNNER_RUNNERS がない場合は $RUNNER に指定された1つのRunnerを rate 50, parallelism 50 で実行する
+func loadScenario() (*srunner.Scenario, error) {
+	if path := os.Getenv("SRUNNER_SCENARIO"); path != "" {
+		fmt.Printf("SRUNNER_SCENARIO=%s\n", path)
+		return srunner.LoadScenario(path)
+	}
+	scenario, err := srunner.ScenarioFromEnv(srunner.BackendAlloyDB)
+	if err != nil {
+		return nil, err
+	}
+	if len(scenario.Runners) > 0 {
+		return scenario, nil
+	}
+
+	runner := os.Getenv("RUNNER")
+	fmt.Printf("runner:%s\n", runner)
+	if runner != "" {
+		scenario.Runners = append(scenario.Runners, &srunner.RunnerSpec{
+			Name:        runner,
+			Rate:        50,
+			Parallelism: 50,
+			Duration:    scenario.Duration,
+			Iterations:  scenario.Iterations,
+		})
+	}
+	return scenario, nil
+}
+
+// splitList is カンマ区切りの環境変数をsliceにする
+func splitList(v string) []string {
+	var ret []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
 }
@@ -2,26 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"math/rand"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
 	"cloud.google.com/go/spanner"
-	"github.com/google/uuid"
 	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/balance"
 	"github.com/sinmetal/srunner/internal/profiler"
 	"github.com/sinmetal/srunner/internal/trace"
-	"github.com/sinmetal/srunner/operation"
-	"github.com/sinmetal/srunner/randdata"
-	"github.com/sinmetal/srunner/tweet"
-	"google.golang.org/grpc/codes"
+	_ "github.com/sinmetal/srunner/score" // register runners
+	"github.com/sinmetal/srunner/seed"
+	_ "github.com/sinmetal/srunner/tweet" // register runners
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
 )
 
 var signalChan = make(chan os.Signal, 1)
@@ -40,11 +39,22 @@ func main() {
 	// SIGTERM handles Cloud Run termination signal.
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
-	spannerProjectID := os.Getenv("SRUNNER_SPANNER_PROJECT_ID")
-	spannerInstanceID := os.Getenv("SRUNNER_SPANNER_INSTANCE_ID")
-	spannerDatabaseID := os.Getenv("SRUNNER_SPANNER_DATABASE_ID")
+	scenario, err := loadScenario()
+	if err != nil {
+		panic(err)
+	}
+	// このserverはSpannerにだけ負荷をかけるので、AlloyDBのscenarioで起動しないようにする
+	if scenario.Target.Backend != srunner.BackendSpanner {
+		panic(fmt.Sprintf("scenario target.backend is %s but this server runs %s. use cmd/server/alloy", scenario.Target.Backend, srunner.BackendSpanner))
+	}
 
-	dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s", spannerProjectID, spannerInstanceID, spannerDatabaseID)
+	dbName := scenario.Target.Database
+	if dbName == "" {
+		spannerProjectID := os.Getenv("SRUNNER_SPANNER_PROJECT_ID")
+		spannerInstanceID := os.Getenv("SRUNNER_SPANNER_INSTANCE_ID")
+		spannerDatabaseID := os.Getenv("SRUNNER_SPANNER_DATABASE_ID")
+		dbName = fmt.Sprintf("projects/%s/instances/%s/databases/%s", spannerProjectID, spannerInstanceID, spannerDatabaseID)
+	}
 	fmt.Println(dbName)
 
 	var serviceName = "srunner"
@@ -63,146 +73,124 @@ func main() {
 		balance.SetUserAccountIDMax(userMax)
 	}
 
-	runner, err := runner()
-	if err != nil {
+	_, createUserAccount := scenario.TakeRunner("CREATE_USER_ACCOUNT")
+	if err := scenario.Validate(); err != nil {
 		panic(err)
 	}
 
+	// $SRUNNER_CONTROL_ADDR が指定されている場合は、実行中のRunnerをHTTPで操作できるようにする
+	// /metrics でPrometheusのformatのmetricsも返す
+	// POST, PATCHには $SRUNNER_CONTROL_TOKEN が必要. 指定していない場合はloopbackからだけ操作できる
+	controlServer := srunner.NewControlServer(ctx, scenario)
+	controlServer.SetToken(os.Getenv("SRUNNER_CONTROL_TOKEN"))
+	var controlHTTPServer *http.Server
+	if addr := os.Getenv("SRUNNER_CONTROL_ADDR"); addr != "" {
+		controlHTTPServer = controlServer.ListenAndServe(addr)
+	}
+
 	trace.Init(ctx, serviceName, serviceVersion)
+	controlServer.Handle("/metrics", trace.MetricsHandler())
 	if err := profiler.Init(ctx, serviceName, serviceVersion); err != nil {
 		panic(err)
 	}
 
 	// meterProvider := trace.GetMeterProvider() // otel.SetMeterProviderでglobalにセットしている
-	sc, err := spanner.NewClient(ctx, dbName)
+	// abortをPickKeyで選んだkeyのbucketごとに数えるために、Spannerのclientの中でretryされるabortも記録する
+	sc, err := spanner.NewClient(ctx, dbName,
+		option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(srunner.KeyContentionUnaryClientInterceptor())),
+		option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(srunner.KeyContentionStreamClientInterceptor())),
+	)
 	if err != nil {
 		panic(err)
 	}
 
-	balanceStore, err := balance.NewStore(ctx, sc)
-	if err != nil {
-		panic(err)
+	// CREATE_USER_ACCOUNT is cmd/seed と同じようにUserAccountとUserBalanceを作る. SeedProgress Tableが必要
+	// SeedProgressがない場合は、1 Rowも書き込まずに cmd/migrate -sets seed を案内して終了する
+	// 複数のpodで実行する場合は、ScenarioのShardでpodごとにUserIDの範囲を分ける
+	if createUserAccount {
+		fmt.Println("Ignite CREATE_USER_ACCOUNT")
+		results, err := seed.Run(ctx, seed.NewSpannerTarget(sc), []*seed.Dataset{
+			balance.UserAccountSeedDataset(balance.UserAccountIDMax()),
+			balance.UserBalanceSeedDataset(balance.UserAccountIDMax()),
+		}, seed.Options{Progress: os.Stdout, Shard: scenario.Shard})
+		if errors.Is(err, seed.ErrProgressTableNotFound) {
+			fmt.Printf("failed CREATE_USER_ACCOUNT : %s\n", err)
+			os.Exit(1)
+		}
+		if err := seed.WriteResults(os.Stdout, results); err != nil {
+			fmt.Printf("failed WriteResults err=%s\n", err)
+		}
+		if err != nil {
+			panic(err)
+		}
 	}
 
-	operationStore, err := operation.NewStore(ctx, sc)
-	if err != nil {
+	runnerEnv := &srunner.RunnerEnv{
+		Spanner: sc,
+	}
+	// $SRUNNER_PREFLIGHT=false でなければ、負荷をかける前にRunnerが使うSQLが正しいかを確認し、正しくなければ終了する
+	if err := srunner.RunPreflight(ctx, scenario, runnerEnv, os.Stdout); err != nil {
 		panic(err)
 	}
-
-	balanceDepositRunner := &balance.DepositRunner{
-		BalanceStore:   balanceStore,
-		OperationStore: operationStore,
+	appRunners, err := scenario.Start(ctx, runnerEnv)
+	if err != nil {
+		panic(err)
 	}
-	balanceDepositDMLRunner := &balance.DepositDMLRunner{
-		BalanceStore:   balanceStore,
-		OperationStore: operationStore,
+	if err := controlServer.Attach(runnerEnv, appRunners...); err != nil {
+		panic(err)
 	}
-	findUserDepositHistoriesRunner := &balance.FindUserDepositHistoriesRunner{
-		BalanceStore: balanceStore,
+
+	// DurationかIterationsが指定されている場合は、POST /runners で起動したものも含めて、すべてのRunnerが終わったら終了する
+	var completed <-chan struct{}
+	if scenario.Bounded() {
+		completed = controlServer.AllDone()
 	}
 
-	if _, ok := runner["CREATE_USER_ACCOUNT"]; ok {
-		fmt.Println("Ignite CREATE_USER_ACCOUNT")
-		if err := runCreateUserAccount(ctx, balanceStore, 1, balance.UserAccountIDMax()); err != nil {
+	// Receive output from signalChan.
+	select {
+	case sig := <-signalChan:
+		fmt.Printf("--%s signal caught--\n", sig)
+	case <-completed:
+		fmt.Println("--all runners completed--")
+	}
+	controlServer.SetReady(false)
+	exitCode := 0
+	drainTimeout := time.Duration(scenario.DrainTimeout)
+	if err := srunner.DrainAll(drainTimeout, controlServer.Runners()...); err != nil {
+		fmt.Printf("failed drain runners. timeout=%s err=%s\n", drainTimeout, err)
+		exitCode = 1
+	}
+	// $SRUNNER_VERIFY_BALANCE=true の場合は、負荷をかけ終わった後にUserBalanceとUserDepositHistoryの整合性を確認する
+	if os.Getenv("SRUNNER_VERIFY_BALANCE") == "true" {
+		bs, err := balance.NewStore(ctx, sc)
+		if err != nil {
 			panic(err)
 		}
+		if !balance.VerifyAndWrite(ctx, bs, os.Stdout) {
+			exitCode = 1
+		}
 	}
-	if rate, ok := runner["DEPOSIT"]; ok {
-		fmt.Printf("Ignite DEPOSIT:%d\n", rate)
-		ar := srunner.NewAppRunner(ctx, rate, 50)
-		ar.Run(ctx, "Balance.Deposit", balanceDepositRunner)
-	}
-	if rate, ok := runner["DEPOSIT_DML"]; ok {
-		fmt.Printf("Ignite DEPOSIT_DML:%d\n", rate)
-		ar := srunner.NewAppRunner(ctx, rate, 50)
-		ar.Run(ctx, "Balance.DepositDML", balanceDepositDMLRunner)
-	}
-	if rate, ok := runner["FIND_USER_DEPOSIT_HISTORIES"]; ok {
-		fmt.Printf("Ignite FIND_USER_DEPOSIT_HISTORIES:%d\n", rate)
-		ar := srunner.NewAppRunner(ctx, rate, 50)
-		ar.Run(ctx, "Balance.FindUserDepositHistories", findUserDepositHistoriesRunner)
-	}
-	if _, ok := runner["TWEET"]; ok {
-		fmt.Println("Ignite TWEET")
-		ts := tweet.NewStore(sc)
-		go runTweet(ctx, ts)
+	if controlHTTPServer != nil {
+		if err := controlHTTPServer.Shutdown(ctx); err != nil {
+			fmt.Printf("failed shutdown control server err=%s\n", err)
+		}
 	}
-
-	// Receive output from signalChan.
-	sig := <-signalChan
-	fmt.Printf("--%s signal caught--\n", sig)
 	cancel()
-	time.Sleep(10)
+	if err := srunner.WriteReport(os.Stdout, controlServer.Runners()); err != nil {
+		fmt.Printf("failed WriteReport err=%s\n", err)
+	}
 	sc.Close()
 	fmt.Println("Shutdown srunner")
-}
-
-func runner() (map[string]int, error) {
-	runner := make(map[string]int)
-	runnersParam := os.Getenv("SRUNNER_RUNNERS") // DEPOSIT:10;TWEET:1 というformatを期待している
-	runners := strings.Split(runnersParam, ";")
-	for _, v := range runners {
-		l := strings.Split(v, ":")
-		if len(l) > 1 {
-			parallels, err := strconv.Atoi(l[1])
-			if err != nil {
-				return nil, fmt.Errorf("invalid $SRUNNER_RUNNERS format %s : %w", runnersParam, err)
-			}
-			runner[l[0]] = parallels
-		} else if len(l) == 1 {
-			runner[l[0]] = 1
-		}
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
-	return runner, nil
 }
 
-func runTweet(ctx context.Context, ts tweet.Store) {
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Println("stop run tweet")
-			return
-		default:
-			id := uuid.New().String()
-			now := time.Now()
-			author := randdata.GetAuthor()
-			favos := randdata.GetAuthors()
-			_, err := ts.Insert(ctx, &tweet.Tweet{
-				TweetID:       id,
-				Author:        author,
-				Content:       fmt.Sprintf("Hello. My name is %s. %s (%s*%s*%s)", author, now, uuid.New().String(), uuid.New().String(), uuid.New().String()),
-				Favos:         favos,
-				Sort:          rand.Int63(),
-				CreatedAt:     now,
-				UpdatedAt:     now,
-				CommitedAt:    spanner.CommitTimestamp,
-				SchemaVersion: 1,
-			})
-			if err != nil {
-				log.Printf("failed TweetStore.Insert() id=%s err=%s\n", id, err)
-			}
-			time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond) // Insert頻度を少し抑えつつ、ランダム要素を加える
-		}
-	}
-}
-
-func runCreateUserAccount(ctx context.Context, bs *balance.Store, idRangeStart, idRangeEnd int64) error {
-	fmt.Println("start runCreateUserAccount")
-
-	for i := idRangeStart; i <= idRangeEnd; i++ {
-		userID := balance.CreateUserID(ctx, i)
-		_, err := bs.CreateUserAccount(ctx, &balance.UserAccount{
-			UserID: userID,
-			Age:    int64(rand.Intn(100)),
-			Height: int64(50 + rand.Intn(150)),
-			Weight: int64(30 + rand.Intn(100)),
-		})
-		if spanner.ErrCode(err) == codes.AlreadyExists {
-			continue
-		}
-		if err != nil {
-			return fmt.Errorf("failed balance.CreateUserAccount idRange=%d-%d; userID=%s : %w", idRangeStart, idRangeEnd, userID, err)
-		}
+// loadScenario is $SRUNNER_SCENARIO にfileが指定されていればそれを読み、なければ $SRUNNER_RUNNERS から作る
+func loadScenario() (*srunner.Scenario, error) {
+	if path := os.Getenv("SRUNNER_SCENARIO"); path != "" {
+		fmt.Printf("SRUNNER_SCENARIO=%s\n", path)
+		return srunner.LoadScenario(path)
 	}
-	return nil
+	return srunner.ScenarioFromEnv(srunner.BackendSpanner)
 }
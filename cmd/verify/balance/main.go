@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/internal/alloy"
+)
+
+// UserBalanceとUserDepositHistoryの合計が一致しているかを確認する
+//
+//	go run ./cmd/verify/balance -backend spanner
+//	go run ./cmd/verify/balance -backend alloydb
+//
+// 接続先は cmd/server/tweet, cmd/server/alloy と同じ環境変数で指定する
+// 不整合が見つかった場合は exit code 1 で終了する
+func main() {
+	ctx := context.Background()
+
+	backend := flag.String("backend", "spanner", "spanner or alloydb")
+	parallelism := flag.Int("parallelism", balance.DefaultVerifyParallelism, "number of user ranges scanned in parallel")
+	chunkSize := flag.Int64("chunk", balance.DefaultVerifyChunkSize, "number of users scanned at once")
+	limit := flag.Int("limit", 100, "max number of findings to print")
+	flag.Parse()
+
+	if v := os.Getenv("SRUNNER_USER_MAX"); v != "" {
+		userMax, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			panic(fmt.Errorf("failed parse $SRUNNER_USER_MAX = %s : %w", v, err))
+		}
+		balance.SetUserAccountIDMax(userMax)
+	}
+	opts := balance.VerifyOptions{
+		Parallelism: *parallelism,
+		ChunkSize:   *chunkSize,
+	}
+
+	var report *balance.VerifyReport
+	switch *backend {
+	case "spanner":
+		dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s",
+			os.Getenv("SRUNNER_SPANNER_PROJECT_ID"), os.Getenv("SRUNNER_SPANNER_INSTANCE_ID"), os.Getenv("SRUNNER_SPANNER_DATABASE_ID"))
+		fmt.Println(dbName)
+		sc, err := spanner.NewClient(ctx, dbName)
+		if err != nil {
+			panic(err)
+		}
+		defer sc.Close()
+		store, err := balance.NewStore(ctx, sc)
+		if err != nil {
+			panic(err)
+		}
+		report, err = store.Verify(ctx, opts)
+		if err != nil {
+			panic(err)
+		}
+	case "alloydb":
+		connectOpts, err := alloy.ConnectOptionsFromEnv()
+		if err != nil {
+			panic(err)
+		}
+		if connectOpts.DSN == "" && connectOpts.Database == "" {
+			connectOpts.Database = "quickstart_db"
+		}
+		pool, cleanup, err := alloy.Connect(ctx, connectOpts)
+		if err != nil {
+			panic(err)
+		}
+		defer func() {
+			pool.Close()
+			if err := cleanup(); err != nil {
+				fmt.Printf("failed cleanup : %s\n", err)
+			}
+		}()
+		report, err = balance.NewStoreAlloy(pool, nil).Verify(ctx, opts)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported backend %s", *backend))
+	}
+
+	if err := report.Write(os.Stdout, *limit); err != nil {
+		panic(err)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
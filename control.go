@@ -0,0 +1,396 @@
+package srunner
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ControlServer is 実行中のAppRunnnerをHTTPで操作するためのServer
+//
+//	GET   /healthz                  processが生きていれば200
+//	GET   /readyz                   Runnerの起動が終わっていて、終了処理に入っていなければ200
+//	GET   /runners                  AppRunnnerの一覧と計測結果
+//	POST  /runners                  RunnerSpecをbodyに指定して、登録されているRunnerを起動する
+//	GET   /runners/{name}           AppRunnnerの状態と計測結果
+//	PATCH /runners/{name}           {"rate": 100, "parallelism": 10} のようにrateと並列数を変更する
+//	POST  /runners/{name}/pause     新しいRunの開始を止める
+//	POST  /runners/{name}/resume    pauseしたRunnerを再開する
+//	POST  /runners/{name}/stop      新しいRunの開始を止めて終了させる
+//
+// /metrics などのそれ以外のpathはHandleで追加する
+//
+// POST, PATCHはRunnerを起動したり負荷を変えたりできるので、SetTokenでtokenを設定した場合は
+// Authorization: Bearer {token} が必要. 設定していない場合はloopbackからのrequestだけ受け付ける
+type ControlServer struct {
+	ctx      context.Context
+	scenario *Scenario
+
+	mu      sync.RWMutex
+	env     *RunnerEnv
+	names   []string
+	runners map[string]*AppRunnner
+	token   string
+
+	// active is 登録されていて、まだ終了していないAppRunnnerの数
+	active   int
+	attached bool
+	allDone  chan struct{}
+	done     bool
+
+	ready int32
+
+	handlersMu sync.RWMutex
+	handlers   map[string]http.Handler
+}
+
+// RunnerPatch is PATCH /runners/{name} のbody
+// 指定しなかった値は変更しない
+type RunnerPatch struct {
+	Rate        *float64 `json:"rate"`
+	Parallelism *int     `json:"parallelism"`
+}
+
+// NewControlServer is ControlServerを作る
+// POST /runners で起動するRunnerはscenarioのTargetとctxを使う
+func NewControlServer(ctx context.Context, scenario *Scenario) *ControlServer {
+	return &ControlServer{
+		ctx:      ctx,
+		scenario: scenario,
+		runners:  make(map[string]*AppRunnner),
+		allDone:  make(chan struct{}),
+		handlers: make(map[string]http.Handler),
+	}
+}
+
+// SetToken is POST, PATCHのrequestに必要なtokenを設定する
+// 空文字の場合はloopbackからのrequestだけ受け付ける
+func (s *ControlServer) SetToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// Handle is pathにhandlerを追加する
+// e.g. /metrics
+func (s *ControlServer) Handle(path string, handler http.Handler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.handlers[path] = handler
+}
+
+// Attach is 起動したAppRunnnerを登録して、readyにする
+// envは POST /runners でRunnerを起動する時に使う
+func (s *ControlServer) Attach(env *RunnerEnv, runners ...*AppRunnner) error {
+	s.mu.Lock()
+	s.env = env
+	s.mu.Unlock()
+
+	for _, ar := range runners {
+		if err := s.add(ar); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.attached = true
+	s.closeAllDoneIfIdle()
+	s.mu.Unlock()
+
+	s.SetReady(true)
+	return nil
+}
+
+// AllDone is Attachと POST /runners で登録したすべてのAppRunnnerが終了したらcloseされるchannelを返す
+// closeされた後は POST /runners でRunnerを起動できない
+func (s *ControlServer) AllDone() <-chan struct{} {
+	return s.allDone
+}
+
+// closeAllDoneIfIdle is Attachした後で、実行中のAppRunnnerがなければallDoneをcloseする. muをLockした状態で呼ぶこと
+func (s *ControlServer) closeAllDoneIfIdle() {
+	if !s.attached || s.done || s.active > 0 {
+		return
+	}
+	s.done = true
+	close(s.allDone)
+}
+
+// SetReady is /readyz の結果を変更する
+func (s *ControlServer) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+
+// Ready is readyかどうかを返す
+func (s *ControlServer) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// Runners is 登録されているAppRunnnerを登録順に返す
+// POST /runners で起動したものも含む
+func (s *ControlServer) Runners() []*AppRunnner {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ret []*AppRunnner
+	for _, name := range s.names {
+		ret = append(ret, s.runners[name])
+	}
+	return ret
+}
+
+// Runner is nameのAppRunnnerを返す
+func (s *ControlServer) Runner(name string) (*AppRunnner, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.runners[name]
+	return v, ok
+}
+
+func (s *ControlServer) add(ar *AppRunnner) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return fmt.Errorf("failed add runner %s : all runners are already done", ar.Name())
+	}
+	if _, ok := s.runners[ar.Name()]; ok {
+		return fmt.Errorf("runner %s is already running", ar.Name())
+	}
+	s.names = append(s.names, ar.Name())
+	s.runners[ar.Name()] = ar
+	s.active++
+	go func() {
+		<-ar.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.active--
+		s.closeAllDoneIfIdle()
+	}()
+	return nil
+}
+
+// authorize is POST, PATCHのrequestを受け付けてよいかを確認する
+func (s *ControlServer) authorize(r *http.Request) (int, error) {
+	s.mu.RLock()
+	token := s.token
+	s.mu.RUnlock()
+
+	if token != "" {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return http.StatusUnauthorized, errors.New("invalid control token")
+		}
+		return http.StatusOK, nil
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return http.StatusForbidden, errors.New("control token is not set. only requests from loopback are allowed")
+	}
+	return http.StatusOK, nil
+}
+
+// ListenAndServe is addrでControlServerを起動する
+// 返ってきたhttp.ServerをShutdownすると止まる
+func (s *ControlServer) ListenAndServe(addr string) *http.Server {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+	go func() {
+		fmt.Printf("control server listen %s\n", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("failed control server listen %s err=%s\n", addr, err)
+		}
+	}()
+	return server
+}
+
+func (s *ControlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handlersMu.RLock()
+	handler, ok := s.handlers[r.URL.Path]
+	s.handlersMu.RUnlock()
+	if ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if status, err := s.authorize(r); err != nil {
+			writeControlError(w, status, err)
+			return
+		}
+	}
+
+	switch r.URL.Path {
+	case "/healthz":
+		s.handleHealthz(w, r)
+		return
+	case "/readyz":
+		s.handleReadyz(w, r)
+		return
+	case "/runners", "/runners/":
+		switch r.Method {
+		case http.MethodGet:
+			s.handleListRunners(w, r)
+		case http.MethodPost:
+			s.handleStartRunner(w, r)
+		default:
+			writeControlError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		}
+		return
+	}
+
+	l := strings.Split(strings.TrimPrefix(r.URL.Path, "/runners/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/runners/") || len(l) > 2 {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+		return
+	}
+	ar, ok := s.Runner(l[0])
+	if !ok {
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("runner %s is not found", l[0]))
+		return
+	}
+	if len(l) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			writeControlJSON(w, http.StatusOK, ar.Status())
+		case http.MethodPatch:
+			s.handlePatchRunner(w, r, ar)
+		default:
+			writeControlError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeControlError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	switch l[1] {
+	case "pause":
+		ar.Pause()
+	case "resume":
+		ar.Resume()
+	case "stop":
+		ar.Stop()
+	default:
+		writeControlError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+		return
+	}
+	fmt.Printf("control %s %s\n", l[1], ar.Name())
+	writeControlJSON(w, http.StatusOK, ar.Status())
+}
+
+func (s *ControlServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *ControlServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("not ready"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *ControlServer) handleListRunners(w http.ResponseWriter, r *http.Request) {
+	ret := []*RunnerStatus{}
+	for _, ar := range s.Runners() {
+		ret = append(ret, ar.Status())
+	}
+	writeControlJSON(w, http.StatusOK, ret)
+}
+
+func (s *ControlServer) handleStartRunner(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		writeControlError(w, http.StatusServiceUnavailable, errors.New("control server is not ready"))
+		return
+	}
+	var spec RunnerSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid runner spec : %w", err))
+		return
+	}
+	if spec.Name == "" {
+		writeControlError(w, http.StatusBadRequest, errors.New("runner name is empty"))
+		return
+	}
+	if _, ok := s.Runner(spec.Name); ok {
+		writeControlError(w, http.StatusConflict, fmt.Errorf("runner %s is already running", spec.Name))
+		return
+	}
+
+	s.mu.RLock()
+	env := s.env
+	s.mu.RUnlock()
+	ar, err := s.scenario.StartRunner(s.ctx, env, &spec)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.add(ar); err != nil {
+		ar.Stop()
+		writeControlError(w, http.StatusConflict, err)
+		return
+	}
+	writeControlJSON(w, http.StatusCreated, ar.Status())
+}
+
+func (s *ControlServer) handlePatchRunner(w http.ResponseWriter, r *http.Request, ar *AppRunnner) {
+	var patch RunnerPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid runner patch : %w", err))
+		return
+	}
+	if patch.Rate != nil && *patch.Rate <= 0 {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid rate %v : must be positive", *patch.Rate))
+		return
+	}
+	if patch.Parallelism != nil {
+		if err := ar.SetParallelism(*patch.Parallelism); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrStopped) {
+				status = http.StatusConflict
+			}
+			writeControlError(w, status, err)
+			return
+		}
+		fmt.Printf("control parallelism %s:%d\n", ar.Name(), *patch.Parallelism)
+	}
+	if patch.Rate != nil {
+		ar.OverrideRate(*patch.Rate)
+		fmt.Printf("control rate %s:%v\n", ar.Name(), *patch.Rate)
+	}
+	writeControlJSON(w, http.StatusOK, ar.Status())
+}
+
+func writeControlJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("failed write control response err=%s\n", err)
+	}
+}
+
+func writeControlError(w http.ResponseWriter, status int, err error) {
+	writeControlJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,211 @@
+package srunner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scenario := &Scenario{
+		Runners: []*RunnerSpec{
+			{Name: "TEST_COUNT", Rate: 10, Parallelism: 1},
+		},
+	}
+	scenario.setDefaults()
+	cs := NewControlServer(ctx, scenario)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	do := func(method string, path string, body string) (int, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, b
+	}
+
+	if code, _ := do(http.MethodGet, "/healthz", ""); code != http.StatusOK {
+		t.Errorf("want /healthz %d but got %d", http.StatusOK, code)
+	}
+	if code, _ := do(http.MethodGet, "/readyz", ""); code != http.StatusServiceUnavailable {
+		t.Errorf("want /readyz %d before Attach but got %d", http.StatusServiceUnavailable, code)
+	}
+
+	env := &RunnerEnv{}
+	runners, err := scenario.Start(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Attach(env, runners...); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(http.MethodGet, "/readyz", ""); code != http.StatusOK {
+		t.Errorf("want /readyz %d but got %d", http.StatusOK, code)
+	}
+
+	code, body := do(http.MethodPatch, "/runners/TEST_COUNT", `{"rate": 100, "parallelism": 3}`)
+	if code != http.StatusOK {
+		t.Fatalf("want PATCH %d but got %d %s", http.StatusOK, code, body)
+	}
+	var status RunnerStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := float64(100), status.Rate; e != g {
+		t.Errorf("want Rate %v but got %v", e, g)
+	}
+	if e, g := 3, status.Parallelism; e != g {
+		t.Errorf("want Parallelism %d but got %d", e, g)
+	}
+
+	if code, _ := do(http.MethodPost, "/runners/TEST_COUNT/pause", ""); code != http.StatusOK {
+		t.Errorf("want pause %d but got %d", http.StatusOK, code)
+	}
+	if !runners[0].Paused() {
+		t.Errorf("want Paused")
+	}
+	if code, _ := do(http.MethodPost, "/runners/TEST_COUNT/resume", ""); code != http.StatusOK {
+		t.Errorf("want resume %d but got %d", http.StatusOK, code)
+	}
+
+	if code, body := do(http.MethodPost, "/runners", `{"name": "TEST_ERROR", "rate": 10, "parallelism": 1, "backoff": "none"}`); code != http.StatusCreated {
+		t.Errorf("want POST %d but got %d %s", http.StatusCreated, code, body)
+	}
+	if code, _ := do(http.MethodPost, "/runners", `{"name": "TEST_ERROR"}`); code != http.StatusConflict {
+		t.Errorf("want duplicated POST %d but got %d", http.StatusConflict, code)
+	}
+	if code, _ := do(http.MethodPost, "/runners", `{"name": "HOGE"}`); code != http.StatusBadRequest {
+		t.Errorf("want not registered POST %d but got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := do(http.MethodGet, "/runners/HOGE", ""); code != http.StatusNotFound {
+		t.Errorf("want %d but got %d", http.StatusNotFound, code)
+	}
+
+	code, body = do(http.MethodGet, "/runners", "")
+	if code != http.StatusOK {
+		t.Fatalf("want GET %d but got %d", http.StatusOK, code)
+	}
+	var list []*RunnerStatus
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 2, len(list); e != g {
+		t.Errorf("want %d runners but got %d", e, g)
+	}
+
+	if err := DrainAll(DefaultDrainTimeout, cs.Runners()...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControlServer_Authorize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scenario := &Scenario{}
+	scenario.setDefaults()
+	cs := NewControlServer(ctx, scenario)
+	if err := cs.Attach(&RunnerEnv{}); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method string, remoteAddr string, token string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, "/runners", strings.NewReader(`{"name": "HOGE"}`))
+		req.RemoteAddr = remoteAddr
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		cs.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// tokenを設定していない場合はloopbackからだけPOSTできる
+	if e, g := http.StatusBadRequest, do(http.MethodPost, "127.0.0.1:1234", ""); e != g {
+		t.Errorf("want loopback POST %d but got %d", e, g)
+	}
+	if e, g := http.StatusForbidden, do(http.MethodPost, "192.0.2.1:1234", ""); e != g {
+		t.Errorf("want remote POST %d but got %d", e, g)
+	}
+	if e, g := http.StatusOK, do(http.MethodGet, "192.0.2.1:1234", ""); e != g {
+		t.Errorf("want remote GET %d but got %d", e, g)
+	}
+
+	cs.SetToken("secret")
+	if e, g := http.StatusUnauthorized, do(http.MethodPost, "127.0.0.1:1234", ""); e != g {
+		t.Errorf("want POST without token %d but got %d", e, g)
+	}
+	if e, g := http.StatusUnauthorized, do(http.MethodPost, "192.0.2.1:1234", "hoge"); e != g {
+		t.Errorf("want POST with invalid token %d but got %d", e, g)
+	}
+	if e, g := http.StatusBadRequest, do(http.MethodPost, "192.0.2.1:1234", "secret"); e != g {
+		t.Errorf("want POST with token %d but got %d", e, g)
+	}
+}
+
+func TestControlServer_AllDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	scenario := &Scenario{
+		Runners: []*RunnerSpec{
+			{Name: "TEST_COUNT", Rate: 1000, Parallelism: 1, Iterations: 1},
+		},
+	}
+	scenario.setDefaults()
+	cs := NewControlServer(ctx, scenario)
+	env := &RunnerEnv{}
+	runners, err := scenario.Start(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// POST /runners で起動したRunnerが終わるまでAllDoneはcloseされない
+	posted, err := scenario.StartRunner(ctx, env, &RunnerSpec{Name: "TEST_ERROR", Rate: 10, Parallelism: 1, Backoff: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Attach(env, append(runners, posted)...); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-runners[0].Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	select {
+	case <-cs.AllDone():
+		t.Fatal("want AllDone not closed while posted runner is running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	posted.Stop()
+	select {
+	case <-cs.AllDone():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if err := cs.add(posted); err == nil {
+		t.Errorf("want error when adding runner after AllDone")
+	}
+}
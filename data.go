@@ -1,24 +0,0 @@
-package srunner
-
-import "math/rand"
-
-func getAuthor() string {
-	c := []string{"gold", "silver", "dia", "ruby", "sapphire"}
-	return c[rand.Intn(len(c))]
-}
-
-func getAuthors() []string {
-	exists := make(map[string]string)
-
-	count := rand.Intn(4)
-	for i := 0; i < count; i++ {
-		a := getAuthor()
-		exists[a] = a
-	}
-
-	authors := []string{}
-	for k, _ := range exists {
-		authors = append(authors, k)
-	}
-	return authors
-}
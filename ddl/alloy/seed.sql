@@ -0,0 +1,8 @@
+CREATE TABLE SeedProgress (
+    Dataset text NOT NULL,
+    ChunkStart bigint NOT NULL,
+    ChunkEnd bigint NOT NULL,
+    Inserted bigint NOT NULL,
+    CompletedAt timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (Dataset, ChunkStart)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE SeedProgress (
+    Dataset STRING(MAX) NOT NULL,
+    ChunkStart INT64 NOT NULL,
+    ChunkEnd INT64 NOT NULL,
+    Inserted INT64 NOT NULL,
+    CompletedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true),
+) PRIMARY KEY (Dataset, ChunkStart);
@@ -0,0 +1,231 @@
+// Package ddl is ddl/*.sql, ddl/alloy/*.sql をStatementに分割する
+//
+// ; で単純に分割すると、comment, 文字列literal, quoted identifierの中の ; でも分割してしまうので、
+// dialectごとのlexerでcommentとliteralを読み飛ばしながら分割する
+package ddl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Dialect is DDLの文法
+type Dialect string
+
+const (
+	// GoogleSQL is SpannerのGoogleSQL
+	// -- # /* */ のcomment, '...' "..." '''...''' """...""" の文字列, `...` のquoted identifier
+	GoogleSQL Dialect = "googlesql"
+
+	// PostgreSQL is PostgreSQL, AlloyDB
+	// -- /* */(入れ子可) のcomment, '...' E'...' $tag$...$tag$ の文字列, "..." のquoted identifier
+	PostgreSQL Dialect = "postgresql"
+)
+
+// ReadFile is fileを読んでSplitする
+func ReadFile(path string, dialect Dialect) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read %s : %w", path, err)
+	}
+	stmts, err := Split(string(b), dialect)
+	if err != nil {
+		return nil, fmt.Errorf("failed split %s : %w", path, err)
+	}
+	return stmts, nil
+}
+
+// Split is srcを ; でStatementに分割する
+// commentは取り除き、前後の空白はTrimする. 空のStatementは返さない
+func Split(src string, dialect Dialect) ([]string, error) {
+	switch dialect {
+	case GoogleSQL, PostgreSQL:
+	default:
+		return nil, fmt.Errorf("unsupported dialect %s", dialect)
+	}
+	l := &lexer{src: src, dialect: dialect}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.stmts, nil
+}
+
+type lexer struct {
+	src     string
+	pos     int
+	dialect Dialect
+	buf     strings.Builder
+	stmts   []string
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ';':
+			l.flush()
+			l.pos++
+		case l.hasPrefix("--") || (c == '#' && l.dialect == GoogleSQL):
+			l.skipLineComment()
+		case l.hasPrefix("/*"):
+			if err := l.skipBlockComment(); err != nil {
+				return err
+			}
+		case c == '\'' || c == '"':
+			if err := l.quoted(); err != nil {
+				return err
+			}
+		case c == '`' && l.dialect == GoogleSQL:
+			if err := l.literal("`", true); err != nil {
+				return err
+			}
+		case c == '$' && l.dialect == PostgreSQL:
+			if err := l.dollarQuoted(); err != nil {
+				return err
+			}
+		default:
+			l.buf.WriteByte(c)
+			l.pos++
+		}
+	}
+	l.flush()
+	return nil
+}
+
+func (l *lexer) hasPrefix(v string) bool {
+	return strings.HasPrefix(l.src[l.pos:], v)
+}
+
+// flush is bufをStatementにする
+func (l *lexer) flush() {
+	if stmt := strings.TrimSpace(l.buf.String()); stmt != "" {
+		l.stmts = append(l.stmts, stmt)
+	}
+	l.buf.Reset()
+}
+
+// line is posが何行目か. error messageに使う
+func (l *lexer) line(pos int) int {
+	return strings.Count(l.src[:pos], "\n") + 1
+}
+
+// skipLineComment is 改行の手前まで読み飛ばす. 改行はStatementに残す
+func (l *lexer) skipLineComment() {
+	if i := strings.IndexByte(l.src[l.pos:], '\n'); i >= 0 {
+		l.pos += i
+		return
+	}
+	l.pos = len(l.src)
+}
+
+// skipBlockComment is /* */ を読み飛ばす. PostgreSQLは入れ子にできる
+// 前後のtokenがくっつかないように空白を1つ残す
+func (l *lexer) skipBlockComment() error {
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		switch {
+		case l.hasPrefix("/*") && (depth == 0 || l.dialect == PostgreSQL):
+			depth++
+			l.pos += 2
+		case l.hasPrefix("*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				l.buf.WriteByte(' ')
+				return nil
+			}
+		default:
+			l.pos++
+		}
+	}
+	return fmt.Errorf("unterminated comment at line %d", l.line(start))
+}
+
+// quoted is ' か " で始まる文字列かquoted identifierを読む
+func (l *lexer) quoted() error {
+	c := l.src[l.pos]
+	if l.dialect == GoogleSQL {
+		// '''...''' """..."""
+		if triple := strings.Repeat(string(c), 3); l.hasPrefix(triple) {
+			return l.literal(triple, true)
+		}
+		return l.literal(string(c), true)
+	}
+	// PostgreSQLは '' "" でescapeする. E'...' の場合はbackslashでもescapeする
+	return l.literal(string(c), c == '\'' && l.escapeStringPrefix())
+}
+
+// escapeStringPrefix is 直前が E'...' のEかどうか
+func (l *lexer) escapeStringPrefix() bool {
+	if l.pos < 1 || (l.src[l.pos-1] != 'E' && l.src[l.pos-1] != 'e') {
+		return false
+	}
+	return l.pos < 2 || !isIdentChar(l.src[l.pos-2])
+}
+
+// literal is quoteで囲まれたliteralをそのままStatementに書く
+// backslash=trueの場合はbackslashの次の文字をescapeされたものとして扱う
+// quoteを2つ続けた場合はescapeとして扱う(GoogleSQLの文字列にはないので、結果は変わらない)
+func (l *lexer) literal(quote string, backslash bool) error {
+	start := l.pos
+	l.buf.WriteString(quote)
+	l.pos += len(quote)
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case backslash && c == '\\' && l.pos+1 < len(l.src):
+			l.buf.WriteString(l.src[l.pos : l.pos+2])
+			l.pos += 2
+		case l.hasPrefix(quote + quote):
+			l.buf.WriteString(quote + quote)
+			l.pos += 2 * len(quote)
+		case l.hasPrefix(quote):
+			l.buf.WriteString(quote)
+			l.pos += len(quote)
+			return nil
+		default:
+			l.buf.WriteByte(c)
+			l.pos++
+		}
+	}
+	return fmt.Errorf("unterminated %s at line %d", quote, l.line(start))
+}
+
+// dollarQuoted is $tag$...$tag$ をそのままStatementに書く
+// $1 のようなparameterや、identifierの中の $ はそのまま書く
+func (l *lexer) dollarQuoted() error {
+	start := l.pos
+	if l.pos > 0 && isIdentChar(l.src[l.pos-1]) {
+		l.buf.WriteByte('$')
+		l.pos++
+		return nil
+	}
+	end := l.pos + 1
+	for end < len(l.src) && isIdentChar(l.src[end]) && l.src[end] != '$' {
+		if end == l.pos+1 && l.src[end] >= '0' && l.src[end] <= '9' {
+			break
+		}
+		end++
+	}
+	if end >= len(l.src) || l.src[end] != '$' {
+		l.buf.WriteByte('$')
+		l.pos++
+		return nil
+	}
+	tag := l.src[l.pos : end+1]
+	i := strings.Index(l.src[end+1:], tag)
+	if i < 0 {
+		return fmt.Errorf("unterminated %s at line %d", tag, l.line(start))
+	}
+	stop := end + 1 + i + len(tag)
+	l.buf.WriteString(l.src[l.pos:stop])
+	l.pos = stop
+	return nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,116 @@
+package ddl
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect Dialect
+		src     string
+		want    []string
+	}{
+		{"simple", GoogleSQL, "CREATE TABLE A (ID INT64) PRIMARY KEY (ID);\nCREATE INDEX X ON A (ID)", []string{"CREATE TABLE A (ID INT64) PRIMARY KEY (ID)", "CREATE INDEX X ON A (ID)"}},
+		{"short statement", GoogleSQL, "DROP TABLE A;", []string{"DROP TABLE A"}},
+		{"empty statements", GoogleSQL, ";;\n;  ;", nil},
+		{"line comment", GoogleSQL, "-- a; b\nDROP TABLE A; -- c;\n# d;\nDROP TABLE B", []string{"DROP TABLE A", "DROP TABLE B"}},
+		{"block comment", GoogleSQL, "DROP/* ; */TABLE A;", []string{"DROP TABLE A"}},
+		{"options string", GoogleSQL, "ALTER DATABASE D SET OPTIONS (default_leader = 'us;central1');DROP TABLE A", []string{"ALTER DATABASE D SET OPTIONS (default_leader = 'us;central1')", "DROP TABLE A"}},
+		{"escaped quote", GoogleSQL, `CREATE VIEW V AS SELECT 'it\'s;' AS S, "a\";" AS T;`, []string{`CREATE VIEW V AS SELECT 'it\'s;' AS S, "a\";" AS T`}},
+		{"triple quoted", GoogleSQL, "CREATE VIEW V AS SELECT '''a;\n'b';''' AS S;", []string{"CREATE VIEW V AS SELECT '''a;\n'b';''' AS S"}},
+		{"quoted identifier", GoogleSQL, "CREATE TABLE `A;B` (`--ID` INT64) PRIMARY KEY (`--ID`);", []string{"CREATE TABLE `A;B` (`--ID` INT64) PRIMARY KEY (`--ID`)"}},
+		{"pg doubled quote", PostgreSQL, "COMMENT ON TABLE a IS 'it''s; fine';DROP TABLE a", []string{"COMMENT ON TABLE a IS 'it''s; fine'", "DROP TABLE a"}},
+		{"pg backslash is not escape", PostgreSQL, `COMMENT ON TABLE a IS 'c:\';DROP TABLE a`, []string{`COMMENT ON TABLE a IS 'c:\'`, "DROP TABLE a"}},
+		{"pg escape string", PostgreSQL, `COMMENT ON TABLE a IS E'it\'s;';DROP TABLE a`, []string{`COMMENT ON TABLE a IS E'it\'s;'`, "DROP TABLE a"}},
+		{"pg quoted identifier", PostgreSQL, `CREATE TABLE "a;""b" (id bigint);`, []string{`CREATE TABLE "a;""b" (id bigint)`}},
+		{"pg hash is not comment", PostgreSQL, "SELECT 1 # 2;", []string{"SELECT 1 # 2"}},
+		{"pg nested comment", PostgreSQL, "DROP /* a /* ; */ ; */ TABLE a;", []string{"DROP   TABLE a"}},
+		{"pg dollar quoted", PostgreSQL, "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql;DROP TABLE a", []string{"CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$ $body$ LANGUAGE sql", "DROP TABLE a"}},
+		{"pg parameter", PostgreSQL, "PREPARE p AS SELECT $1, a$b FROM t;", []string{"PREPARE p AS SELECT $1, a$b FROM t"}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Split(tt.src, tt.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("want %q but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSplit_Error(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect Dialect
+		src     string
+	}{
+		{"unterminated string", GoogleSQL, "SELECT 'a;"},
+		{"unterminated triple quoted", GoogleSQL, "SELECT '''a'';"},
+		{"unterminated comment", GoogleSQL, "DROP TABLE A /* ;"},
+		{"unterminated identifier", PostgreSQL, `CREATE TABLE "a (id bigint);`},
+		{"unterminated dollar quoted", PostgreSQL, "SELECT $x$ a; $y$;"},
+		{"unsupported dialect", Dialect("mysql"), "SELECT 1"},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Split(tt.src, tt.dialect); err == nil {
+				t.Errorf("want error")
+			}
+		})
+	}
+}
+
+// TestSplit_Golden is ddl/*.sql, ddl/alloy/*.sql をSplitした結果をtestdataのgolden fileと比べる
+// DDL fileを変更した場合は go test ./ddl -run Golden -update でgolden fileを更新する
+func TestSplit_Golden(t *testing.T) {
+	for dir, dialect := range map[string]Dialect{
+		".":     GoogleSQL,
+		"alloy": PostgreSQL,
+	} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no ddl files in %s", dir)
+		}
+		for _, fn := range files {
+			fn := fn
+			t.Run(fn, func(t *testing.T) {
+				stmts, err := ReadFile(fn, dialect)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := strings.Join(stmts, "\n;\n") + "\n"
+
+				golden := filepath.Join("testdata", strings.TrimSuffix(fn, ".sql")+".golden")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Errorf("%s does not match %s\n--- got\n%s", fn, golden, got)
+				}
+			})
+		}
+	}
+}
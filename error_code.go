@@ -0,0 +1,111 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/jackc/pgx/v5/pgconn"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrorClass is Runが失敗した理由の大まかな分類
+type ErrorClass int
+
+const (
+	// ErrorClassUnknown is 分類できないエラー
+	ErrorClassUnknown ErrorClass = iota
+
+	// ErrorClassContention is Lockの競合などで、すぐにやり直せば成功する可能性が高いエラー
+	ErrorClassContention
+
+	// ErrorClassOverload is DBが過負荷になっていて、少し待ってからやり直すべきエラー
+	ErrorClassOverload
+
+	// ErrorClassPermanent is やり直しても成功しないエラー
+	ErrorClassPermanent
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassContention:
+		return "contention"
+	case ErrorClassOverload:
+		return "overload"
+	case ErrorClassPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorCode is errからgRPCのcodeを取り出す
+// Spannerのエラーは spanner.ErrCode で、pgxのエラーはSQLSTATEから近いcodeに変換する
+func ErrorCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if code := spanner.ErrCode(err); code != codes.Unknown {
+		return code
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErrorCode(pgErr.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	}
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled
+	}
+	return codes.Unknown
+}
+
+// ClassifyError is errをErrorClassに分類する
+func ClassifyError(err error) ErrorClass {
+	switch ErrorCode(err) {
+	case codes.Aborted:
+		return ErrorClassContention
+	case codes.ResourceExhausted, codes.Unavailable, codes.DeadlineExceeded:
+		return ErrorClassOverload
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.FailedPrecondition,
+		codes.PermissionDenied, codes.Unauthenticated, codes.OutOfRange, codes.Unimplemented:
+		return ErrorClassPermanent
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// pgErrorCode is PostgreSQLのSQLSTATEをgRPCのcodeに変換する
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+func pgErrorCode(sqlState string) codes.Code {
+	switch sqlState {
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return codes.Aborted
+	case "55P03": // lock_not_available
+		return codes.Aborted
+	case "57014": // query_canceled
+		return codes.Canceled
+	case "23505": // unique_violation
+		return codes.AlreadyExists
+	case "42P01", "42703": // undefined_table, undefined_column
+		return codes.NotFound
+	case "42501": // insufficient_privilege
+		return codes.PermissionDenied
+	case "28000", "28P01": // invalid_authorization_specification, invalid_password
+		return codes.Unauthenticated
+	}
+
+	switch {
+	case strings.HasPrefix(sqlState, "53"): // insufficient resources
+		return codes.ResourceExhausted
+	case strings.HasPrefix(sqlState, "08"), strings.HasPrefix(sqlState, "57P"): // connection exception, operator intervention
+		return codes.Unavailable
+	case strings.HasPrefix(sqlState, "22"), strings.HasPrefix(sqlState, "42"): // data exception, syntax error or access rule violation
+		return codes.InvalidArgument
+	case strings.HasPrefix(sqlState, "23"): // integrity constraint violation
+		return codes.FailedPrecondition
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,184 @@
+package srunner
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// histogramSubBucketBits is 1つの2冪区間をいくつに分割するかのbit数
+// 7bitの場合、各区間を64分割するので、相対誤差は約1.5%になる
+const histogramSubBucketBits = 7
+
+const histogramSubBucketHalf = 1 << (histogramSubBucketBits - 1)
+
+// Histogram is HDR Histogramのようにlog-linearなbucketでlatencyを記録する
+//
+// 値はnanosecondで記録し、goroutine safeである
+type Histogram struct {
+	mu     sync.Mutex
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    int64
+}
+
+// NewHistogram is 空のHistogramを作る
+func NewHistogram() *Histogram {
+	return &Histogram{
+		min: math.MaxInt64,
+	}
+}
+
+// Record is latencyを1件記録する
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d)
+	if v < 0 {
+		v = 0
+	}
+	idx := histogramBucketIndex(v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if idx >= len(h.counts) {
+		counts := make([]int64, idx+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[idx]++
+	h.total++
+	h.sum += v
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Count is 記録した件数を返す
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.total
+}
+
+// Max is 記録した最大値を返す
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return time.Duration(h.max)
+}
+
+// Min is 記録した最小値を返す
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.min)
+}
+
+// Mean is 記録した値の平均を返す
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	return time.Duration(h.sum / h.total)
+}
+
+// Percentile is 指定したpercentile(0~100)の値を返す
+//
+// 返す値はbucketの上限値なので、実際の値より最大で約1.5%大きくなる
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return time.Duration(h.min)
+	}
+	if p >= 100 {
+		return time.Duration(h.max)
+	}
+
+	target := int64(math.Ceil(float64(h.total) * p / 100))
+	if target < 1 {
+		target = 1
+	}
+	var seen int64
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= target {
+			v := histogramBucketUpper(idx)
+			if v > h.max {
+				v = h.max
+			}
+			return time.Duration(v)
+		}
+	}
+	return time.Duration(h.max)
+}
+
+// Merge is otherの内容を自分に足し込む
+func (h *Histogram) Merge(other *Histogram) {
+	other.mu.Lock()
+	counts := make([]int64, len(other.counts))
+	copy(counts, other.counts)
+	total, sum, min, max := other.total, other.sum, other.min, other.max
+	other.mu.Unlock()
+
+	if total == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(counts) > len(h.counts) {
+		nc := make([]int64, len(counts))
+		copy(nc, h.counts)
+		h.counts = nc
+	}
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	h.total += total
+	h.sum += sum
+	if min < h.min {
+		h.min = min
+	}
+	if max > h.max {
+		h.max = max
+	}
+}
+
+func histogramBucketIndex(v int64) int {
+	if v < 1<<histogramSubBucketBits {
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - histogramSubBucketBits
+	mantissa := v >> shift
+	return shift*histogramSubBucketHalf + int(mantissa)
+}
+
+func histogramBucketUpper(idx int) int64 {
+	if idx < 1<<histogramSubBucketBits {
+		return int64(idx)
+	}
+	shift := idx/histogramSubBucketHalf - 1
+	mantissa := int64(idx - shift*histogramSubBucketHalf)
+	return ((mantissa + 1) << shift) - 1
+}
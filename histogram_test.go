@@ -0,0 +1,79 @@
+package srunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram_Percentile(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if e, g := int64(1000), h.Count(); e != g {
+		t.Errorf("want Count %d but got %d", e, g)
+	}
+	if e, g := 1000*time.Millisecond, h.Max(); e != g {
+		t.Errorf("want Max %s but got %s", e, g)
+	}
+	if e, g := time.Millisecond, h.Min(); e != g {
+		t.Errorf("want Min %s but got %s", e, g)
+	}
+
+	cases := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{99.9, 999 * time.Millisecond},
+		{100, 1000 * time.Millisecond},
+	}
+	for _, tt := range cases {
+		got := h.Percentile(tt.p)
+		// bucketの幅の分だけ誤差があるので、2%まで許容する
+		if got < tt.want || float64(got) > float64(tt.want)*1.02 {
+			t.Errorf("p%v: want about %s but got %s", tt.p, tt.want, got)
+		}
+	}
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	h := NewHistogram()
+	if g := h.Percentile(99); g != 0 {
+		t.Errorf("want 0 but got %s", g)
+	}
+	if g := h.Min(); g != 0 {
+		t.Errorf("want 0 but got %s", g)
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	a := NewHistogram()
+	b := NewHistogram()
+	a.Record(10 * time.Millisecond)
+	b.Record(20 * time.Second)
+
+	a.Merge(b)
+	if e, g := int64(2), a.Count(); e != g {
+		t.Errorf("want Count %d but got %d", e, g)
+	}
+	if e, g := 20*time.Second, a.Max(); e != g {
+		t.Errorf("want Max %s but got %s", e, g)
+	}
+}
+
+func TestHistogramBucketIndex(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 129, 1000, 123456789, 1 << 40} {
+		idx := histogramBucketIndex(v)
+		upper := histogramBucketUpper(idx)
+		if upper < v {
+			t.Errorf("value %d: bucket upper %d is smaller than value", v, upper)
+		}
+		if idx > 0 && histogramBucketUpper(idx-1) >= v {
+			t.Errorf("value %d: previous bucket upper %d is not smaller than value", v, histogramBucketUpper(idx-1))
+		}
+	}
+}
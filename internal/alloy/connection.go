@@ -10,13 +10,13 @@ import (
 	metadatabox "github.com/sinmetalcraft/gcpbox/metadata"
 )
 
-// connectPgx establishes a connection to your database using pgxpool and the
+// ConnectPgx establishes a connection to your database using pgxpool and the
 // AlloyDB Go Connector (aka alloydbconn.Dialer)
 //
 // The function takes an instance URI, a username, a password, and a database
 // name. Usage looks like this:
 //
-//	pool, cleanup, err := connectPgx(
+//	pool, cleanup, err := ConnectPgx(
 //	  context.Background(),
 //	  "projects/myproject/locations/us-central1/clusters/mycluster/instances/myinstance",
 //	  "postgres",
@@ -26,9 +26,21 @@ import (
 //
 // In addition to a *pgxpool.Pool type, the function returns a cleanup function
 // that should be called when you're done with the database connection.
+//
+// AlloyDBではなく普通のPostgreSQLに接続する場合や、pool sizeなどを指定する場合はConnectを使う
 func ConnectPgx(
 	ctx context.Context, instURI, user, pass, dbname string,
 ) (*pgxpool.Pool, func() error, error) {
+	return Connect(ctx, &ConnectOptions{
+		InstanceURI: instURI,
+		User:        user,
+		Password:    pass,
+		Database:    dbname,
+	})
+}
+
+// connectAlloyDB is alloydbconn.Dialerを使ってconfigのpoolを作る
+func connectAlloyDB(ctx context.Context, instURI string, config *pgxpool.Config) (*pgxpool.Pool, func() error, error) {
 	// First initialize the dialer. alloydbconn.NewDialer accepts additional
 	// options to configure credentials, timeouts, etc.
 	//
@@ -36,29 +48,13 @@ func ConnectPgx(
 	// https://pkg.go.dev/cloud.google.com/go/alloydbconn#Option
 	d, err := alloydbconn.NewDialer(ctx, alloydbconn.WithIAMAuthN())
 	if err != nil {
-		noop := func() error { return nil }
-		return nil, noop, fmt.Errorf("failed to init Dialer: %v", err)
+		return nil, noopCleanup, fmt.Errorf("failed to init Dialer: %v", err)
 	}
 	// The cleanup function will stop the dialer's background refresh
 	// goroutines. Call it when you're done with your database connection to
 	// avoid a goroutine leak.
 	cleanup := func() error { return d.Close() }
 
-	dsn := fmt.Sprintf(
-		// sslmode is disabled, because the Dialer will handle the SSL
-		// connection instead.
-		"user=%s password=%s dbname=%s sslmode=disable",
-		user, pass, dbname,
-	)
-
-	// Prefer pgxpool for applications.
-	// For more information, see:
-	// https://github.com/jackc/pgx/wiki/Getting-started-with-pgx#using-a-connection-pool
-	config, err := pgxpool.ParseConfig(dsn)
-	if err != nil {
-		return nil, cleanup, fmt.Errorf("failed to parse pgx config: %v", err)
-	}
-
 	// Tell pgx to use alloydbconn.Dialer to connect to the instance.
 	config.ConnConfig.DialFunc = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
 		if !metadatabox.OnGCP() {
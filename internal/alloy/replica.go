@@ -0,0 +1,336 @@
+package alloy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// DefaultHealthCheckInterval is ReplicaSet.StartHealthCheckでintervalを指定しなかった場合の値
+	DefaultHealthCheckInterval = 5 * time.Second
+
+	// DefaultHealthCheckFailureThreshold is 何回連続でpingに失敗したらreplicaを外すか
+	DefaultHealthCheckFailureThreshold = 3
+
+	// latencyEWMAWeight is 最新のlatencyを移動平均にどれぐらい反映するか
+	latencyEWMAWeight = 0.2
+)
+
+// ReplicaPolicy is ReplicaSetがread replicaを選ぶ方法
+type ReplicaPolicy string
+
+const (
+	// ReplicaPolicyRoundRobin is 順番に選ぶ
+	ReplicaPolicyRoundRobin ReplicaPolicy = "round_robin"
+
+	// ReplicaPolicyLeastInFlight is 実行中のqueryが一番少ないreplicaを選ぶ
+	ReplicaPolicyLeastInFlight ReplicaPolicy = "least_in_flight"
+
+	// ReplicaPolicyLowestLatency is 最近のlatencyの移動平均が一番小さいreplicaを選ぶ
+	ReplicaPolicyLowestLatency ReplicaPolicy = "lowest_latency"
+)
+
+// ParseReplicaPolicy is 文字列をReplicaPolicyにする. 空文字の場合はround_robin
+func ParseReplicaPolicy(v string) (ReplicaPolicy, error) {
+	switch p := ReplicaPolicy(strings.TrimSpace(v)); p {
+	case "":
+		return ReplicaPolicyRoundRobin, nil
+	case ReplicaPolicyRoundRobin, ReplicaPolicyLeastInFlight, ReplicaPolicyLowestLatency:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid replica policy %s : want round_robin, least_in_flight or lowest_latency", v)
+	}
+}
+
+// Replica is ReplicaSetに含まれる1つのread replica
+type Replica struct {
+	// Name is metricsやlogに出す名前. AlloyDBの場合はinstance URI
+	Name string
+	Pool *pgxpool.Pool
+
+	inFlight int64
+	healthy  int32
+	failures int32
+
+	mu      sync.Mutex
+	latency time.Duration // 移動平均. 0の場合はまだ計測していない
+}
+
+// NewReplica is healthyな状態のReplicaを作る
+func NewReplica(name string, pool *pgxpool.Pool) *Replica {
+	return &Replica{
+		Name:    name,
+		Pool:    pool,
+		healthy: 1,
+	}
+}
+
+// Healthy is health checkで外されていないかどうか
+func (r *Replica) Healthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// InFlight is 実行中のqueryの数
+func (r *Replica) InFlight() int64 {
+	return atomic.LoadInt64(&r.inFlight)
+}
+
+// Latency is 最近のlatencyの移動平均
+func (r *Replica) Latency() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.latency
+}
+
+func (r *Replica) observeLatency(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.latency == 0 {
+		r.latency = d
+		return
+	}
+	r.latency = time.Duration(latencyEWMAWeight*float64(d) + (1-latencyEWMAWeight)*float64(r.latency))
+}
+
+// ReplicaSet is 複数のread replicaからReplicaPolicyに従って1つを選ぶ
+// すべてのreplicaが外れている場合、Acquireはnilを返すので、呼び出し側でprimaryを使う
+type ReplicaSet struct {
+	policy   ReplicaPolicy
+	replicas []*Replica
+	next     uint64
+	metrics  *replicaMetrics
+}
+
+// NewReplicaSet is ReplicaSetを作る
+func NewReplicaSet(policy ReplicaPolicy, replicas ...*Replica) *ReplicaSet {
+	s := &ReplicaSet{
+		policy:   policy,
+		replicas: replicas,
+	}
+	s.metrics = getReplicaMetrics(s)
+	return s
+}
+
+// Policy is ReplicaPolicyを返す
+func (s *ReplicaSet) Policy() ReplicaPolicy {
+	return s.policy
+}
+
+// Replicas is すべてのReplicaを返す
+func (s *ReplicaSet) Replicas() []*Replica {
+	if s == nil {
+		return nil
+	}
+	return s.replicas
+}
+
+// Acquire is ReplicaPolicyに従ってhealthyなReplicaを1つ選ぶ
+// 返したdoneにはqueryの結果を渡す. healthyなReplicaがない場合はnilを返す
+func (s *ReplicaSet) Acquire(ctx context.Context) (replica *Replica, done func(err error)) {
+	if s == nil {
+		return nil, func(err error) {}
+	}
+	r := s.pick()
+	if r == nil {
+		return nil, func(err error) {}
+	}
+
+	atomic.AddInt64(&r.inFlight, 1)
+	s.metrics.addInFlight(ctx, r, 1)
+	start := time.Now()
+	return r, func(err error) {
+		elapsed := time.Since(start)
+		atomic.AddInt64(&r.inFlight, -1)
+		s.metrics.addInFlight(ctx, r, -1)
+		if err == nil {
+			r.observeLatency(elapsed)
+		}
+		s.metrics.record(ctx, r, elapsed, err)
+	}
+}
+
+func (s *ReplicaSet) pick() *Replica {
+	n := len(s.replicas)
+	if n == 0 {
+		return nil
+	}
+	// 同じ条件のreplicaが複数ある場合に偏らないように、開始位置をずらす
+	offset := int(atomic.AddUint64(&s.next, 1) - 1)
+
+	var ret *Replica
+	for i := 0; i < n; i++ {
+		r := s.replicas[(offset+i)%n]
+		if !r.Healthy() {
+			continue
+		}
+		if ret == nil {
+			ret = r
+			if s.policy == ReplicaPolicyRoundRobin {
+				return ret
+			}
+			continue
+		}
+		switch s.policy {
+		case ReplicaPolicyLeastInFlight:
+			if r.InFlight() < ret.InFlight() {
+				ret = r
+			}
+		case ReplicaPolicyLowestLatency:
+			if r.Latency() < ret.Latency() {
+				ret = r
+			}
+		}
+	}
+	return ret
+}
+
+// StartHealthCheck is intervalごとにすべてのReplicaに並行してpingする
+// 1回のpingのtimeoutはintervalなので、応答しないReplicaがあっても他のReplicaのpingは遅れない
+// failureThreshold回連続で失敗したReplicaはAcquireで選ばれなくなり、pingが成功したら戻す
+// pingのlatencyも移動平均に反映するので、lowest_latencyで選ばれていないReplicaのlatencyも更新される
+// ctxが終了するまで続ける
+func (s *ReplicaSet) StartHealthCheck(ctx context.Context, interval time.Duration, failureThreshold int) {
+	if s == nil || len(s.replicas) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if failureThreshold < 1 {
+		failureThreshold = DefaultHealthCheckFailureThreshold
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				var wg sync.WaitGroup
+				for _, r := range s.replicas {
+					wg.Add(1)
+					go func(r *Replica) {
+						defer wg.Done()
+						s.checkHealth(ctx, r, interval, failureThreshold)
+					}(r)
+				}
+				wg.Wait()
+			}
+		}
+	}()
+}
+
+func (s *ReplicaSet) checkHealth(ctx context.Context, r *Replica, timeout time.Duration, failureThreshold int) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := r.Pool.Ping(ctx); err != nil {
+		if ctx.Err() != nil && ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		failures := atomic.AddInt32(&r.failures, 1)
+		if int(failures) >= failureThreshold && atomic.CompareAndSwapInt32(&r.healthy, 1, 0) {
+			fmt.Printf("evict read replica %s. failures=%d err=%s\n", r.Name, failures, err)
+		}
+		return
+	}
+	r.observeLatency(time.Since(start))
+	atomic.StoreInt32(&r.failures, 0)
+	if atomic.CompareAndSwapInt32(&r.healthy, 0, 1) {
+		fmt.Printf("restore read replica %s\n", r.Name)
+	}
+}
+
+// replicaMeterName is read replicaのmetricsを記録する時のinstrumentation scope
+const replicaMeterName = "github.com/sinmetal/srunner/internal/alloy"
+
+// replicaMetrics is read replicaごとのmetrics
+type replicaMetrics struct {
+	queries  metric.Int64Counter
+	latency  metric.Float64Histogram
+	inFlight metric.Int64UpDownCounter
+}
+
+func getReplicaMetrics(s *ReplicaSet) *replicaMetrics {
+	m, err := newReplicaMetrics(otel.Meter(replicaMeterName), s)
+	if err != nil {
+		fmt.Printf("failed create replica metrics err=%s\n", err)
+		return nil
+	}
+	return m
+}
+
+func newReplicaMetrics(meter metric.Meter, s *ReplicaSet) (*replicaMetrics, error) {
+	queries, err := meter.Int64Counter("srunner.alloydb.replica.queries",
+		metric.WithDescription("number of queries sent to read replica"),
+		metric.WithUnit("{query}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.alloydb.replica.queries : %w", err)
+	}
+	latency, err := meter.Float64Histogram("srunner.alloydb.replica.latency",
+		metric.WithDescription("latency of queries sent to read replica"),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.alloydb.replica.latency : %w", err)
+	}
+	inFlight, err := meter.Int64UpDownCounter("srunner.alloydb.replica.in_flight",
+		metric.WithDescription("number of in-flight queries on read replica"),
+		metric.WithUnit("{query}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.alloydb.replica.in_flight : %w", err)
+	}
+	_, err = meter.Int64ObservableGauge("srunner.alloydb.replica.healthy",
+		metric.WithDescription("1 if read replica is healthy, 0 if evicted"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			for _, r := range s.replicas {
+				var v int64
+				if r.Healthy() {
+					v = 1
+				}
+				o.Observe(v, metric.WithAttributes(attribute.String("replica", r.Name)))
+			}
+			return nil
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.alloydb.replica.healthy : %w", err)
+	}
+	return &replicaMetrics{
+		queries:  queries,
+		latency:  latency,
+		inFlight: inFlight,
+	}, nil
+}
+
+func (m *replicaMetrics) addInFlight(ctx context.Context, r *Replica, v int64) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(ctx, v, metric.WithAttributes(attribute.String("replica", r.Name)))
+}
+
+func (m *replicaMetrics) record(ctx context.Context, r *Replica, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("replica", r.Name),
+		attribute.String("status", status),
+	)
+	m.queries.Add(ctx, 1, attrs)
+	m.latency.Record(ctx, float64(elapsed)/float64(time.Millisecond), attrs)
+}
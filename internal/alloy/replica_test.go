@@ -0,0 +1,120 @@
+package alloy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseReplicaPolicy(t *testing.T) {
+	cases := map[string]ReplicaPolicy{
+		"":                ReplicaPolicyRoundRobin,
+		"round_robin":     ReplicaPolicyRoundRobin,
+		"least_in_flight": ReplicaPolicyLeastInFlight,
+		"lowest_latency":  ReplicaPolicyLowestLatency,
+	}
+	for v, want := range cases {
+		got, err := ParseReplicaPolicy(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s : want %s but got %s", v, want, got)
+		}
+	}
+	if _, err := ParseReplicaPolicy("random"); err == nil {
+		t.Errorf("want error")
+	}
+}
+
+func TestReplicaSet_RoundRobin(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := NewReplica("a", nil), NewReplica("b", nil), NewReplica("c", nil)
+	s := NewReplicaSet(ReplicaPolicyRoundRobin, a, b, c)
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		r, done := s.Acquire(ctx)
+		counts[r.Name]++
+		done(nil)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name] != 10 {
+			t.Errorf("%s : want 10 but got %d", name, counts[name])
+		}
+	}
+
+	// evictされたreplicaは選ばれない
+	b.healthy = 0
+	for i := 0; i < 10; i++ {
+		r, done := s.Acquire(ctx)
+		if r.Name == "b" {
+			t.Errorf("evicted replica was selected")
+		}
+		done(nil)
+	}
+
+	// すべてevictされた場合はnil
+	a.healthy, c.healthy = 0, 0
+	if r, done := s.Acquire(ctx); r != nil {
+		t.Errorf("want nil but got %s", r.Name)
+	} else {
+		done(nil)
+	}
+}
+
+func TestReplicaSet_LeastInFlight(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewReplica("a", nil), NewReplica("b", nil)
+	s := NewReplicaSet(ReplicaPolicyLeastInFlight, a, b)
+
+	r1, done1 := s.Acquire(ctx)
+	r2, done2 := s.Acquire(ctx)
+	if r1 == r2 {
+		t.Errorf("want different replicas but both %s", r1.Name)
+	}
+	done1(nil)
+	r3, done3 := s.Acquire(ctx)
+	if r3 != r1 {
+		t.Errorf("want %s but got %s", r1.Name, r3.Name)
+	}
+	done2(nil)
+	done3(errors.New("failed"))
+	if a.InFlight() != 0 || b.InFlight() != 0 {
+		t.Errorf("in flight was not released a=%d b=%d", a.InFlight(), b.InFlight())
+	}
+}
+
+func TestReplicaSet_LowestLatency(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewReplica("a", nil), NewReplica("b", nil)
+	a.observeLatency(20 * time.Millisecond)
+	b.observeLatency(5 * time.Millisecond)
+	s := NewReplicaSet(ReplicaPolicyLowestLatency, a, b)
+
+	for i := 0; i < 5; i++ {
+		r, done := s.Acquire(ctx)
+		if r != b {
+			t.Errorf("want b but got %s", r.Name)
+		}
+		done(nil)
+	}
+
+	// 移動平均なので、1回遅くなっただけでは切り替わらない
+	c := NewReplica("c", nil)
+	c.observeLatency(5 * time.Millisecond)
+	c.observeLatency(30 * time.Millisecond)
+	if got := c.Latency(); got != 10*time.Millisecond {
+		t.Errorf("unexpected latency %s", got)
+	}
+}
+
+func TestNilReplicaSet(t *testing.T) {
+	var s *ReplicaSet
+	r, done := s.Acquire(context.Background())
+	if r != nil {
+		t.Errorf("want nil")
+	}
+	done(nil)
+}
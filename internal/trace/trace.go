@@ -5,16 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 
 	"cloud.google.com/go/spanner"
 	mexporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/metric"
 	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	gcppropagator "github.com/GoogleCloudPlatform/opentelemetry-operations-go/propagator"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	metadatabox "github.com/sinmetalcraft/gcpbox/metadata"
 	"go.opentelemetry.io/contrib/detectors/gcp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -27,9 +31,18 @@ import (
 var tracer trace.Tracer
 var meterProvider *sdkmetric.MeterProvider
 
+// promRegistry is Prometheusのreaderが使うRegistry. MetricsHandlerで公開する
+var promRegistry *prometheus.Registry
+
 func Init(ctx context.Context, serviceName string, revision string) {
 	fmt.Println("trace init()")
 
+	var metricReaders []sdkmetric.Reader
+	res := resource.NewSchemaless(
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersion(revision),
+	)
+
 	// TODO Cloud Buildの時は動かないようにしているが、もうちょっといい方法が欲しいな
 	if metadatabox.OnGCP() && os.Getenv("REF_NAME") == "" {
 		installPropagators()
@@ -39,9 +52,7 @@ func Init(ctx context.Context, serviceName string, revision string) {
 			log.Fatalf("required google cloud project id: %v", err)
 		}
 
-		spanner.EnableOpenTelemetryMetrics()
-
-		res, err := newResource(ctx, serviceName, revision)
+		res, err = newResource(ctx, serviceName, revision)
 		if errors.Is(err, resource.ErrPartialResource) || errors.Is(err, resource.ErrSchemaURLConflict) {
 			log.Println(err)
 		} else if err != nil {
@@ -55,21 +66,29 @@ func Init(ctx context.Context, serviceName string, revision string) {
 		otel.SetTracerProvider(tp)
 		tracer = otel.GetTracerProvider().Tracer("github.com/sinmetal/srunner")
 
-		// Create a new meter provider
-		meterProvider, err = getOtlpMeterProvider(ctx, projectID, res)
+		reader, err := getOtlpMetricReader(ctx, projectID)
 		if err != nil {
-			log.Fatalf("getOtlpMeterProvider: %v", err)
+			log.Fatalf("getOtlpMetricReader: %v", err)
 		}
-		otel.SetMeterProvider(meterProvider)
+		metricReaders = append(metricReaders, reader)
 	}
 	if tracer == nil {
 		fmt.Println("set default otel tracer")
 		tracer = otel.Tracer("github.com/sinmetal/srunner")
 	}
-	if meterProvider == nil {
-		// meterProvider = getOtlpMeterProvider(ctx, res)
-		fmt.Println("not set meterProvider")
+
+	// GCP以外でもmetricsを見られるように、Prometheusのreaderは常に使う
+	promReader, err := getPrometheusMetricReader()
+	if err != nil {
+		log.Fatalf("getPrometheusMetricReader: %v", err)
 	}
+	metricReaders = append(metricReaders, promReader)
+
+	meterProvider = newMeterProvider(res, metricReaders...)
+	otel.SetMeterProvider(meterProvider)
+
+	// spanner.NewClientより前に呼ぶ必要がある
+	spanner.EnableOpenTelemetryMetrics()
 	fmt.Printf("IsOpenTelemetryMetricsEnabled=%t\n", spanner.IsOpenTelemetryMetricsEnabled())
 }
 
@@ -84,19 +103,27 @@ func installPropagators() {
 		))
 }
 
-func getOtlpMeterProvider(ctx context.Context, projectID string, res *resource.Resource) (*sdkmetric.MeterProvider, error) {
+func getOtlpMetricReader(ctx context.Context, projectID string) (sdkmetric.Reader, error) {
 	exporter, err := mexporter.New(
 		mexporter.WithProjectID(projectID),
 	)
 	if err != nil {
 		return nil, err
 	}
+	return sdkmetric.NewPeriodicReader(exporter), nil
+}
 
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithResource(res),
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
-	)
-	return meterProvider, nil
+func getPrometheusMetricReader() (sdkmetric.Reader, error) {
+	promRegistry = prometheus.NewRegistry()
+	return otelprom.New(otelprom.WithRegisterer(promRegistry))
+}
+
+func newMeterProvider(res *resource.Resource, readers ...sdkmetric.Reader) *sdkmetric.MeterProvider {
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	for _, reader := range readers {
+		opts = append(opts, sdkmetric.WithReader(reader))
+	}
+	return sdkmetric.NewMeterProvider(opts...)
 }
 
 func getOtlpTracerProvider(ctx context.Context, projectID string, res *resource.Resource) (*sdktrace.TracerProvider, error) {
@@ -149,3 +176,12 @@ func EndSpan(ctx context.Context, err error) {
 func GetMeterProvider() *sdkmetric.MeterProvider {
 	return meterProvider
 }
+
+// MetricsHandler is Prometheusのformatでmetricsを返すhttp.Handler
+// Initを呼ぶ前は404を返す
+func MetricsHandler() http.Handler {
+	if promRegistry == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{})
+}
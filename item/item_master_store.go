@@ -3,10 +3,10 @@ package item
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
 )
 
 type ItemMaster struct {
@@ -28,8 +28,9 @@ func (s *ItemMasterStore) TableName() string {
 	return "ItemMaster"
 }
 
-func (s *ItemMasterStore) GetRandomID() string {
-	return fmt.Sprintf("%07d", rand.Intn(10000000))
+// GetRandomID is RunnerSpecのkeyDistributionに従って、IDを1つ選ぶ
+func (s *ItemMasterStore) GetRandomID(ctx context.Context) string {
+	return fmt.Sprintf("%07d", srunner.PickKey(ctx, itemIDMax))
 }
 
 func (s *ItemMasterStore) InsertOrUpdate(ctx context.Context, item *ItemMaster) error {
@@ -0,0 +1,23 @@
+package item
+
+import (
+	"testing"
+
+	"github.com/sinmetal/srunner/schemacheck"
+)
+
+func TestSchema(t *testing.T) {
+	s := schemacheck.Load(t, "item_master", "item_order", "item_order_dummy_fk", "item_order_nofk", "user")
+
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "ItemMaster", ItemMaster{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "ItemOrder", ItemOrder{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "ItemOrderDummyFK", ItemOrderDummyFK{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "ItemOrderNoFK", ItemOrderNOFK{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "User", User{}))
+
+	issues, err := schemacheck.CheckPackage(s, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemacheck.Verify(t, issues)
+}
@@ -0,0 +1,38 @@
+package item
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/google/uuid"
+	"github.com/sinmetal/srunner/seed"
+)
+
+// itemIDMax is GetRandomIDで選ぶItemIDの数
+const itemIDMax = 10000000
+
+// ItemMasterSeedDataset is ItemIDが 0 ~ n-1 のItemMasterを作るDataset
+// nが0の場合はGetRandomIDで選ぶすべてのItemIDを作る
+func ItemMasterSeedDataset(n int64) *seed.Dataset {
+	if n <= 0 {
+		n = itemIDMax
+	}
+	return &seed.Dataset{
+		Name:             "ItemMaster",
+		Table:            "ItemMaster",
+		Columns:          []string{"ItemID", "Name", "Price"},
+		TimestampColumns: []string{"CommitedAt"},
+		Indexes:          1,
+		Start:            0,
+		End:              n,
+		SpannerOnly:      true,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			name, err := uuid.NewRandomFromReader(r)
+			if err != nil {
+				// *rand.Rand のReadはerrorを返さない
+				panic(err)
+			}
+			return []interface{}{fmt.Sprintf("%07d", id), name.String(), r.Int63n(100000) + 1000}
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package item
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/seed"
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+func TestItemMasterSeedDataset(t *testing.T) {
+	ctx := context.Background()
+
+	sc := spannertest.Setup(t, "item_master", "seed")
+	results, err := seed.Run(ctx, seed.NewSpannerTarget(sc), []*seed.Dataset{ItemMasterSeedDataset(100)}, seed.Options{ChunkSize: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(100), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+
+	row, err := sc.Single().ReadRow(ctx, "ItemMaster", spanner.Key{"0000099"}, []string{"ItemID", "Name", "Price"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v ItemMaster
+	if err := row.ToStruct(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name == "" || v.Price < 1000 {
+		t.Errorf("unexpected ItemMaster %+v", v)
+	}
+}
@@ -3,10 +3,10 @@ package item
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
 )
 
 type User struct {
@@ -27,8 +27,9 @@ func (s *UserStore) TableName() string {
 	return "User"
 }
 
-func (s *UserStore) GetRandomID() string {
-	return fmt.Sprintf("%07d", rand.Intn(10000000))
+// GetRandomID is RunnerSpecのkeyDistributionに従って、IDを1つ選ぶ
+func (s *UserStore) GetRandomID(ctx context.Context) string {
+	return fmt.Sprintf("%07d", srunner.PickKey(ctx, 10000000))
 }
 
 func (s *UserStore) BatchInsertOrUpdate(ctx context.Context, users []*User) error {
@@ -7,6 +7,7 @@ import (
 
 	"cloud.google.com/go/spanner"
 	"github.com/google/uuid"
+	"github.com/sinmetal/srunner/spannertest"
 )
 
 func TestUserStore_Insert(t *testing.T) {
@@ -39,6 +40,6 @@ func TestUserStore_Insert(t *testing.T) {
 func newTestCreateUserStore(t *testing.T) *UserStore {
 	ctx := context.Background()
 
-	sc := newTestSpannerClient(t)
+	sc := spannertest.Setup(t, "user")
 	return NewUserStore(ctx, sc)
 }
@@ -0,0 +1,55 @@
+package srunner
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KeyContentionUnaryClientInterceptor is Abortedで失敗したRPCを、ctxのRunのabortとして記録する
+// Spannerのclientの中でretryされるabortも数えるために、spanner.NewClientのoptionに指定する
+// abortされるまでにかかった時間をlock待ちの時間として、PickKeyで選んだkeyのbucketに記録する
+func KeyContentionUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) == codes.Aborted {
+			RecordAbort(ctx, time.Since(start))
+		}
+		return err
+	}
+}
+
+// KeyContentionStreamClientInterceptor is KeyContentionUnaryClientInterceptorのstream版
+// ExecuteStreamingSqlなどがAbortedで失敗した時に、streamを開始してからの時間を記録する
+func KeyContentionStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			if status.Code(err) == codes.Aborted {
+				RecordAbort(ctx, time.Since(start))
+			}
+			return nil, err
+		}
+		return &keyContentionStream{ClientStream: s, ctx: ctx, start: start}, nil
+	}
+}
+
+// keyContentionStream is RecvMsgがAbortedで失敗した時にRecordAbortを呼ぶ
+type keyContentionStream struct {
+	grpc.ClientStream
+	ctx   context.Context
+	start time.Time
+}
+
+func (s *keyContentionStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if status.Code(err) == codes.Aborted {
+		RecordAbort(s.ctx, time.Since(s.start))
+	}
+	return err
+}
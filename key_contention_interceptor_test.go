@@ -0,0 +1,39 @@
+package srunner
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestKeyContentionUnaryClientInterceptor(t *testing.T) {
+	ctx, o := withKeyObservation(context.Background(), &SequentialKeyDistribution{}, NoShard)
+	PickKey(ctx, 10)
+
+	interceptor := KeyContentionUnaryClientInterceptor()
+	invoker := func(code codes.Code) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if code == codes.OK {
+				return nil
+			}
+			return status.Error(code, code.String())
+		}
+	}
+	for _, code := range []codes.Code{codes.Aborted, codes.OK, codes.Internal, codes.Aborted} {
+		err := interceptor(ctx, "/google.spanner.v1.Spanner/Commit", nil, nil, nil, invoker(code))
+		if e, g := code, status.Code(err); e != g {
+			t.Errorf("want %s but got %s", e, g)
+		}
+	}
+
+	_, aborts, _, ok := o.result()
+	if !ok {
+		t.Fatal("want picked")
+	}
+	if e, g := int64(2), aborts; e != g {
+		t.Errorf("want aborts %d but got %d", e, g)
+	}
+}
@@ -0,0 +1,347 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultZipfExponent is zipf, latestでexponentを指定しなかった時の値
+// math/rand.Zipfは1より大きい値しか使えない
+const DefaultZipfExponent = 1.1
+
+// KeyDistribution is Runnerが [0, n) の範囲からkeyを選ぶ時の偏り
+//
+// 本番のtrafficのように一部のkeyにaccessが集中した時のLock競合を再現するために使う
+// Runnerは PickKey(ctx, n) でkeyを選ぶ. どのKeyDistributionを使うかはRunnerSpecのkeyDistributionで指定する
+type KeyDistribution interface {
+	// Pick is rを使って [0, n) からkeyを1つ選ぶ. 複数のgoroutineから呼ばれる
+	Pick(r *rand.Rand, n int64) int64
+
+	// Rank is keyがどれだけhotかを返す. 0が一番多く選ばれるkey
+	// key bucketごとの集計に使う
+	Rank(key int64, n int64) int64
+
+	String() string
+}
+
+// UniformKeyDistribution is すべてのkeyを同じ確率で選ぶ
+type UniformKeyDistribution struct{}
+
+func (d *UniformKeyDistribution) Pick(r *rand.Rand, n int64) int64 {
+	return r.Int63n(n)
+}
+
+func (d *UniformKeyDistribution) Rank(key int64, n int64) int64 {
+	return key
+}
+
+func (d *UniformKeyDistribution) String() string {
+	return "uniform"
+}
+
+// ZipfKeyDistribution is key 0 が一番多く選ばれるZipf分布でkeyを選ぶ
+// key kが選ばれる確率は (1+k)^-Exponent に比例する
+type ZipfKeyDistribution struct {
+	Exponent float64
+}
+
+// NewZipfKeyDistribution is exponentが1以下の場合はerrorを返す
+func NewZipfKeyDistribution(exponent float64) (*ZipfKeyDistribution, error) {
+	if exponent <= 1 {
+		return nil, fmt.Errorf("invalid zipf exponent %v : must be greater than 1", exponent)
+	}
+	return &ZipfKeyDistribution{Exponent: exponent}, nil
+}
+
+func (d *ZipfKeyDistribution) Pick(r *rand.Rand, n int64) int64 {
+	if n <= 1 {
+		return 0
+	}
+	// rand.Zipfはrを持つので、workerのrandごとに作る. 作るのは定数の計算だけなので軽い
+	return int64(rand.NewZipf(r, d.Exponent, 1, uint64(n-1)).Uint64())
+}
+
+func (d *ZipfKeyDistribution) Rank(key int64, n int64) int64 {
+	return key
+}
+
+func (d *ZipfKeyDistribution) String() string {
+	return fmt.Sprintf("zipf,%v", d.Exponent)
+}
+
+// HotSetKeyDistribution is 先頭のHotPercent%のkeyに、TrafficPercent%のaccessを集中させる
+// hot setの中と外では、それぞれ同じ確率でkeyを選ぶ
+type HotSetKeyDistribution struct {
+	HotPercent     float64
+	TrafficPercent float64
+}
+
+func (d *HotSetKeyDistribution) hotKeys(n int64) int64 {
+	hot := int64(float64(n) * d.HotPercent / 100)
+	if hot < 1 {
+		hot = 1
+	}
+	if hot > n {
+		hot = n
+	}
+	return hot
+}
+
+func (d *HotSetKeyDistribution) Pick(r *rand.Rand, n int64) int64 {
+	hot := d.hotKeys(n)
+	if hot == n || r.Float64()*100 < d.TrafficPercent {
+		return r.Int63n(hot)
+	}
+	return hot + r.Int63n(n-hot)
+}
+
+func (d *HotSetKeyDistribution) Rank(key int64, n int64) int64 {
+	return key
+}
+
+func (d *HotSetKeyDistribution) String() string {
+	return fmt.Sprintf("hotset,%v,%v", d.HotPercent, d.TrafficPercent)
+}
+
+// SequentialKeyDistribution is 0から順番にkeyを選び、nに到達したら0に戻る
+// すべてのworkerで1つのcounterを共有するので、rは使わない
+type SequentialKeyDistribution struct {
+	next int64
+}
+
+func (d *SequentialKeyDistribution) Pick(r *rand.Rand, n int64) int64 {
+	v := atomic.AddInt64(&d.next, 1) - 1
+	return v % n
+}
+
+func (d *SequentialKeyDistribution) Rank(key int64, n int64) int64 {
+	return key
+}
+
+func (d *SequentialKeyDistribution) String() string {
+	return "sequential"
+}
+
+// LatestKeyDistribution is 最後に作られたkey (n-1) が一番多く選ばれるZipf分布でkeyを選ぶ
+// 新しいUserほどaccessが多いworkloadを再現する
+type LatestKeyDistribution struct {
+	zipf *ZipfKeyDistribution
+}
+
+// NewLatestKeyDistribution is exponentが1以下の場合はerrorを返す
+func NewLatestKeyDistribution(exponent float64) (*LatestKeyDistribution, error) {
+	zipf, err := NewZipfKeyDistribution(exponent)
+	if err != nil {
+		return nil, err
+	}
+	return &LatestKeyDistribution{zipf: zipf}, nil
+}
+
+func (d *LatestKeyDistribution) Pick(r *rand.Rand, n int64) int64 {
+	return n - 1 - d.zipf.Pick(r, n)
+}
+
+func (d *LatestKeyDistribution) Rank(key int64, n int64) int64 {
+	return n - 1 - key
+}
+
+func (d *LatestKeyDistribution) String() string {
+	return fmt.Sprintf("latest,%v", d.zipf.Exponent)
+}
+
+// ParseKeyDistribution is 次の形式の文字列をKeyDistributionにする. 空文字の場合はuniform
+//
+//	uniform
+//	zipf,{exponent}                          e.g. zipf,1.2  exponentを省略した場合はDefaultZipfExponent
+//	hotset,{hot key %},{traffic %}           e.g. hotset,1,90  1%のkeyに90%のaccessが集中する
+//	sequential
+//	latest,{exponent}                        e.g. latest,1.2
+func ParseKeyDistribution(spec string) (KeyDistribution, error) {
+	l := strings.Split(spec, ",")
+	name := strings.ToLower(strings.TrimSpace(l[0]))
+	params := l[1:]
+
+	floats := func(min int, max int) ([]float64, error) {
+		if len(params) < min || len(params) > max {
+			return nil, fmt.Errorf("invalid %s key distribution %s : want %d~%d params", name, spec, min, max)
+		}
+		var ret []float64
+		for _, p := range params {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s key distribution %s : %w", name, spec, err)
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+	exponent := func() (float64, error) {
+		v, err := floats(0, 1)
+		if err != nil {
+			return 0, err
+		}
+		if len(v) == 0 {
+			return DefaultZipfExponent, nil
+		}
+		return v[0], nil
+	}
+
+	switch name {
+	case "", "uniform":
+		if _, err := floats(0, 0); err != nil {
+			return nil, err
+		}
+		return &UniformKeyDistribution{}, nil
+	case "zipf":
+		s, err := exponent()
+		if err != nil {
+			return nil, err
+		}
+		return NewZipfKeyDistribution(s)
+	case "hotset":
+		v, err := floats(2, 2)
+		if err != nil {
+			return nil, err
+		}
+		if v[0] <= 0 || v[0] > 100 || v[1] < 0 || v[1] > 100 {
+			return nil, fmt.Errorf("invalid hotset key distribution %s : hot key %% must be in (0, 100] and traffic %% must be in [0, 100]", spec)
+		}
+		return &HotSetKeyDistribution{HotPercent: v[0], TrafficPercent: v[1]}, nil
+	case "sequential":
+		if _, err := floats(0, 0); err != nil {
+			return nil, err
+		}
+		return &SequentialKeyDistribution{}, nil
+	case "latest":
+		s, err := exponent()
+		if err != nil {
+			return nil, err
+		}
+		return NewLatestKeyDistribution(s)
+	default:
+		return nil, fmt.Errorf("invalid key distribution %s : want uniform, zipf, hotset, sequential or latest", spec)
+	}
+}
+
+// WithKeyDistribution is RunnerがPickKeyでkeyを選ぶ時のKeyDistributionを指定する
+// 指定しない場合はuniform
+func WithKeyDistribution(d KeyDistribution) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.keyDistribution = d
+	}
+}
+
+var defaultKeyDistribution KeyDistribution = &UniformKeyDistribution{}
+
+// keyObservation is 1回のRunで選んだkeyと、そのRunで起きたabortを記録する
+// AppRunnnerがRunごとにctxに入れる
+type keyObservation struct {
+	distribution KeyDistribution
+	shard        Shard
+
+	mu        sync.Mutex
+	picked    bool
+	rank      int64
+	aborts    int64
+	abortWait time.Duration
+}
+
+type keyObservationKey struct{}
+
+func withKeyObservation(ctx context.Context, d KeyDistribution, shard Shard) (context.Context, *keyObservation) {
+	if d == nil {
+		d = defaultKeyDistribution
+	}
+	o := &keyObservation{distribution: d, shard: shard}
+	return context.WithValue(ctx, keyObservationKey{}, o), o
+}
+
+func keyObservationFromContext(ctx context.Context) *keyObservation {
+	o, _ := ctx.Value(keyObservationKey{}).(*keyObservation)
+	return o
+}
+
+// PickKey is ctxのRunnerに指定されたKeyDistributionと、workerのrandで [0, n) からkeyを選ぶ
+// AppRunnnerのRun以外から呼ばれた場合はuniformで選ぶ
+// 1回のRunで複数のkeyを選んだ場合は、一番hotなkeyのbucketにRunの結果を記録する
+// RunnerにShardが指定されている場合は、Shard.Range(0, n) の範囲からkeyを選ぶ
+// KeyDistributionはその範囲の中で適用するので、hotなkeyはShardごとに別になる
+func PickKey(ctx context.Context, n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	r := RandFromContext(ctx)
+	o := keyObservationFromContext(ctx)
+	if o == nil {
+		return defaultKeyDistribution.Pick(r, n)
+	}
+	lo, hi := o.shard.Range(0, n)
+	if hi <= lo {
+		// keyの数がShardの数より少なく、このShardの担当がない場合は全体から選ぶ
+		lo, hi = 0, n
+	}
+	key := o.distribution.Pick(r, hi-lo)
+	rank := o.distribution.Rank(key, hi-lo)
+	key += lo
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.picked || rank < o.rank {
+		o.rank = rank
+	}
+	o.picked = true
+	return key
+}
+
+// RecordAbort is ctxのRunでtransactionがabortされたことを記録する
+// waitはabortされるまでにかかった時間. Spannerではlockを待っていてwoundされた時間になる
+// KeyContentionUnaryClientInterceptorなどから呼ばれる
+func RecordAbort(ctx context.Context, wait time.Duration) {
+	o := keyObservationFromContext(ctx)
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.aborts++
+	o.abortWait += wait
+}
+
+// result is Runが終わった後に、bucketとabortの数を返す
+// keyを選ばなかったRunはfalseを返す
+func (o *keyObservation) result() (bucket int, aborts int64, abortWait time.Duration, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.picked {
+		return 0, 0, 0, false
+	}
+	return keyBucket(o.rank), o.aborts, o.abortWait, true
+}
+
+// keyBucket is rankの桁数をbucketにする. 0: rank 0, 1: rank 1~9, 2: rank 10~99 ...
+func keyBucket(rank int64) int {
+	var b int
+	for rank > 0 {
+		b++
+		rank /= 10
+	}
+	return b
+}
+
+// keyBucketLabel is keyBucketの範囲を "10-99" のような文字列で返す
+func keyBucketLabel(bucket int) string {
+	if bucket == 0 {
+		return "0"
+	}
+	lo := int64(1)
+	for i := 1; i < bucket; i++ {
+		lo *= 10
+	}
+	return fmt.Sprintf("%d-%d", lo, lo*10-1)
+}
@@ -0,0 +1,237 @@
+package srunner
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseKeyDistribution(t *testing.T) {
+	cases := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"", "uniform", false},
+		{"uniform", "uniform", false},
+		{"zipf", "zipf,1.1", false},
+		{"zipf,1.5", "zipf,1.5", false},
+		{"hotset,1,90", "hotset,1,90", false},
+		{"sequential", "sequential", false},
+		{"latest,2", "latest,2", false},
+		{"uniform,1", "", true},
+		{"zipf,1", "", true},
+		{"zipf,hoge", "", true},
+		{"hotset,1", "", true},
+		{"hotset,0,90", "", true},
+		{"hotset,1,101", "", true},
+		{"hoge", "", true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseKeyDistribution(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got.String(); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
+
+func TestKeyDistribution_Pick(t *testing.T) {
+	zipf, err := NewZipfKeyDistribution(DefaultZipfExponent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := NewLatestKeyDistribution(DefaultZipfExponent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 1000
+	const count = 10000
+	cases := []struct {
+		name string
+		d    KeyDistribution
+		// minHot is rank 0~9 のkeyが選ばれる割合の下限
+		minHot float64
+	}{
+		{"uniform", &UniformKeyDistribution{}, 0},
+		{"zipf", zipf, 0.3},
+		{"hotset", &HotSetKeyDistribution{HotPercent: 1, TrafficPercent: 90}, 0.85},
+		{"latest", latest, 0.3},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			var hot int
+			for i := 0; i < count; i++ {
+				key := tt.d.Pick(r, n)
+				if key < 0 || key >= n {
+					t.Fatalf("key %d is out of range", key)
+				}
+				if tt.d.Rank(key, n) < 10 {
+					hot++
+				}
+			}
+			if g := float64(hot) / count; g < tt.minHot {
+				t.Errorf("want hot key rate >= %v but got %v", tt.minHot, g)
+			}
+		})
+	}
+}
+
+func TestSequentialKeyDistribution_Pick(t *testing.T) {
+	d := &SequentialKeyDistribution{}
+	for i := 0; i < 7; i++ {
+		if e, g := int64(i%3), d.Pick(nil, 3); e != g {
+			t.Errorf("want %d but got %d", e, g)
+		}
+	}
+}
+
+func TestKeyBucket(t *testing.T) {
+	cases := []struct {
+		rank  int64
+		want  int
+		label string
+	}{
+		{0, 0, "0"},
+		{1, 1, "1-9"},
+		{9, 1, "1-9"},
+		{10, 2, "10-99"},
+		{12345, 5, "10000-99999"},
+	}
+	for _, tt := range cases {
+		if e, g := tt.want, keyBucket(tt.rank); e != g {
+			t.Errorf("rank %d : want bucket %d but got %d", tt.rank, e, g)
+		}
+		if e, g := tt.label, keyBucketLabel(tt.want); e != g {
+			t.Errorf("bucket %d : want label %s but got %s", tt.want, e, g)
+		}
+	}
+}
+
+func TestPickKey_WithoutObservation(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if v := PickKey(context.Background(), 10); v < 0 || v >= 10 {
+			t.Fatalf("key %d is out of range", v)
+		}
+	}
+}
+
+// abortRunner is hot keyを選んだ時だけAbortedで失敗する
+type abortRunner struct{}
+
+func (r *abortRunner) Run(ctx context.Context) error {
+	key := PickKey(ctx, 100)
+	if key == 0 {
+		RecordAbort(ctx, 5*time.Millisecond)
+		return status.Error(codes.Aborted, "aborted")
+	}
+	return nil
+}
+
+func TestAppRunnner_KeyBuckets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 1,
+		WithKeyDistribution(&HotSetKeyDistribution{HotPercent: 1, TrafficPercent: 50}),
+		WithBackoffPolicy(&NoBackoff{}),
+		WithIterations(100))
+	ar.Run(ctx, "Abort", &abortRunner{})
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	v, ok := ar.StatsByFuncName("Abort")
+	if !ok {
+		t.Fatal("Abort stats not found")
+	}
+	var runs int64
+	for _, b := range v.KeyBuckets {
+		runs += b.Runs
+		switch b.Bucket {
+		case "0":
+			if b.Aborts != b.Runs || b.Errors != b.Runs {
+				t.Errorf("want all runs aborted in bucket 0 but got runs=%d aborts=%d errors=%d", b.Runs, b.Aborts, b.Errors)
+			}
+			if e, g := time.Duration(b.Runs)*5*time.Millisecond, b.AbortWait; e != g {
+				t.Errorf("want AbortWait %s but got %s", e, g)
+			}
+		default:
+			if b.Aborts != 0 {
+				t.Errorf("want no aborts in bucket %s but got %d", b.Bucket, b.Aborts)
+			}
+		}
+	}
+	if e, g := v.Count, runs; e != g {
+		t.Errorf("want runs %d but got %d", e, g)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteKeyBucketTable(&buf, []*StatsSnapshot{v}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "AbortWait") {
+		t.Errorf("want header but got %s", buf.String())
+	}
+}
+
+func TestRunnerStats_recordKeys_AbortedWithoutRecord(t *testing.T) {
+	s := NewRunnerStats("Test")
+	_, o := withKeyObservation(context.Background(), &SequentialKeyDistribution{}, NoShard)
+	PickKey(context.WithValue(context.Background(), keyObservationKey{}, o), 10)
+	s.recordKeys(o, 10*time.Millisecond, status.Error(codes.Aborted, "aborted"))
+
+	v := s.Snapshot()
+	if e, g := 1, len(v.KeyBuckets); e != g {
+		t.Fatalf("want %d buckets but got %d", e, g)
+	}
+	if e, g := int64(1), v.KeyBuckets[0].Aborts; e != g {
+		t.Errorf("want Aborts %d but got %d", e, g)
+	}
+	if e, g := 10*time.Millisecond, v.KeyBuckets[0].AbortWait; e != g {
+		t.Errorf("want AbortWait %s but got %s", e, g)
+	}
+}
+
+func TestPickKey_Shard(t *testing.T) {
+	shard := Shard{Index: 1, Count: 4}
+	ctx, _ := withKeyObservation(withRand(context.Background(), rand.New(rand.NewSource(1))), &ZipfKeyDistribution{Exponent: 1.2}, shard)
+	counts := make(map[int64]int)
+	for i := 0; i < 1000; i++ {
+		key := PickKey(ctx, 100)
+		if key < 25 || key >= 50 {
+			t.Fatalf("key %d is out of shard %s range [25, 50)", key, shard)
+		}
+		counts[key]++
+	}
+	// KeyDistributionはShardの範囲の中で適用するので、Shardの先頭が一番hotになる
+	for key, n := range counts {
+		if n > counts[25] {
+			t.Errorf("want key 25 hottest but key %d picked %d > %d", key, n, counts[25])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package srunner
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadProfile is 実行開始からの経過時間に応じて、1secあたりに実行するRunの数を返す
+type LoadProfile interface {
+	Rate(elapsed time.Duration) float64
+}
+
+// ConstantProfile is 常に一定のrateを返す
+type ConstantProfile struct {
+	Base float64
+}
+
+func (p *ConstantProfile) Rate(elapsed time.Duration) float64 {
+	return p.Base
+}
+
+// RampProfile is BaseからToまでDurationをかけて線形にrateを上げる
+// Durationを過ぎた後はToを維持する
+type RampProfile struct {
+	Base     float64
+	To       float64
+	Duration time.Duration
+}
+
+func (p *RampProfile) Rate(elapsed time.Duration) float64 {
+	if p.Duration <= 0 || elapsed >= p.Duration {
+		return p.To
+	}
+	progress := float64(elapsed) / float64(p.Duration)
+	return p.Base + (p.To-p.Base)*progress
+}
+
+// StepProfile is Baseから開始して、Holdごとに Step ずつrateを上げる
+// Maxに到達した後はMaxを維持する。Maxが0の場合は上限なし
+type StepProfile struct {
+	Base float64
+	Step float64
+	Hold time.Duration
+	Max  float64
+}
+
+func (p *StepProfile) Rate(elapsed time.Duration) float64 {
+	if p.Hold <= 0 {
+		return p.Base
+	}
+	steps := float64(elapsed / p.Hold)
+	v := p.Base + p.Step*steps
+	if p.Max > 0 && v > p.Max {
+		return p.Max
+	}
+	return v
+}
+
+// SpikeProfile is 普段はBaseで、Intervalごとに Duration の間だけPeakまでrateを上げる
+type SpikeProfile struct {
+	Base     float64
+	Peak     float64
+	Interval time.Duration
+	Duration time.Duration
+}
+
+func (p *SpikeProfile) Rate(elapsed time.Duration) float64 {
+	if p.Interval <= 0 {
+		return p.Base
+	}
+	// 最初のspikeはIntervalが経過した時点で発生させる
+	if elapsed < p.Interval {
+		return p.Base
+	}
+	if elapsed%p.Interval < p.Duration {
+		return p.Peak
+	}
+	return p.Base
+}
+
+// SineProfile is Baseを中心に Amplitude の振れ幅で Period 周期のsin波を描くrateを返す
+// 昼と夜のtrafficの差を再現するためのもの
+type SineProfile struct {
+	Base      float64
+	Amplitude float64
+	Period    time.Duration
+}
+
+func (p *SineProfile) Rate(elapsed time.Duration) float64 {
+	if p.Period <= 0 {
+		return p.Base
+	}
+	v := p.Base + p.Amplitude*math.Sin(2*math.Pi*float64(elapsed)/float64(p.Period))
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// ParseLoadProfile is $SRUNNER_RUNNERS に指定されたLoadProfileの文字列をParseする
+//
+// baseは $SRUNNER_RUNNERS で指定されたrate
+// specは以下のformatを期待している
+//
+//	constant
+//	ramp,{to},{duration}              e.g. ramp,1000,30m
+//	step,{step},{hold},{max}          e.g. step,100,10m,1000
+//	spike,{peak},{interval},{duration} e.g. spike,500,1h,1m
+//	sine,{amplitude},{period}         e.g. sine,50,24h
+func ParseLoadProfile(base float64, spec string) (LoadProfile, error) {
+	l := strings.Split(spec, ",")
+	name := strings.ToLower(strings.TrimSpace(l[0]))
+	params := l[1:]
+	switch name {
+	case "", "constant":
+		return &ConstantProfile{Base: base}, nil
+	case "ramp":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("invalid ramp profile %s : want ramp,{to},{duration}", spec)
+		}
+		to, err := strconv.ParseFloat(params[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ramp profile %s : %w", spec, err)
+		}
+		d, err := time.ParseDuration(params[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ramp profile %s : %w", spec, err)
+		}
+		return &RampProfile{Base: base, To: to, Duration: d}, nil
+	case "step":
+		if len(params) != 3 {
+			return nil, fmt.Errorf("invalid step profile %s : want step,{step},{hold},{max}", spec)
+		}
+		step, err := strconv.ParseFloat(params[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step profile %s : %w", spec, err)
+		}
+		hold, err := time.ParseDuration(params[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid step profile %s : %w", spec, err)
+		}
+		max, err := strconv.ParseFloat(params[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step profile %s : %w", spec, err)
+		}
+		return &StepProfile{Base: base, Step: step, Hold: hold, Max: max}, nil
+	case "spike":
+		if len(params) != 3 {
+			return nil, fmt.Errorf("invalid spike profile %s : want spike,{peak},{interval},{duration}", spec)
+		}
+		peak, err := strconv.ParseFloat(params[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid spike profile %s : %w", spec, err)
+		}
+		interval, err := time.ParseDuration(params[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid spike profile %s : %w", spec, err)
+		}
+		d, err := time.ParseDuration(params[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid spike profile %s : %w", spec, err)
+		}
+		return &SpikeProfile{Base: base, Peak: peak, Interval: interval, Duration: d}, nil
+	case "sine":
+		if len(params) != 2 {
+			return nil, fmt.Errorf("invalid sine profile %s : want sine,{amplitude},{period}", spec)
+		}
+		amplitude, err := strconv.ParseFloat(params[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sine profile %s : %w", spec, err)
+		}
+		period, err := time.ParseDuration(params[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid sine profile %s : %w", spec, err)
+		}
+		return &SineProfile{Base: base, Amplitude: amplitude, Period: period}, nil
+	default:
+		return nil, fmt.Errorf("unsupported load profile %s", spec)
+	}
+}
@@ -0,0 +1,94 @@
+package srunner
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLoadProfile_Rate(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile LoadProfile
+		elapsed time.Duration
+		want    float64
+	}{
+		{"constant", &ConstantProfile{Base: 10}, time.Hour, 10},
+		{"ramp start", &RampProfile{Base: 0, To: 100, Duration: 10 * time.Minute}, 0, 0},
+		{"ramp middle", &RampProfile{Base: 0, To: 100, Duration: 10 * time.Minute}, 5 * time.Minute, 50},
+		{"ramp after", &RampProfile{Base: 0, To: 100, Duration: 10 * time.Minute}, time.Hour, 100},
+		{"step first", &StepProfile{Base: 10, Step: 10, Hold: time.Minute, Max: 30}, 30 * time.Second, 10},
+		{"step second", &StepProfile{Base: 10, Step: 10, Hold: time.Minute, Max: 30}, 90 * time.Second, 20},
+		{"step max", &StepProfile{Base: 10, Step: 10, Hold: time.Minute, Max: 30}, time.Hour, 30},
+		{"spike before", &SpikeProfile{Base: 10, Peak: 100, Interval: time.Hour, Duration: time.Minute}, 30 * time.Second, 10},
+		{"spike on", &SpikeProfile{Base: 10, Peak: 100, Interval: time.Hour, Duration: time.Minute}, time.Hour + 30*time.Second, 100},
+		{"spike off", &SpikeProfile{Base: 10, Peak: 100, Interval: time.Hour, Duration: time.Minute}, time.Hour + 2*time.Minute, 10},
+		{"sine quarter", &SineProfile{Base: 100, Amplitude: 50, Period: 24 * time.Hour}, 6 * time.Hour, 150},
+		{"sine three quarter", &SineProfile{Base: 100, Amplitude: 50, Period: 24 * time.Hour}, 18 * time.Hour, 50},
+		{"sine not negative", &SineProfile{Base: 10, Amplitude: 50, Period: 24 * time.Hour}, 18 * time.Hour, 0},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.profile.Rate(tt.elapsed)
+			if math.Abs(got-tt.want) > 0.0001 {
+				t.Errorf("want %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseLoadProfile(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		want    LoadProfile
+		wantErr bool
+	}{
+		{"empty", "", &ConstantProfile{Base: 10}, false},
+		{"constant", "constant", &ConstantProfile{Base: 10}, false},
+		{"ramp", "ramp,100,10m", &RampProfile{Base: 10, To: 100, Duration: 10 * time.Minute}, false},
+		{"step", "step,5,1m,50", &StepProfile{Base: 10, Step: 5, Hold: time.Minute, Max: 50}, false},
+		{"spike", "spike,500,1h,1m", &SpikeProfile{Base: 10, Peak: 500, Interval: time.Hour, Duration: time.Minute}, false},
+		{"sine", "sine,5,24h", &SineProfile{Base: 10, Amplitude: 5, Period: 24 * time.Hour}, false},
+		{"ramp missing param", "ramp,100", nil, true},
+		{"invalid duration", "ramp,100,hoge", nil, true},
+		{"unsupported", "hoge", nil, true},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLoadProfile(10, tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error but got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, elapsed := range []time.Duration{0, time.Minute, time.Hour, 7 * time.Hour} {
+				if e, g := tt.want.Rate(elapsed), got.Rate(elapsed); e != g {
+					t.Errorf("elapsed %s: want %v but got %v", elapsed, e, g)
+				}
+			}
+		})
+	}
+}
+
+func TestAppRunnner_LoadProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 10, 1, WithLoadProfile(&ConstantProfile{Base: 30}))
+	ar.Run(ctx, "Count", &countRunner{})
+
+	time.Sleep(50 * time.Millisecond)
+	if e, g := 30.0, ar.Rate(); e != g {
+		t.Errorf("want Rate %v but got %v", e, g)
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/spanner"
 	"github.com/sinmetal/srunner/balance"
+	"github.com/sinmetal/srunner/spannertest"
 	"google.golang.org/api/iterator"
 )
 
@@ -29,15 +29,14 @@ PASS
 func TestLockCancel(t *testing.T) {
 	ctx := context.Background()
 
-	dbName := os.Getenv("SRUNNER_SPANNER_DATABASE_NAME")
-	if dbName == "" {
-		t.Fatal("required $SRUNNER_SPANNER_DATABASE_NAME not set")
-	}
+	// 2つのClientから同じDBにTransactionを実行する
+	dbName := spannertest.SetupDatabase(t, "balance")
 	fmt.Printf("Target DB %s\n", dbName)
 	cli1, err := spanner.NewClient(ctx, dbName)
 	if err != nil {
 		t.Fatalf("spanner.NewClient: %v", err)
 	}
+	defer cli1.Close()
 
 	bs1, err := balance.NewStore(ctx, cli1)
 	if err != nil {
@@ -48,6 +47,7 @@ func TestLockCancel(t *testing.T) {
 	if err != nil {
 		t.Fatalf("spanner.NewClient: %v", err)
 	}
+	defer cli2.Close()
 
 	bs2, err := balance.NewStore(ctx, cli2)
 	if err != nil {
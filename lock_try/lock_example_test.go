@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/spanner"
 	"github.com/google/uuid"
+	"github.com/sinmetal/srunner/spannertest"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/iterator"
 )
@@ -29,17 +29,14 @@ type LockTry struct {
 // 以下のケースだと、LockTry TableのInsertとUserIDを指定したSelectが競合する
 // Userが異なれば、競合しない
 func TestLock(t *testing.T) {
+	// in-memoryのfakeはLockを取らないのでEmulatorが必要
+	spannertest.SkipIfNoEmulator(t)
+
 	ctx := context.Background()
 
-	dbName := os.Getenv("SRUNNER_SPANNER_DATABASE_NAME")
-	if dbName == "" {
-		t.Fatal("required $SRUNNER_SPANNER_DATABASE_NAME not set")
-	}
-	cli, err := spanner.NewClient(ctx, dbName)
-	if err != nil {
-		t.Fatalf("spanner.NewClient: %v", err)
-	}
+	cli := spannertest.Setup(t, "lock_example")
 
+	var err error
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
 		_, err = cli.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
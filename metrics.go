@@ -3,13 +3,12 @@ package srunner
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
+	"sync"
 
-	"contrib.go.opencensus.io/exporter/stackdriver"
-	"go.opencensus.io/stats"
-	"go.opencensus.io/stats/view"
-	"go.opencensus.io/tag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -18,133 +17,100 @@ const (
 	MetricsKindTimeout = "TIMEOUT"
 )
 
-type GenericNodeMonitoredResource struct {
-	Location    string
-	NamespaceId string
-	NodeId      string
-}
+const (
+	// Instrument names for respective OpenTelemetry instruments
+	LogSize = "srunner.log.size"
 
-func NewGenericNodeMonitoredResource(location, namespace, node string) *GenericNodeMonitoredResource {
-	return &GenericNodeMonitoredResource{
-		Location:    location,
-		NamespaceId: namespace,
-		NodeId:      node,
-	}
-}
+	// StatusCount is CountStatusで記録するinstrument. AppRunnnerのRunは srunner.runs にkindとsourceを付けて記録する
+	StatusCount = "srunner.status"
 
-func (mr *GenericNodeMonitoredResource) MonitoredResource() (string, map[string]string) {
-	labels := map[string]string{
-		"location":  mr.Location,
-		"namespace": mr.NamespaceId,
-		"node_id":   mr.NodeId,
-	}
-	return "generic_node", labels
-}
+	// Units are used to define instruments of OpenTelemetry.
+	ByteSizeUnit = "By"
+	CountUnit    = "{count}"
+)
 
-func GetMetricType(v *view.View) string {
-	return fmt.Sprintf("custom.googleapis.com/%s", v.Name)
-}
+var (
+	// KeySource is 計測したRunner. AppRunnnerが記録する場合はRunner名
+	KeySource = attribute.Key("source")
 
-func InitExporter(project string, location string, namespace string, node string, labels *stackdriver.Labels) *stackdriver.Exporter {
-	mr := NewGenericNodeMonitoredResource(location, namespace, node)
-	exporter, err := stackdriver.NewExporter(stackdriver.Options{
-		ProjectID:               project,
-		Location:                location,
-		MonitoredResource:       mr,
-		DefaultMonitoringLabels: labels,
-		GetMetricType:           GetMetricType,
-	})
-	if err != nil {
-		log.Fatal("failed to initialize ")
-	}
-	return exporter
-}
+	// KeyKind is MetricsKindOK, MetricsKindNG, MetricsKindTimeout のいずれか
+	KeyKind = attribute.Key("kind")
 
-const (
-	// OCReportInterval is the interval for OpenCensus to send stats data to
-	// Stackdriver Monitoring via its exporter.
-	// NOTE: this value should not be no less than 1 minute. Detailes are in the doc.
-	// https://cloud.google.com/monitoring/custom-metrics/creating-metrics#writing-ts
-	OCReportInterval = 60 * time.Second
-
-	// Measure namess for respecitive OpenCensus Measure
-	LogSize       = "logsize"
-	RedisStatus   = "redis-status"
-	SpannerStatus = "spanner-status"
-
-	// Units are used to define Measures of OpenCensus.
-	ByteSizeUnit = "byte"
-	CountUnit    = "count"
-
-	// ResouceNamespace is used for the exporter to have resource labels.
-	ResourceNamespace = "sinmetal"
+	// KeyCode is gRPCのcode. AlloyDBの場合はSQLSTATEから変換したcode
+	KeyCode = attribute.Key("code")
 )
 
-var (
-	// KeySource is the key for label in "generic_node",
-	KeySource, _ = tag.NewKey("source")
-
-	KeyKind, _ = tag.NewKey("kind")
-
-	// Measure variables
-	MLogSize            = stats.Int64(LogSize, "logSize", ByteSizeUnit)
-	MRedisStatusCount   = stats.Int64(RedisStatus, "redis status", CountUnit)
-	MSpannerStatusCount = stats.Int64(SpannerStatus, "spanner status", CountUnit)
-
-	RedisStatusCountView = &view.View{
-		Name:        RedisStatus,
-		Description: "redis status count",
-		TagKeys:     []tag.Key{KeySource},
-		Measure:     MRedisStatusCount,
-		Aggregation: view.Count(),
-	}
+// statusMetrics is metrics.goで定義しているOpenTelemetryのinstrument
+type statusMetrics struct {
+	status  metric.Int64Counter
+	logSize metric.Int64Counter
+}
 
-	SpannerStatusCountView = &view.View{
-		Name:        SpannerStatus,
-		Description: "spanner status count",
-		TagKeys:     []tag.Key{KeySource, KeyKind},
-		Measure:     MSpannerStatusCount,
-		Aggregation: view.Count(),
-	}
+var (
+	statusMetricsOnce sync.Once
+	statusMetricsV    *statusMetrics
+)
 
-	LogSizeView = &view.View{
-		Name:        LogSize,
-		Measure:     MLogSize,
-		TagKeys:     []tag.Key{KeySource},
-		Description: "log size",
-		Aggregation: view.Sum(),
-	}
+// getStatusMetrics is internal/trace.Init でSetしたmeterProviderを使うinstrumentを返す
+// otel.SetMeterProviderより前に呼んでも、SetMeterProvider後のMeterProviderに記録される
+func getStatusMetrics() *statusMetrics {
+	statusMetricsOnce.Do(func() {
+		m, err := newStatusMetrics(otel.Meter(MeterName))
+		if err != nil {
+			fmt.Printf("failed create status metrics err=%s\n", err)
+			return
+		}
+		statusMetricsV = m
+	})
+	return statusMetricsV
+}
 
-	LogSizeViews = []*view.View{
-		LogSizeView,
+func newStatusMetrics(meter metric.Meter) (*statusMetrics, error) {
+	status, err := meter.Int64Counter(StatusCount,
+		metric.WithDescription("status count"),
+		metric.WithUnit(CountUnit))
+	if err != nil {
+		return nil, fmt.Errorf("failed create %s : %w", StatusCount, err)
 	}
-
-	StatusViews = []*view.View{
-		RedisStatusCountView,
-		SpannerStatusCountView,
+	logSize, err := meter.Int64Counter(LogSize,
+		metric.WithDescription("log size"),
+		metric.WithUnit(ByteSizeUnit))
+	if err != nil {
+		return nil, fmt.Errorf("failed create %s : %w", LogSize, err)
 	}
-)
+	return &statusMetrics{
+		status:  status,
+		logSize: logSize,
+	}, nil
+}
 
-func InitOpenCensusStats(exporter *stackdriver.Exporter) error {
-	view.SetReportingPeriod(5 * time.Minute)
-	view.RegisterExporter(exporter)
-	if err := view.Register(LogSizeViews...); err != nil {
-		return err
+// MetricsKind is errからMetricsKindOK, MetricsKindNG, MetricsKindTimeout のいずれかを返す
+func MetricsKind(err error) string {
+	if err == nil {
+		return MetricsKindOK
 	}
-	if err := view.Register(StatusViews...); err != nil {
-		return err
+	if ErrorCode(err) == codes.DeadlineExceeded {
+		return MetricsKindTimeout
 	}
+	return MetricsKindNG
+}
 
+// CountStatus is AppRunnner以外で実行した処理の結果を、idとkindで記録する
+// SpannerとAlloyDBのどちらのbackendでも使う
+func CountStatus(ctx context.Context, id string, kind string) error {
+	m := getStatusMetrics()
+	if m == nil {
+		return fmt.Errorf("status metrics is not initialized")
+	}
+	m.status.Add(ctx, 1, metric.WithAttributes(KeySource.String(id), KeyKind.String(kind)))
 	return nil
 }
 
-func CountSpannerStatus(ctx context.Context, id string, kind string) error {
-	ctx, err := tag.New(ctx, tag.Upsert(KeySource, id), tag.Upsert(KeyKind, kind))
-	if err != nil {
-		return err
+// RecordLogSize is idが出力したlogのsizeを記録する
+func RecordLogSize(ctx context.Context, id string, size int64) {
+	m := getStatusMetrics()
+	if m == nil {
+		return
 	}
-
-	stats.Record(ctx,
-		MSpannerStatusCount.M(1))
-	return nil
+	m.logSize.Add(ctx, size, metric.WithAttributes(KeySource.String(id)))
 }
@@ -0,0 +1,29 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMetricsKind(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, MetricsKindOK},
+		{"error", errors.New("failed"), MetricsKindNG},
+		{"deadline", fmt.Errorf("failed : %w", context.DeadlineExceeded), MetricsKindTimeout},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if e, g := tt.want, MetricsKind(tt.err); e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Package migrate is ddl/*.sql, ddl/alloy/*.sql をSpannerかPostgreSQLに適用する
+//
+// 適用したStatementはSchemaHistory Tableに記録し、次に実行した時はまだ適用していないStatementだけを適用する
+// StatementのVersionはfile名とStatementのhashなので、適用済みのStatementを書き換えると別のStatementとして扱う
+// Tableを変更する場合は、CREATE TABLEを書き換えるのではなく、ALTER TABLEを追記する
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sinmetal/srunner/ddl"
+)
+
+// HistoryTableName is 適用したStatementを記録するTable
+const HistoryTableName = "SchemaHistory"
+
+// Statement is DDL fileに含まれる1つのStatement
+type Statement struct {
+	// File is DDL fileのfile名 e.g. balance.sql
+	File string
+
+	// Index is File内で何番目のStatementか
+	Index int
+
+	SQL string
+
+	// Version is File と SQL から作るStatementのID
+	Version string
+}
+
+// HistoryEntry is SchemaHistoryに記録されている適用済みのStatement
+type HistoryEntry struct {
+	Version   string
+	File      string
+	Statement string
+	AppliedAt time.Time
+}
+
+// Target is DDLを適用するDB
+type Target interface {
+	// HistoryTableExists is SchemaHistoryがあるかどうか
+	HistoryTableExists(ctx context.Context) (bool, error)
+
+	// EnsureHistoryTable is SchemaHistoryがなければ作る
+	EnsureHistoryTable(ctx context.Context) error
+
+	// AppliedVersions is SchemaHistoryに記録されているStatementを返す
+	AppliedVersions(ctx context.Context) (map[string]*HistoryEntry, error)
+
+	// Apply is stmtsを順番に適用して、適用できたStatementをSchemaHistoryに記録する
+	Apply(ctx context.Context, stmts []*Statement) error
+
+	// Record is stmtsを適用せずにSchemaHistoryに記録する
+	Record(ctx context.Context, stmts []*Statement) error
+}
+
+// Options is Runの設定
+type Options struct {
+	// DryRun is trueの場合はPlanを作るだけで適用しない
+	DryRun bool
+
+	// Baseline is trueの場合は適用せずにSchemaHistoryに記録する
+	// migrateを使う前に手で作ったDBで使う
+	Baseline bool
+}
+
+// LoadStatements is DDL fileを読んでStatementにする
+// Statementはfilesの順番、file内の順番に並ぶ
+func LoadStatements(dialect ddl.Dialect, files ...string) ([]*Statement, error) {
+	var ret []*Statement
+	for _, fn := range files {
+		sqls, err := ddl.ReadFile(fn, dialect)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(fn)
+		for i, sql := range sqls {
+			ret = append(ret, &Statement{
+				File:    name,
+				Index:   i,
+				SQL:     sql,
+				Version: Version(name, sql),
+			})
+		}
+	}
+	return ret, nil
+}
+
+// Version is fileとsqlからStatementのVersionを作る
+// 空白の違いは同じStatementとして扱う
+func Version(file string, sql string) string {
+	h := sha256.Sum256([]byte(strings.Join(strings.Fields(sql), " ")))
+	return fmt.Sprintf("%s@%s", file, hex.EncodeToString(h[:])[:16])
+}
+
+// Plan is まだ適用していないStatementと、DDL fileからなくなった適用済みのStatement
+type Plan struct {
+	Pending []*Statement
+	Removed []*HistoryEntry
+}
+
+// NewPlan is stmtsとappliedを比べてPlanを作る
+func NewPlan(stmts []*Statement, applied map[string]*HistoryEntry) *Plan {
+	plan := &Plan{}
+	versions := make(map[string]bool)
+	for _, stmt := range stmts {
+		versions[stmt.Version] = true
+		if _, ok := applied[stmt.Version]; !ok {
+			plan.Pending = append(plan.Pending, stmt)
+		}
+	}
+	for version, entry := range applied {
+		if !versions[version] {
+			plan.Removed = append(plan.Removed, entry)
+		}
+	}
+	sort.Slice(plan.Removed, func(i, j int) bool {
+		return plan.Removed[i].Version < plan.Removed[j].Version
+	})
+	return plan
+}
+
+// Empty is 適用するStatementがないかどうか
+func (p *Plan) Empty() bool {
+	return len(p.Pending) == 0
+}
+
+// Write is Planをdiffの形式で書き出す
+// 適用するStatementは + , DDL fileからなくなった適用済みのStatementは - を付ける
+// - のStatementはmigrateでは戻さないので、必要なら手でDROPする
+func (p *Plan) Write(w io.Writer) error {
+	if p.Empty() && len(p.Removed) == 0 {
+		_, err := fmt.Fprintln(w, "schema is up to date")
+		return err
+	}
+	for _, stmt := range p.Pending {
+		if _, err := fmt.Fprintf(w, "+ -- %s\n%s;\n", stmt.Version, prefixLines("+ ", stmt.SQL)); err != nil {
+			return err
+		}
+	}
+	for _, entry := range p.Removed {
+		if _, err := fmt.Fprintf(w, "- -- %s (applied at %s)\n%s;\n", entry.Version, entry.AppliedAt.Format(time.RFC3339), prefixLines("- ", entry.Statement)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "pending=%d removed=%d\n", len(p.Pending), len(p.Removed))
+	return err
+}
+
+func prefixLines(prefix string, v string) string {
+	l := strings.Split(v, "\n")
+	for i := range l {
+		l[i] = prefix + l[i]
+	}
+	return strings.Join(l, "\n")
+}
+
+// Run is stmtsのうち、まだ適用していないStatementをtargetに適用する
+// DryRunの場合は適用せずにPlanを返す. SchemaHistoryも作らず、ない場合はすべてのStatementをPendingにする
+func Run(ctx context.Context, target Target, stmts []*Statement, opts Options) (*Plan, error) {
+	if err := checkDuplicate(stmts); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, target, opts.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	plan := NewPlan(stmts, applied)
+	if opts.DryRun || plan.Empty() {
+		return plan, nil
+	}
+	if opts.Baseline {
+		if err := target.Record(ctx, plan.Pending); err != nil {
+			return nil, fmt.Errorf("failed record baseline : %w", err)
+		}
+		return plan, nil
+	}
+	if err := target.Apply(ctx, plan.Pending); err != nil {
+		return nil, fmt.Errorf("failed apply : %w", err)
+	}
+	return plan, nil
+}
+
+// appliedVersions is SchemaHistoryに記録されているStatementを返す
+// dryRunでない場合は、SchemaHistoryがなければ作る
+func appliedVersions(ctx context.Context, target Target, dryRun bool) (map[string]*HistoryEntry, error) {
+	if dryRun {
+		exists, err := target.HistoryTableExists(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed check %s : %w", HistoryTableName, err)
+		}
+		if !exists {
+			return map[string]*HistoryEntry{}, nil
+		}
+	} else {
+		if err := target.EnsureHistoryTable(ctx); err != nil {
+			return nil, fmt.Errorf("failed ensure %s : %w", HistoryTableName, err)
+		}
+	}
+	applied, err := target.AppliedVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed read %s : %w", HistoryTableName, err)
+	}
+	return applied, nil
+}
+
+// checkDuplicate is 同じfileに同じStatementが2回書かれていないかを確認する
+func checkDuplicate(stmts []*Statement) error {
+	m := make(map[string]*Statement)
+	for _, stmt := range stmts {
+		if v, ok := m[stmt.Version]; ok {
+			return fmt.Errorf("duplicate statement %s : %s[%d] and %s[%d]", stmt.Version, v.File, v.Index, stmt.File, stmt.Index)
+		}
+		m[stmt.Version] = stmt
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinmetal/srunner/ddl"
+)
+
+// fakeTarget is memory上にSchemaHistoryを持つTarget
+type fakeTarget struct {
+	history map[string]*HistoryEntry
+	applied []string
+}
+
+func (t *fakeTarget) HistoryTableExists(ctx context.Context) (bool, error) {
+	return t.history != nil, nil
+}
+
+func (t *fakeTarget) EnsureHistoryTable(ctx context.Context) error {
+	if t.history == nil {
+		t.history = make(map[string]*HistoryEntry)
+	}
+	return nil
+}
+
+func (t *fakeTarget) AppliedVersions(ctx context.Context) (map[string]*HistoryEntry, error) {
+	ret := make(map[string]*HistoryEntry)
+	for k, v := range t.history {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (t *fakeTarget) Apply(ctx context.Context, stmts []*Statement) error {
+	for _, stmt := range stmts {
+		t.applied = append(t.applied, stmt.SQL)
+	}
+	return t.Record(ctx, stmts)
+}
+
+func (t *fakeTarget) Record(ctx context.Context, stmts []*Statement) error {
+	for _, stmt := range stmts {
+		t.history[stmt.Version] = &HistoryEntry{Version: stmt.Version, File: stmt.File, Statement: stmt.SQL, AppliedAt: time.Now()}
+	}
+	return nil
+}
+
+func TestLoadStatements(t *testing.T) {
+	stmts, err := LoadStatements(ddl.GoogleSQL, "../ddl/balance.sql", "../ddl/operation.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) < 3 {
+		t.Fatalf("too few statements %d", len(stmts))
+	}
+	if stmts[0].File != "balance.sql" || stmts[0].Index != 0 || !strings.HasPrefix(stmts[0].SQL, "CREATE TABLE UserAccount") {
+		t.Errorf("unexpected first statement %+v", stmts[0])
+	}
+	last := stmts[len(stmts)-1]
+	if last.File != "operation.sql" {
+		t.Errorf("unexpected last statement %+v", last)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	a := Version("balance.sql", "CREATE TABLE A (\n  ID INT64\n) PRIMARY KEY (ID)")
+	b := Version("balance.sql", "CREATE TABLE A ( ID INT64 ) PRIMARY KEY (ID)")
+	if a != b {
+		t.Errorf("whitespace changed version %s %s", a, b)
+	}
+	if c := Version("balance.sql", "CREATE TABLE B ( ID INT64 ) PRIMARY KEY (ID)"); a == c {
+		t.Errorf("different statements have same version %s", a)
+	}
+	if d := Version("tweet.sql", "CREATE TABLE A ( ID INT64 ) PRIMARY KEY (ID)"); a == d {
+		t.Errorf("different files have same version %s", a)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	v1 := statements(t, "app.sql", "CREATE TABLE A (ID INT64) PRIMARY KEY (ID);\nCREATE TABLE B (ID INT64) PRIMARY KEY (ID);")
+	target := &fakeTarget{}
+
+	plan, err := Run(ctx, target, v1, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Pending) != 2 || len(target.applied) != 0 {
+		t.Fatalf("dry run applied statements pending=%d applied=%d", len(plan.Pending), len(target.applied))
+	}
+	// dry runではSchemaHistoryも作らない
+	if target.history != nil {
+		t.Fatal("dry run created history table")
+	}
+
+	if _, err := Run(ctx, target, v1, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.applied) != 2 {
+		t.Fatalf("want 2 applied but got %d", len(target.applied))
+	}
+
+	// 適用済みのStatementは適用しない
+	v2 := statements(t, "app.sql", "CREATE TABLE A (ID INT64) PRIMARY KEY (ID);\nCREATE TABLE B (ID INT64) PRIMARY KEY (ID);\nALTER TABLE B ADD COLUMN Name STRING(MAX);")
+	plan, err = Run(ctx, target, v2, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Pending) != 1 || len(target.applied) != 3 || !strings.HasPrefix(target.applied[2], "ALTER TABLE B") {
+		t.Errorf("unexpected applied %v", target.applied)
+	}
+
+	// DDL fileからなくなったStatementはRemovedになる
+	plan, err = Run(ctx, target, v2[:2], Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() || len(plan.Removed) != 1 {
+		t.Errorf("unexpected plan pending=%d removed=%d", len(plan.Pending), len(plan.Removed))
+	}
+	var buf bytes.Buffer
+	if err := plan.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "- ALTER TABLE B ADD COLUMN Name STRING(MAX);") {
+		t.Errorf("unexpected diff\n%s", buf.String())
+	}
+}
+
+func TestRun_Baseline(t *testing.T) {
+	ctx := context.Background()
+
+	stmts := statements(t, "app.sql", "CREATE TABLE A (ID INT64) PRIMARY KEY (ID);")
+	target := &fakeTarget{}
+	if _, err := Run(ctx, target, stmts, Options{Baseline: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.applied) != 0 || len(target.history) != 1 {
+		t.Errorf("baseline applied statements applied=%d history=%d", len(target.applied), len(target.history))
+	}
+	plan, err := Run(ctx, target, stmts, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("want empty plan")
+	}
+}
+
+func TestRun_Duplicate(t *testing.T) {
+	stmts := statements(t, "app.sql", "CREATE INDEX X ON A (ID);\nCREATE INDEX X ON A (ID);")
+	if _, err := Run(context.Background(), &fakeTarget{}, stmts, Options{}); err == nil {
+		t.Errorf("want duplicate error")
+	}
+}
+
+func statements(t *testing.T, file string, src string) []*Statement {
+	t.Helper()
+
+	sqls, err := ddl.Split(src, ddl.GoogleSQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []*Statement
+	for i, sql := range sqls {
+		ret = append(ret, &Statement{File: file, Index: i, SQL: sql, Version: Version(file, sql)})
+	}
+	return ret
+}
+
+func TestApplyError(t *testing.T) {
+	stmts := []*Statement{
+		{File: "0001.sql", Index: 0, Version: "0001_0000"},
+		{File: "0001.sql", Index: 1, Version: "0001_0001"},
+	}
+	if err := applyError(stmts, len(stmts), nil); err != nil {
+		t.Errorf("want nil but got %s", err)
+	}
+
+	applyErr := errors.New("failed")
+	err := applyError(stmts, 1, applyErr)
+	if !errors.Is(err, applyErr) || !strings.Contains(err.Error(), "0001_0001") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// すべて適用できたのにWaitが失敗した場合もpanicしない
+	err = applyError(stmts, len(stmts), context.Canceled)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresTarget is PostgreSQL, AlloyDBに適用する
+type PostgresTarget struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresTarget is PostgresTargetを作る
+func NewPostgresTarget(pool *pgxpool.Pool) *PostgresTarget {
+	return &PostgresTarget{pool: pool}
+}
+
+func (t *PostgresTarget) HistoryTableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	// Table名はquoteせずに作っているので、to_regclassも同じく小文字として解決する
+	err := t.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", HistoryTableName).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (t *PostgresTarget) EnsureHistoryTable(ctx context.Context) error {
+	_, err := t.pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    Version text NOT NULL,
+    File text NOT NULL,
+    Statement text NOT NULL,
+    AppliedAt timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (Version)
+)`, HistoryTableName))
+	return err
+}
+
+func (t *PostgresTarget) AppliedVersions(ctx context.Context) (map[string]*HistoryEntry, error) {
+	rows, err := t.pool.Query(ctx, fmt.Sprintf("SELECT Version, File, Statement, AppliedAt FROM %s", HistoryTableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make(map[string]*HistoryEntry)
+	for rows.Next() {
+		var v HistoryEntry
+		if err := rows.Scan(&v.Version, &v.File, &v.Statement, &v.AppliedAt); err != nil {
+			return nil, err
+		}
+		ret[v.Version] = &v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Apply is stmtsを1つのtransactionで適用する
+// PostgreSQLのDDLはtransactionに含められるので、途中で失敗した場合はどのStatementも適用しない
+func (t *PostgresTarget) Apply(ctx context.Context, stmts []*Statement) error {
+	return t.inTx(ctx, stmts, true)
+}
+
+func (t *PostgresTarget) Record(ctx context.Context, stmts []*Statement) error {
+	return t.inTx(ctx, stmts, false)
+}
+
+func (t *PostgresTarget) inTx(ctx context.Context, stmts []*Statement, apply bool) (err error) {
+	tx, err := t.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil && !errors.Is(err2, pgx.ErrTxClosed) {
+				err = fmt.Errorf("rollback: %s : %w", err2, err)
+			}
+		}
+	}()
+
+	insertHistorySQL := fmt.Sprintf("INSERT INTO %s (Version, File, Statement) VALUES (@Version, @File, @Statement)", HistoryTableName)
+	for _, stmt := range stmts {
+		if apply {
+			if _, err := tx.Exec(ctx, stmt.SQL); err != nil {
+				return fmt.Errorf("failed %s[%d] %s : %w", stmt.File, stmt.Index, stmt.Version, err)
+			}
+		}
+		_, err := tx.Exec(ctx, insertHistorySQL, pgx.NamedArgs{
+			"Version":   stmt.Version,
+			"File":      stmt.File,
+			"Statement": stmt.SQL,
+		})
+		if err != nil {
+			return fmt.Errorf("insert history %s : %w", stmt.Version, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
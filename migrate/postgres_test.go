@@ -0,0 +1,52 @@
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinmetal/srunner/ddl"
+	"github.com/sinmetal/srunner/pgtest"
+)
+
+func TestPostgresTarget(t *testing.T) {
+	ctx := context.Background()
+	pool := pgtest.Setup(t)
+	target := NewPostgresTarget(pool)
+
+	stmts, err := LoadStatements(ddl.PostgreSQL, "../ddl/alloy/balance.sql", "../ddl/alloy/operation.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Run(ctx, target, stmts, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Pending) != len(stmts) {
+		t.Errorf("want %d applied but got %d", len(stmts), len(plan.Pending))
+	}
+	if _, err := pool.Exec(ctx, "INSERT INTO Operation (OperationID, OperationName, ElapsedTimeMS) VALUES ('a', 'b', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = Run(ctx, target, stmts, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("want empty plan but pending=%d", len(plan.Pending))
+	}
+
+	// 失敗した場合はどのStatementも適用しない
+	broken := statements(t, "broken.sql", "CREATE TABLE Broken (ID bigint PRIMARY KEY);\nCREATE TABLE Broken (ID bigint PRIMARY KEY);")
+	broken[1].Version = "broken.sql@2"
+	if _, err := Run(ctx, target, broken, Options{}); err == nil {
+		t.Fatal("want error")
+	}
+	applied, err := target.AppliedVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := applied[broken[0].Version]; ok {
+		t.Errorf("failed migration was recorded")
+	}
+}
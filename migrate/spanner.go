@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+)
+
+// SpannerTarget is Spannerに適用する
+// $SPANNER_EMULATOR_HOST が指定されている場合はEmulatorに適用する
+type SpannerTarget struct {
+	dbName string
+	admin  *database.DatabaseAdminClient
+	sc     *spanner.Client
+}
+
+// NewSpannerTarget is SpannerTargetを作る
+// dbName is projects/{PROJECT_ID}/instances/{INSTANCE_ID}/databases/{DATABASE_ID}
+func NewSpannerTarget(ctx context.Context, dbName string) (*SpannerTarget, error) {
+	admin, err := database.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed create database admin client : %w", err)
+	}
+	sc, err := spanner.NewClient(ctx, dbName)
+	if err != nil {
+		admin.Close()
+		return nil, fmt.Errorf("failed create spanner client : %w", err)
+	}
+	return &SpannerTarget{
+		dbName: dbName,
+		admin:  admin,
+		sc:     sc,
+	}, nil
+}
+
+// Close is clientをCloseする
+func (t *SpannerTarget) Close() error {
+	t.sc.Close()
+	return t.admin.Close()
+}
+
+func (t *SpannerTarget) HistoryTableExists(ctx context.Context) (bool, error) {
+	stm := spanner.NewStatement("SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = '' AND TABLE_NAME = @Table")
+	stm.Params = map[string]interface{}{"Table": HistoryTableName}
+	var count int64
+	err := t.sc.Single().Query(ctx, stm).Do(func(row *spanner.Row) error {
+		return row.Columns(&count)
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (t *SpannerTarget) EnsureHistoryTable(ctx context.Context) error {
+	exists, err := t.HistoryTableExists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return t.updateDDL(ctx, []string{fmt.Sprintf(`CREATE TABLE %s (
+    Version STRING(MAX) NOT NULL,
+    File STRING(MAX) NOT NULL,
+    Statement STRING(MAX) NOT NULL,
+    AppliedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true),
+) PRIMARY KEY (Version)`, HistoryTableName)})
+}
+
+func (t *SpannerTarget) AppliedVersions(ctx context.Context) (map[string]*HistoryEntry, error) {
+	stm := spanner.NewStatement(fmt.Sprintf("SELECT Version, File, Statement, AppliedAt FROM %s", HistoryTableName))
+	ret := make(map[string]*HistoryEntry)
+	err := t.sc.Single().Query(ctx, stm).Do(func(row *spanner.Row) error {
+		var v HistoryEntry
+		if err := row.ToStruct(&v); err != nil {
+			return err
+		}
+		ret[v.Version] = &v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Apply is stmtsを1回のUpdateDatabaseDdlで適用する
+// 途中のStatementで失敗した場合も、それまでに適用できたStatementはSchemaHistoryに記録する
+func (t *SpannerTarget) Apply(ctx context.Context, stmts []*Statement) error {
+	var sqls []string
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.SQL)
+	}
+	op, err := t.admin.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   t.dbName,
+		Statements: sqls,
+	})
+	if err != nil {
+		return err
+	}
+	applyErr := op.Wait(ctx)
+
+	applied := len(stmts)
+	if applyErr != nil {
+		applied = 0
+		if meta, err := op.Metadata(); err == nil && meta != nil {
+			applied = min(len(meta.GetCommitTimestamps()), len(stmts))
+		}
+	}
+	if applied > 0 {
+		// Waitがctxの終了で失敗した場合も記録できるように、ctxのcancelは引き継がずにrecordTimeoutで記録する
+		recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+		defer cancel()
+		if err := t.Record(recordCtx, stmts[:applied]); err != nil {
+			return fmt.Errorf("applied %d statements but failed record : %w", applied, err)
+		}
+	}
+	return applyError(stmts, applied, applyErr)
+}
+
+// recordTimeout is Applyで適用できたStatementをSchemaHistoryに記録する時のtimeout
+const recordTimeout = 30 * time.Second
+
+// applyError is stmtsのうちapplied個まで適用できた時のerrorを、失敗したStatementがわかるように返す
+// すべて適用できたのにapplyErrになった場合 (e.g. Waitのctxが終了した) は、Statementを付けずに返す
+func applyError(stmts []*Statement, applied int, applyErr error) error {
+	if applyErr == nil {
+		return nil
+	}
+	if applied >= len(stmts) {
+		return fmt.Errorf("applied all %d statements but failed wait : %w", len(stmts), applyErr)
+	}
+	failed := stmts[applied]
+	return fmt.Errorf("failed %s[%d] %s : %w", failed.File, failed.Index, failed.Version, applyErr)
+}
+
+func (t *SpannerTarget) Record(ctx context.Context, stmts []*Statement) error {
+	var mus []*spanner.Mutation
+	for _, stmt := range stmts {
+		mus = append(mus, spanner.InsertOrUpdate(HistoryTableName,
+			[]string{"Version", "File", "Statement", "AppliedAt"},
+			[]interface{}{stmt.Version, stmt.File, stmt.SQL, spanner.CommitTimestamp}))
+	}
+	_, err := t.sc.Apply(ctx, mus)
+	return err
+}
+
+func (t *SpannerTarget) updateDDL(ctx context.Context, statements []string) error {
+	op, err := t.admin.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   t.dbName,
+		Statements: statements,
+	})
+	if err != nil {
+		return err
+	}
+	return op.Wait(ctx)
+}
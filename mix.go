@@ -0,0 +1,126 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mix is 複数のRunnnerを重みに応じて混ぜて実行するためのもの
+// 1つのAppRunnnerのrateの中で、Runごとに重みに応じてRunnnerを選ぶ
+type Mix struct {
+	entries []*mixEntry
+	total   int
+}
+
+type mixEntry struct {
+	funcName string
+	weight   int
+	runnner  Runnner
+
+	// cumulative is このentryまでの重みの合計
+	cumulative int
+}
+
+// NewMix is 空のMixを作る
+func NewMix() *Mix {
+	return &Mix{}
+}
+
+// Add is funcNameのRunnnerをweightの重みで追加する
+func (m *Mix) Add(funcName string, weight int, runnner Runnner) *Mix {
+	if weight <= 0 {
+		return m
+	}
+	m.total += weight
+	m.entries = append(m.entries, &mixEntry{
+		funcName:   funcName,
+		weight:     weight,
+		runnner:    runnner,
+		cumulative: m.total,
+	})
+	return m
+}
+
+// Len is 追加されているRunnnerの数を返す
+func (m *Mix) Len() int {
+	return len(m.entries)
+}
+
+// Ratio is funcNameが選ばれる割合(0~1)を返す
+func (m *Mix) Ratio(funcName string) float64 {
+	if m.total == 0 {
+		return 0
+	}
+	for _, e := range m.entries {
+		if e.funcName == funcName {
+			return float64(e.weight) / float64(m.total)
+		}
+	}
+	return 0
+}
+
+// Next is 重みに応じてrでRunnnerを1つ選ぶ
+func (m *Mix) Next(r *rand.Rand) (funcName string, runnner Runnner) {
+	e := m.pick(r.Intn(m.total))
+	return e.funcName, e.runnner
+}
+
+func (m *Mix) pick(v int) *mixEntry {
+	i := sort.Search(len(m.entries), func(i int) bool {
+		return m.entries[i].cumulative > v
+	})
+	return m.entries[i]
+}
+
+// RunMix is Mixに含まれるRunnnerを重みに応じて選びながら並行実行を行う
+// 計測結果はRunnnerごとのfuncNameで記録される
+func (ar *AppRunnner) RunMix(ctx context.Context, mixName string, mix *Mix) error {
+	if mix.Len() < 1 {
+		return fmt.Errorf("mix %s is empty", mixName)
+	}
+
+	stats := make(map[string]*RunnerStats)
+	for _, e := range mix.entries {
+		stats[e.funcName] = ar.runnerStats(e.funcName)
+	}
+	ar.run(ctx, mixName, func(r *rand.Rand) (Runnner, *RunnerStats) {
+		funcName, runnner := mix.Next(r)
+		return runnner, stats[funcName]
+	})
+	return nil
+}
+
+// ParseMixWeights is $SRUNNER_MIX に指定された重みの文字列をParseする
+// DEPOSIT=25,DEPOSIT_DML=5,FIND_USER_DEPOSIT_HISTORIES=70 というformatを期待している
+// 重みが0のRunnerは実行しない. すべての重みが0の場合はerrorを返す
+func ParseMixWeights(spec string) (map[string]int, error) {
+	ret := make(map[string]int)
+	var total int
+	for _, v := range strings.Split(spec, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		l := strings.SplitN(v, "=", 2)
+		if len(l) != 2 {
+			return nil, fmt.Errorf("invalid mix weights %s : want {name}={weight}", spec)
+		}
+		weight, err := strconv.Atoi(l[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid mix weights %s : %w", spec, err)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("invalid mix weights %s : weight must not be negative", spec)
+		}
+		ret[l[0]] = weight
+		total += weight
+	}
+	if len(ret) > 0 && total == 0 {
+		return nil, fmt.Errorf("invalid mix weights %s : at least one weight must be positive", spec)
+	}
+	return ret, nil
+}
@@ -0,0 +1,158 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMix_Pick(t *testing.T) {
+	m := NewMix().
+		Add("A", 70, &countRunner{}).
+		Add("B", 25, &countRunner{}).
+		Add("C", 5, &countRunner{}).
+		Add("Zero", 0, &countRunner{})
+
+	if e, g := 3, m.Len(); e != g {
+		t.Errorf("want Len %d but got %d", e, g)
+	}
+
+	cases := []struct {
+		v    int
+		want string
+	}{
+		{0, "A"},
+		{69, "A"},
+		{70, "B"},
+		{94, "B"},
+		{95, "C"},
+		{99, "C"},
+	}
+	for _, tt := range cases {
+		if g := m.pick(tt.v).funcName; tt.want != g {
+			t.Errorf("v=%d: want %s but got %s", tt.v, tt.want, g)
+		}
+	}
+
+	if e, g := 0.25, m.Ratio("B"); math.Abs(e-g) > 0.0001 {
+		t.Errorf("want Ratio %v but got %v", e, g)
+	}
+}
+
+func TestAppRunnner_RunMix(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := &countRunner{}
+	b := &countRunner{}
+	m := NewMix().Add("A", 80, a).Add("B", 20, b)
+
+	ar := NewAppRunner(ctx, 100000, 4, WithIterations(2000))
+	if err := ar.RunMix(ctx, "Mix", m); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ar.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	ac := atomic.LoadInt64(&a.count)
+	bc := atomic.LoadInt64(&b.count)
+	if e, g := int64(2000), ac+bc; e != g {
+		t.Errorf("want total %d but got %d", e, g)
+	}
+	// 誤差を考慮して、AがBより十分多く選ばれていることだけ確認する
+	if ac < bc*2 {
+		t.Errorf("want A(%d) to be selected more than B(%d)", ac, bc)
+	}
+
+	as, ok := ar.StatsByFuncName("A")
+	if !ok {
+		t.Fatal("A stats not found")
+	}
+	if e, g := ac, as.Count; e != g {
+		t.Errorf("want A stats Count %d but got %d", e, g)
+	}
+
+	if err := ar.RunMix(ctx, "Empty", NewMix()); err == nil {
+		t.Errorf("want error for empty mix")
+	}
+}
+
+// recordBackoff is Backoffに渡されたerrorCountを記録して、待たずに次のRunをさせる
+type recordBackoff struct {
+	mu          sync.Mutex
+	errorCounts []int
+}
+
+func (b *recordBackoff) Backoff(r *rand.Rand, err error, errorCount int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errorCounts = append(b.errorCounts, errorCount)
+	return 0
+}
+
+func TestAppRunnner_RunMix_ErrorCountPerFuncName(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	failing := &countRunner{err: errors.New("failed")}
+	m := NewMix().Add("Failing", 50, failing).Add("OK", 50, &countRunner{})
+
+	backoff := &recordBackoff{}
+	ar := NewAppRunner(ctx, 100000, 1, WithIterations(200), WithBackoffPolicy(backoff))
+	if err := ar.RunMix(ctx, "Mix", m); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ar.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// OKが成功しても、Failingの連続エラー回数はリセットされない
+	backoff.mu.Lock()
+	defer backoff.mu.Unlock()
+	if e, g := int(atomic.LoadInt64(&failing.count)), len(backoff.errorCounts); e != g {
+		t.Fatalf("want backoff %d times but got %d", e, g)
+	}
+	for i, g := range backoff.errorCounts {
+		if e := i + 1; e != g {
+			t.Fatalf("want errorCount %d but got %d", e, g)
+		}
+	}
+}
+
+func TestParseMixWeights(t *testing.T) {
+	got, err := ParseMixWeights("FIND_USER_DEPOSIT_HISTORIES=70,DEPOSIT=25,DEPOSIT_DML=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"FIND_USER_DEPOSIT_HISTORIES": 70, "DEPOSIT": 25, "DEPOSIT_DML": 5}
+	for k, v := range want {
+		if g := got[k]; v != g {
+			t.Errorf("%s: want %d but got %d", k, v, g)
+		}
+	}
+
+	// 重みが0のRunnerは実行しないだけ
+	got, err = ParseMixWeights("DEPOSIT=0,DEPOSIT_DML=5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 0, got["DEPOSIT"]; e != g {
+		t.Errorf("want DEPOSIT %d but got %d", e, g)
+	}
+
+	for _, spec := range []string{"DEPOSIT", "DEPOSIT=hoge", "DEPOSIT=-1", "DEPOSIT=0,DEPOSIT_DML=0"} {
+		if _, err := ParseMixWeights(spec); err == nil {
+			t.Errorf("%s: want error", spec)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/google/uuid"
 	"github.com/sinmetal/srunner/internal/trace"
 )
 
@@ -42,6 +43,21 @@ func (s *Store) Insert(ctx context.Context, value *Operation) (ope *Operation, e
 	ct, err := s.sc.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
 		return tx.BufferWrite([]*spanner.Mutation{om})
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed Operation.Insert :%w", err)
+	}
 	value.CommitedAt = ct
 	return value, nil
 }
+
+// Record is operationNameの処理時間をOperation Tableに記録する
+func (s *Store) Record(ctx context.Context, operationName string, elapsed time.Duration) error {
+	_, err := s.Insert(ctx, &Operation{
+		OperationID:   uuid.New().String(),
+		OperationName: operationName,
+		ElapsedTimeMS: elapsed.Milliseconds(),
+		Note:          spanner.NullJSON{},
+		CommitedAt:    spanner.CommitTimestamp,
+	})
+	return err
+}
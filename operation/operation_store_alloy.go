@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/internal/trace"
 )
 
@@ -31,6 +33,13 @@ func (s *StoreAlloy) OperationTable() string {
 	return "Operation"
 }
 
+func (s *StoreAlloy) insertOperationSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (OperationID, OperationName, ElapsedTimeMS, Note)"+
+		" VALUES (@OperationID, @OperationName, @ElapsedTimeMS, @Note)",
+		s.OperationTable(),
+	)
+}
+
 func (s *StoreAlloy) Insert(ctx context.Context, value *OperationAlloy) (ope *OperationAlloy, err error) {
 	ctx, _ = trace.StartSpan(ctx, "OperationStoreAlloy.Insert")
 	defer trace.EndSpan(ctx, err)
@@ -49,12 +58,7 @@ func (s *StoreAlloy) Insert(ctx context.Context, value *OperationAlloy) (ope *Op
 		}
 	}()
 
-	insertOperationSQL :=
-		fmt.Sprintf("INSERT INTO %s (OperationID, OperationName, ElapsedTimeMS, Note)"+
-			" VALUES (@OperationID, @OperationName, @ElapsedTimeMS, @Note)",
-			s.OperationTable(),
-		)
-	_, err = tx.Exec(ctx, insertOperationSQL,
+	_, err = tx.Exec(ctx, s.insertOperationSQL(),
 		pgx.NamedArgs{
 			"OperationID":   value.OperationID,
 			"OperationName": value.OperationName,
@@ -71,3 +75,27 @@ func (s *StoreAlloy) Insert(ctx context.Context, value *OperationAlloy) (ope *Op
 	}
 	return value, nil
 }
+
+// Record is operationNameの処理時間をOperation Tableに記録する
+func (s *StoreAlloy) Record(ctx context.Context, operationName string, elapsed time.Duration) error {
+	_, err := s.Insert(ctx, &OperationAlloy{
+		OperationID:   uuid.New().String(),
+		OperationName: operationName,
+		ElapsedTimeMS: elapsed.Milliseconds(),
+		Note:          "",
+	})
+	return err
+}
+
+// Statements is StoreAlloyが実行するSQLを、実行時と同じ型のParamsで返す
+// srunner.Preflightで負荷をかける前にEXPLAINで確認するために使う
+func (s *StoreAlloy) Statements() []*srunner.Statement {
+	return []*srunner.Statement{
+		{
+			Name:   "OperationAlloy.Insert",
+			SQL:    s.insertOperationSQL(),
+			Params: map[string]interface{}{"OperationID": "", "OperationName": "", "ElapsedTimeMS": int64(0), "Note": ""},
+			DML:    true,
+		},
+	}
+}
@@ -0,0 +1,28 @@
+package operation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinmetal/srunner/pgtest"
+)
+
+func TestStoreAlloy_Record(t *testing.T) {
+	ctx := context.Background()
+	pool := pgtest.Setup(t, "../ddl/alloy/operation.sql")
+	s := NewStoreAlloy(pool)
+
+	if err := s.Record(ctx, "BalanceStore.Deposit", 12*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	var elapsed int64
+	err := pool.QueryRow(ctx, "SELECT OperationName, ElapsedTimeMS FROM Operation").Scan(&name, &elapsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "BalanceStore.Deposit" || elapsed != 12 {
+		t.Errorf("unexpected operation name=%s elapsed=%d", name, elapsed)
+	}
+}
@@ -0,0 +1,23 @@
+package srunner
+
+import (
+	"context"
+)
+
+type runnerStatsKey struct{}
+
+// withRunnerStats is RunのctxにRunの結果を記録するRunnerStatsを入れる
+func withRunnerStats(ctx context.Context, stats *RunnerStats) context.Context {
+	return context.WithValue(ctx, runnerStatsKey{}, stats)
+}
+
+// RecordOutcome is ctxのRunの中で起きたことを、Runの成功・失敗とは別にoutcomeごとに数える
+// e.g. balanceのDepositRunnerが、transaction outcome unknownになったDepositを確認した結果を数える
+// AppRunnnerのRun以外から呼ばれた場合は何もしない
+func RecordOutcome(ctx context.Context, outcome string) {
+	stats, ok := ctx.Value(runnerStatsKey{}).(*RunnerStats)
+	if !ok {
+		return
+	}
+	stats.RecordOutcome(outcome)
+}
@@ -0,0 +1,51 @@
+package srunner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type outcomeRunner struct{}
+
+func (r *outcomeRunner) Run(ctx context.Context) error {
+	RecordOutcome(ctx, "unknown")
+	RecordOutcome(ctx, "resolved-committed")
+	return nil
+}
+
+func TestRecordOutcome(t *testing.T) {
+	ctx := context.Background()
+
+	// AppRunnnerのRun以外から呼ばれても何もしない
+	RecordOutcome(ctx, "unknown")
+
+	ar := NewAppRunner(ctx, 1000, 2, WithIterations(10))
+	ar.Run(ctx, "Test.Outcome", &outcomeRunner{})
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	v, ok := ar.StatsByFuncName("Test.Outcome")
+	if !ok {
+		t.Fatal("Test.Outcome stats not found")
+	}
+	if e, g := int64(10), v.Outcomes["unknown"]; e != g {
+		t.Errorf("want unknown %d but got %d", e, g)
+	}
+	if e, g := int64(10), v.Outcomes["resolved-committed"]; e != g {
+		t.Errorf("want resolved-committed %d but got %d", e, g)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteOutcomeTable(&buf, []*StatsSnapshot{v}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "resolved-committed") {
+		t.Errorf("want outcome but got %s", buf.String())
+	}
+}
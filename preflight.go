@@ -0,0 +1,280 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/api/iterator"
+)
+
+// Statement is StoreがRuntimeに実行するSQL
+// Preflightで負荷をかける前に正しいSQLかを確認するために、StoreはStatementsで公開する
+type Statement struct {
+	// Name is Reportに表示する名前 e.g. Tweet.QueryHeavy
+	Name string
+
+	SQL string
+
+	// Params is 実行時と同じ型のsampleの値
+	// SpannerではStatement.Params, PostgreSQLではpgx.NamedArgsとして渡す
+	Params map[string]interface{}
+
+	// DML is INSERT, UPDATE, DELETEの場合はtrue
+	DML bool
+}
+
+// NewSpannerStatement is spanner.StatementからStatementを作る
+func NewSpannerStatement(name string, stmt spanner.Statement, dml bool) *Statement {
+	return &Statement{
+		Name:   name,
+		SQL:    stmt.SQL,
+		Params: stmt.Params,
+		DML:    dml,
+	}
+}
+
+// StatementsFunc is Runnerが使うStoreのStatementを返す
+type StatementsFunc func(ctx context.Context, env *RunnerEnv) ([]*Statement, error)
+
+// RegisterStatements is RegisterRunnerで登録したRunnerが使うStatementを登録する
+// 登録していないRunnerを指定するとpanicする
+func RegisterStatements(backend Backend, name string, fn StatementsFunc) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	reg, ok := registry.runners[backend][name]
+	if !ok {
+		panic(fmt.Sprintf("runner %s/%s is not registered", backend, name))
+	}
+	reg.Statements = fn
+}
+
+// PreflightResult is 1つのStatementを確認した結果
+type PreflightResult struct {
+	Statement *Statement
+
+	// Err is 正しくないStatementの場合にDBが返したerror
+	Err error
+}
+
+// PreflightReport is Preflightの結果
+type PreflightReport struct {
+	Backend Backend
+	Results []*PreflightResult
+}
+
+// Invalid is 正しくなかったStatementの結果を返す
+func (r *PreflightReport) Invalid() []*PreflightResult {
+	var ret []*PreflightResult
+	for _, v := range r.Results {
+		if v.Err != nil {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// OK is すべてのStatementが正しい場合にtrueを返す
+func (r *PreflightReport) OK() bool {
+	return len(r.Invalid()) == 0
+}
+
+// Err is 正しくないStatementがある場合に、その一覧をerrorとして返す
+func (r *PreflightReport) Err() error {
+	invalid := r.Invalid()
+	if len(invalid) == 0 {
+		return nil
+	}
+	var names []string
+	for _, v := range invalid {
+		names = append(names, v.Statement.Name)
+	}
+	return fmt.Errorf("preflight found %d invalid statements : %s", len(invalid), strings.Join(names, ", "))
+}
+
+// Write is PreflightReportをwに書き出す. 正しくないStatementはSQLとerrorも書き出す
+func (r *PreflightReport) Write(w io.Writer) error {
+	invalid := r.Invalid()
+	_, err := fmt.Fprintf(w, "preflight backend=%s statements=%d invalid=%d\n", r.Backend, len(r.Results), len(invalid))
+	if err != nil {
+		return err
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "Name\tError\t"); err != nil {
+		return err
+	}
+	for _, v := range invalid {
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t\n", v.Statement.Name, oneLine(v.Err.Error())); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, v := range invalid {
+		if _, err := fmt.Fprintf(w, "--- %s\n%s\n", v.Statement.Name, strings.TrimSpace(v.Statement.SQL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Preflight is Scenarioに書かれているRunnerが使うStatementを、負荷をかける前にDBに確認させる
+// SpannerはQueryMode PLAN, PostgreSQLはEXPLAINで実行するので、Rowは読み書きしない
+// 同じNameのStatementは1回だけ確認する
+func (s *Scenario) Preflight(ctx context.Context, env *RunnerEnv) (*PreflightReport, error) {
+	var names []string
+	for _, r := range s.Runners {
+		if r.Name != MixRunnerName {
+			names = append(names, r.Name)
+			continue
+		}
+		for name := range r.Mix {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var stmts []*Statement
+	checkedRunners := make(map[string]bool)
+	checkedStatements := make(map[string]bool)
+	for _, name := range names {
+		reg, ok := LookupRunner(s.Target.Backend, name)
+		if !ok {
+			return nil, fmt.Errorf("runner %s/%s is not registered", s.Target.Backend, name)
+		}
+		if reg.Statements == nil || checkedRunners[name] {
+			continue
+		}
+		checkedRunners[name] = true
+
+		v, err := reg.Statements(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed statements of %s : %w", name, err)
+		}
+		for _, stmt := range v {
+			if checkedStatements[stmt.Name] {
+				continue
+			}
+			checkedStatements[stmt.Name] = true
+			stmts = append(stmts, stmt)
+		}
+	}
+	return Preflight(ctx, env, s.Target.Backend, stmts)
+}
+
+// RunPreflight is $SRUNNER_PREFLIGHT=false でなければ、ScenarioのRunnerが使うStatementを確認して結果をwに書き出す
+// 正しくないStatementがある場合はerrorを返すので、cmd/serverは負荷をかけずに終了する
+func RunPreflight(ctx context.Context, s *Scenario, env *RunnerEnv, w io.Writer) error {
+	if os.Getenv("SRUNNER_PREFLIGHT") == "false" {
+		return nil
+	}
+	report, err := s.Preflight(ctx, env)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(w); err != nil {
+		return fmt.Errorf("failed write preflight report : %w", err)
+	}
+	return report.Err()
+}
+
+// Preflight is stmtsをbackendに確認させる
+func Preflight(ctx context.Context, env *RunnerEnv, backend Backend, stmts []*Statement) (*PreflightReport, error) {
+	var check func(ctx context.Context, stmt *Statement) error
+	switch backend {
+	case BackendSpanner:
+		if env.Spanner == nil {
+			return nil, fmt.Errorf("spanner client is required")
+		}
+		check = func(ctx context.Context, stmt *Statement) error {
+			return planSpannerStatement(ctx, env.Spanner, stmt)
+		}
+	case BackendAlloyDB:
+		if env.AlloyDB == nil {
+			return nil, fmt.Errorf("alloydb pool is required")
+		}
+		check = func(ctx context.Context, stmt *Statement) error {
+			return explainPostgresStatement(ctx, env.AlloyDB, stmt)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backend %s", backend)
+	}
+
+	report := &PreflightReport{Backend: backend}
+	for _, stmt := range stmts {
+		err := check(ctx, stmt)
+		if err != nil && ctx.Err() != nil {
+			return nil, fmt.Errorf("failed preflight %s : %w", stmt.Name, err)
+		}
+		report.Results = append(report.Results, &PreflightResult{
+			Statement: stmt,
+			Err:       err,
+		})
+	}
+	return report, nil
+}
+
+// errPreflightRollback is DMLのPLANを確認したReadWriteTransactionをRollbackさせるためのerror
+var errPreflightRollback = errors.New("preflight rollback")
+
+// planSpannerStatement is QueryMode PLANでstmtを実行する
+// DMLはReadWriteTransactionの中で実行し、CommitせずにRollbackする
+func planSpannerStatement(ctx context.Context, sc *spanner.Client, stmt *Statement) error {
+	mode := spannerpb.ExecuteSqlRequest_PLAN
+	st := spanner.Statement{SQL: stmt.SQL, Params: stmt.Params}
+
+	if stmt.DML {
+		_, err := sc.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			if _, err := tx.UpdateWithOptions(ctx, st, spanner.QueryOptions{Mode: &mode}); err != nil {
+				return err
+			}
+			return errPreflightRollback
+		})
+		if errors.Is(err, errPreflightRollback) {
+			return nil
+		}
+		return err
+	}
+
+	iter := sc.Single().QueryWithOptions(ctx, st, spanner.QueryOptions{Mode: &mode})
+	defer iter.Stop()
+	for {
+		_, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// explainPostgresStatement is EXPLAINでstmtのplanを作らせる. ANALYZEは付けないのでstmtは実行されない
+func explainPostgresStatement(ctx context.Context, pool *pgxpool.Pool, stmt *Statement) error {
+	rows, err := pool.Query(ctx, "EXPLAIN "+stmt.SQL, pgx.NamedArgs(stmt.Params))
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// oneLine is 改行を含むerror messageを1行にする
+func oneLine(v string) string {
+	return strings.Join(strings.Fields(v), " ")
+}
@@ -0,0 +1,145 @@
+package srunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+func init() {
+	RegisterRunner(BackendSpanner, "TEST_SQL", "Test.SQL", func(ctx context.Context, env *RunnerEnv, spec *RunnerSpec) (Runnner, error) {
+		return &countRunner{}, nil
+	})
+	RegisterStatements(BackendSpanner, "TEST_SQL", func(ctx context.Context, env *RunnerEnv) ([]*Statement, error) {
+		return []*Statement{
+			{Name: "Test.Select", SQL: "SELECT UserID, Amount FROM UserBalance WHERE UserID = @UserID", Params: map[string]interface{}{"UserID": ""}},
+			{Name: "Test.MissingColumn", SQL: "SELECT UserID, Balance FROM UserBalance"},
+		}, nil
+	})
+}
+
+func TestPreflight_Spanner(t *testing.T) {
+	ctx := context.Background()
+	sc := spannertest.Setup(t, "balance")
+
+	stmts := []*Statement{
+		{Name: "Select", SQL: "SELECT UserID, Amount FROM UserBalance WHERE UserID = @UserID", Params: map[string]interface{}{"UserID": ""}},
+		{Name: "MissingTable", SQL: "SELECT UserID FROM UserBalances"},
+		{Name: "Update", SQL: "UPDATE UserBalance SET Amount = Amount + @Amount WHERE UserID = @UserID", Params: map[string]interface{}{"UserID": "", "Amount": int64(1)}, DML: true},
+		{Name: "MissingColumnDML", SQL: "UPDATE UserBalance SET Balance = 1 WHERE UserID = @UserID", Params: map[string]interface{}{"UserID": ""}, DML: true},
+	}
+	report, err := Preflight(ctx, &RunnerEnv{Spanner: sc}, BackendSpanner, stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := len(stmts), len(report.Results); e != g {
+		t.Fatalf("want %d results but got %d", e, g)
+	}
+	var invalid []string
+	for _, v := range report.Invalid() {
+		invalid = append(invalid, v.Statement.Name)
+	}
+	if e, g := []string{"MissingTable", "MissingColumnDML"}, invalid; !reflect.DeepEqual(e, g) {
+		t.Errorf("want invalid %q but got %q", e, g)
+	}
+	if report.OK() {
+		t.Error("want not OK")
+	}
+}
+
+func TestScenario_Preflight(t *testing.T) {
+	ctx := context.Background()
+	sc := spannertest.Setup(t, "balance")
+
+	s := &Scenario{
+		Target: Target{Backend: BackendSpanner},
+		Runners: []*RunnerSpec{
+			{Name: "TEST_COUNT"},
+			{Name: MixRunnerName, Mix: map[string]int{"TEST_SQL": 1, "TEST_COUNT": 1}},
+			{Name: "TEST_SQL"},
+		},
+	}
+	report, err := s.Preflight(ctx, &RunnerEnv{Spanner: sc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TEST_SQLは2回書かれているが、Statementは1回だけ確認する
+	if e, g := 2, len(report.Results); e != g {
+		t.Fatalf("want %d results but got %d", e, g)
+	}
+	err = report.Err()
+	if err == nil || !strings.Contains(err.Error(), "Test.MissingColumn") {
+		t.Errorf("want error with Test.MissingColumn but got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"statements=2 invalid=1", "Test.MissingColumn", "--- Test.MissingColumn\nSELECT UserID, Balance FROM UserBalance"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in report\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestPreflightReport_OK(t *testing.T) {
+	report := &PreflightReport{
+		Backend: BackendAlloyDB,
+		Results: []*PreflightResult{{Statement: &Statement{Name: "Select", SQL: "SELECT 1"}}},
+	}
+	if !report.OK() {
+		t.Error("want OK")
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("want nil but got %v", err)
+	}
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "preflight backend=alloydb statements=1 invalid=0\n", buf.String(); e != g {
+		t.Errorf("want %q but got %q", e, g)
+	}
+
+	report.Results = append(report.Results, &PreflightResult{Statement: &Statement{Name: "Broken", SQL: "SELEC 1"}, Err: errors.New("syntax error\nat or near SELEC")})
+	buf.Reset()
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "syntax error at or near SELEC") {
+		t.Errorf("want one line error in report\n%s", buf.String())
+	}
+}
+
+func TestRunPreflight(t *testing.T) {
+	ctx := context.Background()
+	sc := spannertest.Setup(t, "balance")
+
+	s := &Scenario{
+		Target:  Target{Backend: BackendSpanner},
+		Runners: []*RunnerSpec{{Name: "TEST_SQL"}},
+	}
+	var buf bytes.Buffer
+	if err := RunPreflight(ctx, s, &RunnerEnv{Spanner: sc}, &buf); err == nil {
+		t.Errorf("want error")
+	}
+	if !strings.Contains(buf.String(), "Test.MissingColumn") {
+		t.Errorf("want report but got %s", buf.String())
+	}
+
+	// $SRUNNER_PREFLIGHT=false の場合は確認しない
+	t.Setenv("SRUNNER_PREFLIGHT", "false")
+	buf.Reset()
+	if err := RunPreflight(ctx, s, &RunnerEnv{Spanner: sc}, &buf); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want no report but got %s", buf.String())
+	}
+}
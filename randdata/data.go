@@ -2,23 +2,26 @@ package randdata
 
 import "math/rand"
 
-func GetAuthor() string {
+// GetAuthor is rでAuthorを1つ選ぶ
+func GetAuthor(r *rand.Rand) string {
 	c := []string{"gold", "silver", "dia", "ruby", "sapphire"}
-	return c[rand.Intn(len(c))]
+	return c[r.Intn(len(c))]
 }
 
-func GetAuthors() []string {
-	exists := make(map[string]string)
-
-	count := rand.Intn(4)
-	for i := 0; i < count; i++ {
-		a := GetAuthor()
-		exists[a] = a
-	}
+// GetAuthors is rで0~3人のAuthorを選ぶ. 同じAuthorは1回だけ含まれる
+// mapの順番に左右されないように、GetAuthorで選んだ順に返す
+func GetAuthors(r *rand.Rand) []string {
+	exists := make(map[string]bool)
 
 	authors := []string{}
-	for k, _ := range exists {
-		authors = append(authors, k)
+	count := r.Intn(4)
+	for i := 0; i < count; i++ {
+		a := GetAuthor(r)
+		if exists[a] {
+			continue
+		}
+		exists[a] = true
+		authors = append(authors, a)
 	}
 	return authors
 }
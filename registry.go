@@ -0,0 +1,99 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sinmetal/srunner/internal/alloy"
+)
+
+// Backend is Runnerが負荷をかける対象のDB
+type Backend string
+
+const (
+	BackendSpanner Backend = "spanner"
+	BackendAlloyDB Backend = "alloydb"
+)
+
+// RunnerEnv is RunnerFactoryがRunnnerを作る時に使うClientなど
+type RunnerEnv struct {
+	Spanner             *spanner.Client
+	AlloyDB             *pgxpool.Pool
+	AlloyDBReadReplicas *alloy.ReplicaSet
+}
+
+// RunnerFactory is RunnerSpecからRunnnerを作る
+type RunnerFactory func(ctx context.Context, env *RunnerEnv, spec *RunnerSpec) (Runnner, error)
+
+// RunnerRegistration is Registryに登録されるRunnerの情報
+type RunnerRegistration struct {
+	// Name is $SRUNNER_RUNNERS やScenarioで指定する名前 e.g. DEPOSIT
+	Name string
+
+	// FuncName is 計測結果などに表示する名前 e.g. Balance.Deposit
+	FuncName string
+
+	Backend Backend
+	Factory RunnerFactory
+
+	// Statements is RegisterStatementsで登録された、Runnerが使うStoreのStatementを返すfunc
+	// SQLを使わないRunnerはnil
+	Statements StatementsFunc
+}
+
+var registry = struct {
+	mu      sync.RWMutex
+	runners map[Backend]map[string]*RunnerRegistration
+}{
+	runners: make(map[Backend]map[string]*RunnerRegistration),
+}
+
+// RegisterRunner is Runnerを登録する
+// 各packageのinit()から呼ばれることを想定している。同じBackendとNameで2回登録するとpanicする
+func RegisterRunner(backend Backend, name string, funcName string, factory RunnerFactory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	m, ok := registry.runners[backend]
+	if !ok {
+		m = make(map[string]*RunnerRegistration)
+		registry.runners[backend] = m
+	}
+	if _, ok := m[name]; ok {
+		panic(fmt.Sprintf("runner %s/%s is already registered", backend, name))
+	}
+	m[name] = &RunnerRegistration{
+		Name:     name,
+		FuncName: funcName,
+		Backend:  backend,
+		Factory:  factory,
+	}
+}
+
+// LookupRunner is 登録されているRunnerを返す
+func LookupRunner(backend Backend, name string) (*RunnerRegistration, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	v, ok := registry.runners[backend][name]
+	return v, ok
+}
+
+// RegisteredRunners is backendに登録されているRunnerの一覧をName順に返す
+func RegisteredRunners(backend Backend) []*RunnerRegistration {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	var ret []*RunnerRegistration
+	for _, v := range registry.runners[backend] {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
@@ -0,0 +1,69 @@
+package srunner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultDrainTimeout is Shutdown時に実行中のRunが終わるのを待つ時間のdefault値
+const DefaultDrainTimeout = 30 * time.Second
+
+// RunMode is AppRunnnerをいつまで動かすかの設定
+// DurationもIterationsも0の場合はsignalを受け取るまで動き続ける
+type RunMode struct {
+	Duration     time.Duration
+	Iterations   int64
+	DrainTimeout time.Duration
+}
+
+// RunModeFromEnv is 環境変数からRunModeを作る
+//
+//	SRUNNER_RUN_DURATION   e.g. 30m
+//	SRUNNER_RUN_ITERATIONS e.g. 100000
+//	SRUNNER_DRAIN_TIMEOUT  e.g. 30s
+func RunModeFromEnv() (*RunMode, error) {
+	m := &RunMode{
+		DrainTimeout: DefaultDrainTimeout,
+	}
+	if v := os.Getenv("SRUNNER_RUN_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_RUN_DURATION %s : %w", v, err)
+		}
+		m.Duration = d
+	}
+	if v := os.Getenv("SRUNNER_RUN_ITERATIONS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_RUN_ITERATIONS %s : %w", v, err)
+		}
+		m.Iterations = n
+	}
+	if v := os.Getenv("SRUNNER_DRAIN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_DRAIN_TIMEOUT %s : %w", v, err)
+		}
+		m.DrainTimeout = d
+	}
+	return m, nil
+}
+
+// Bounded is DurationかIterationsが指定されていて、signalを待たずに終了するかどうか
+func (m *RunMode) Bounded() bool {
+	return m.Duration > 0 || m.Iterations > 0
+}
+
+// Options is RunModeをAppRunnerOptionに変換する
+func (m *RunMode) Options() []AppRunnerOption {
+	var opts []AppRunnerOption
+	if m.Duration > 0 {
+		opts = append(opts, WithDuration(m.Duration))
+	}
+	if m.Iterations > 0 {
+		opts = append(opts, WithIterations(m.Iterations))
+	}
+	return opts
+}
@@ -2,8 +2,13 @@ package srunner
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -13,46 +18,562 @@ type Runnner interface {
 	Run(ctx context.Context) error
 }
 
+// loadProfileInterval is LoadProfileに従ってrateを変更する間隔
+const loadProfileInterval = 1 * time.Second
+
+// minLoadProfileRate is LoadProfileが0以下のrateを返した時に使うrate
+// rate.Limiterのlimitを0にすると、Waitがエラーを返し続けるので、極小の値にしておく
+const minLoadProfileRate = 0.1
+
+// ErrDrainTimeout is Drainのtimeoutまでに実行中のRunが終わらなかった
+var ErrDrainTimeout = errors.New("drain timeout")
+
+// ErrStopped is Stop済みのAppRunnnerを操作しようとした
+var ErrStopped = errors.New("runner is stopped")
+
 type AppRunnner struct {
+	name        string
 	parallelism int
 	limiter     *rate.Limiter
+	loadProfile LoadProfile
+	backoff     BackoffPolicy
+	duration    time.Duration
+	iterations  int64
+	arrival     ArrivalProcess
+
+	// keyDistribution is RunnerがPickKeyでkeyを選ぶ時のKeyDistribution. nilの場合はuniform
+	keyDistribution KeyDistribution
+
+	// seed is workerごとの *rand.Rand を作る時のseed
+	seed int64
+
+	// shard is PickKeyでkeyを選ぶ範囲. 指定しない場合はNoShard
+	shard Shard
+
+	// stopCtx is Stopが呼ばれるとcancelされる。新しいRunを開始するかどうかの判定に使う
+	stopCtx  context.Context
+	stop     context.CancelFunc
+	started  int64
+	wg       sync.WaitGroup
+	done     chan struct{}
+	doneOnce sync.Once
+
+	startOnce sync.Once
+
+	// dropped is open-loopでBacklogが溢れて開始しなかったRunの数
+	dropped int64
+
+	// schedulers is open-loopで動いているscheduleの数. Rateをscheduleの間で分ける
+	schedulers int64
+
+	// rateOverridden is OverrideRateが呼ばれたら1になり、以降LoadProfileを適用しない
+	rateOverridden int32
+
+	workersMu sync.Mutex
+	groups    []*workerGroup
+
+	// resume is Pause中はnon nilで、Resumeでcloseされる
+	pauseMu sync.Mutex
+	resume  chan struct{}
+
+	statsMu sync.Mutex
+	stats   map[string]*RunnerStats
+}
+
+// workerGroup is 1回のrunで起動したworkerの集まり
+// SetParallelismでworkerを増減させる時に使う
+type workerGroup struct {
+	ctx  context.Context
+	name string
+	next func(r *rand.Rand) (Runnner, *RunnerStats)
+
+	// workers is これまでに起動したworkerの数. workerのrandのseedに使う
+	workers int
+
+	// quits is workerごとの終了通知。closeするとそのworkerは次のRunを開始せずに終了する
+	quits []chan struct{}
+
+	// arrivals is open-loopの場合に、開始予定時刻を過ぎたRunの開始予定時刻が入る
+	arrivals chan time.Time
+}
+
+// AppRunnerOption is NewAppRunnerに渡すOption
+type AppRunnerOption func(ar *AppRunnner)
+
+// WithName is AppRunnnerの名前を指定する
+// ControlServerでAppRunnnerを指定する時に使う
+func WithName(name string) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.name = name
+	}
 }
 
-func NewAppRunner(ctx context.Context, ratePerSec int, parallelism int) *AppRunnner {
+// WithLoadProfile is 時間経過に応じてrateを変更するLoadProfileを指定する
+func WithLoadProfile(profile LoadProfile) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.loadProfile = profile
+	}
+}
+
+// WithBackoffPolicy is Runが失敗した後に待つ時間を決めるBackoffPolicyを指定する
+// 指定しない場合はDefaultBackoffPolicyを使う
+func WithBackoffPolicy(policy BackoffPolicy) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.backoff = policy
+	}
+}
+
+// WithDuration is 指定した時間が経過したら新しいRunの開始を止める
+func WithDuration(d time.Duration) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.duration = d
+	}
+}
+
+// WithIterations is 全workerの合計でn回Runを開始したら、新しいRunの開始を止める
+func WithIterations(n int64) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.iterations = n
+	}
+}
+
+func NewAppRunner(ctx context.Context, ratePerSec int, parallelism int, opts ...AppRunnerOption) *AppRunnner {
 	n := rate.Every(time.Second / time.Duration(ratePerSec))
-	return &AppRunnner{
+	stopCtx, stop := context.WithCancel(ctx)
+	ar := &AppRunnner{
 		parallelism: parallelism,
 		limiter:     rate.NewLimiter(n, ratePerSec),
+		backoff:     DefaultBackoffPolicy,
+		stopCtx:     stopCtx,
+		stop:        stop,
+		done:        make(chan struct{}),
+		stats:       make(map[string]*RunnerStats),
+		shard:       NoShard,
+	}
+	for _, opt := range opts {
+		opt(ar)
+	}
+	if ar.seed == 0 {
+		ar.seed = newSeed()
 	}
+	return ar
 }
 
 // Run is 並行実行を行う
 func (ar *AppRunnner) Run(ctx context.Context, funcName string, runnner Runnner) {
+	stats := ar.runnerStats(funcName)
+	ar.run(ctx, funcName, func(r *rand.Rand) (Runnner, *RunnerStats) {
+		return runnner, stats
+	})
+}
+
+// run is nextで次に実行するRunnnerを選びながら、parallelismの数だけworkerを起動する
+// WithArrivalが指定されている場合は、開始予定時刻を決めるschedulerも起動する
+func (ar *AppRunnner) run(ctx context.Context, name string, next func(r *rand.Rand) (Runnner, *RunnerStats)) {
+	ar.startOnce.Do(func() {
+		if ar.loadProfile != nil {
+			go ar.applyLoadProfile(ar.stopCtx, time.Now())
+		}
+		if ar.duration > 0 {
+			time.AfterFunc(ar.duration, ar.Stop)
+		}
+	})
+
+	g := &workerGroup{
+		ctx:  ctx,
+		name: name,
+		next: next,
+	}
+	if ar.arrival != nil {
+		g.arrivals = make(chan time.Time, openLoopQueueSize)
+	}
+	ar.workersMu.Lock()
+	defer ar.workersMu.Unlock()
+	ar.groups = append(ar.groups, g)
 	for i := 0; i < ar.parallelism; i++ {
-		go ar.internalRun(ctx, funcName, runnner)
+		ar.startWorker(g)
+	}
+	if ar.arrival != nil {
+		go ar.schedule(g)
 	}
 }
 
-func (ar *AppRunnner) internalRun(ctx context.Context, funcName string, runnner Runnner) {
-	var errorCount int
+// startWorker is gにworkerを1つ追加する。workersMuをLockした状態で呼ぶこと
+func (ar *AppRunnner) startWorker(g *workerGroup) {
+	quit := make(chan struct{})
+	g.quits = append(g.quits, quit)
+	r := workerRand(ar.seed, g.name, g.workers)
+	g.workers++
+	ar.wg.Add(1)
+	if g.arrivals != nil {
+		go ar.openLoopRun(g, r, quit)
+		return
+	}
+	go ar.internalRun(g.ctx, g.name, g.next, r, quit)
+}
+
+// Name is WithNameで指定した名前を返す
+func (ar *AppRunnner) Name() string {
+	return ar.name
+}
+
+// Parallelism is 現在の並列数を返す
+func (ar *AppRunnner) Parallelism() int {
+	ar.workersMu.Lock()
+	defer ar.workersMu.Unlock()
+	return ar.parallelism
+}
+
+// SetParallelism is 並列数を変更する
+// 減らす場合、止めるworkerは実行中のRunが終わってから終了する
+func (ar *AppRunnner) SetParallelism(parallelism int) error {
+	if parallelism < 1 {
+		return fmt.Errorf("invalid parallelism %d : must be positive", parallelism)
+	}
+	ar.workersMu.Lock()
+	defer ar.workersMu.Unlock()
+
+	if ar.stopCtx.Err() != nil {
+		return ErrStopped
+	}
+	ar.parallelism = parallelism
+	for _, g := range ar.groups {
+		if g.ctx.Err() != nil {
+			continue
+		}
+		for len(g.quits) < parallelism {
+			ar.startWorker(g)
+		}
+		for len(g.quits) > parallelism {
+			last := len(g.quits) - 1
+			close(g.quits[last])
+			g.quits = g.quits[:last]
+		}
+	}
+	return nil
+}
+
+// Pause is Resumeが呼ばれるまで新しいRunの開始を止める
+// 実行中のRunはそのまま続ける。DurationはPause中も経過する
+func (ar *AppRunnner) Pause() {
+	ar.pauseMu.Lock()
+	defer ar.pauseMu.Unlock()
+	if ar.resume == nil {
+		ar.resume = make(chan struct{})
+	}
+}
+
+// Resume is Pauseで止めていたRunの開始を再開する
+func (ar *AppRunnner) Resume() {
+	ar.pauseMu.Lock()
+	defer ar.pauseMu.Unlock()
+	if ar.resume != nil {
+		close(ar.resume)
+		ar.resume = nil
+	}
+}
+
+// Paused is Pause中かどうかを返す
+func (ar *AppRunnner) Paused() bool {
+	ar.pauseMu.Lock()
+	defer ar.pauseMu.Unlock()
+	return ar.resume != nil
+}
+
+// waitResume is Pause中であればResumeされるまで待つ
+// 待っている間にworkerを終了することになった場合はfalseを返す
+func (ar *AppRunnner) waitResume(ctx context.Context, quit <-chan struct{}) bool {
+	ar.pauseMu.Lock()
+	resume := ar.resume
+	ar.pauseMu.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-ar.stopCtx.Done():
+	case <-ctx.Done():
+	case <-quit:
+	}
+	return false
+}
+
+// Stop is 新しいRunの開始を止める
+// 実行中のRunはそのまま続けるので、終わるのを待つ場合はDrainを使う
+func (ar *AppRunnner) Stop() {
+	ar.stop()
+}
+
+// Done is すべてのworkerが終了したらcloseされるchannelを返す
+// Runを呼んだ後に呼ぶこと
+func (ar *AppRunnner) Done() <-chan struct{} {
+	ar.doneOnce.Do(func() {
+		go func() {
+			ar.wg.Wait()
+			close(ar.done)
+		}()
+	})
+	return ar.done
+}
+
+// Drain is 新しいRunの開始を止めて、実行中のRunが終わるのをtimeoutまで待つ
+// timeoutまでに終わらなかった場合はErrDrainTimeoutを返す
+func (ar *AppRunnner) Drain(timeout time.Duration) error {
+	ar.Stop()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-ar.Done():
+		return nil
+	case <-t.C:
+		return ErrDrainTimeout
+	}
+}
+
+// Started is 開始したRunの回数を返す
+func (ar *AppRunnner) Started() int64 {
+	return atomic.LoadInt64(&ar.started)
+}
+
+// DrainAll is 複数のAppRunnnerをまとめてDrainする
+// timeoutはすべてのAppRunnnerで共有する
+func DrainAll(timeout time.Duration, runners ...*AppRunnner) error {
+	for _, ar := range runners {
+		ar.Stop()
+	}
+	deadline := time.Now().Add(timeout)
+	for _, ar := range runners {
+		if err := ar.Drain(time.Until(deadline)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllDone is すべてのAppRunnnerのworkerが終了したらcloseされるchannelを返す
+func AllDone(runners ...*AppRunnner) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		for _, ar := range runners {
+			<-ar.Done()
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// Rate is 現在の1secあたりのrateを返す
+func (ar *AppRunnner) Rate() float64 {
+	return float64(ar.limiter.Limit())
+}
+
+// SetRate is 1secあたりのrateを変更する
+func (ar *AppRunnner) SetRate(ratePerSec float64) {
+	if ratePerSec <= 0 {
+		ratePerSec = minLoadProfileRate
+	}
+	burst := int(math.Ceil(ratePerSec))
+	ar.limiter.SetLimit(rate.Limit(ratePerSec))
+	ar.limiter.SetBurst(burst)
+}
+
+// OverrideRate is 1secあたりのrateを変更し、以降はLoadProfileを適用しない
+// 実行中に外から手動でrateを変更する時に使う
+func (ar *AppRunnner) OverrideRate(ratePerSec float64) {
+	atomic.StoreInt32(&ar.rateOverridden, 1)
+	ar.SetRate(ratePerSec)
+}
+
+func (ar *AppRunnner) applyLoadProfile(ctx context.Context, startedAt time.Time) {
+	ar.SetRate(ar.loadProfile.Rate(0))
+
+	ticker := time.NewTicker(loadProfileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if atomic.LoadInt32(&ar.rateOverridden) == 1 {
+				return
+			}
+			ar.SetRate(ar.loadProfile.Rate(time.Since(startedAt)))
+		}
+	}
+}
+
+// RunnerStatus is AppRunnnerのある時点の状態
+type RunnerStatus struct {
+	Name        string           `json:"name"`
+	Rate        float64          `json:"rate"`
+	Parallelism int              `json:"parallelism"`
+	Paused      bool             `json:"paused"`
+	Stopped     bool             `json:"stopped"`
+	Started     int64            `json:"started"`
+	Backlog     int              `json:"backlog"`
+	Dropped     int64            `json:"dropped"`
+	Seed        int64            `json:"seed"`
+	Shard       Shard            `json:"shard"`
+	Stats       []*StatsSnapshot `json:"stats"`
+}
+
+// Status is 現在の状態を返す
+func (ar *AppRunnner) Status() *RunnerStatus {
+	stats := ar.Stats()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].FuncName < stats[j].FuncName
+	})
+	return &RunnerStatus{
+		Name:        ar.name,
+		Rate:        ar.Rate(),
+		Parallelism: ar.Parallelism(),
+		Paused:      ar.Paused(),
+		Stopped:     ar.stopCtx.Err() != nil,
+		Started:     ar.Started(),
+		Backlog:     ar.Backlog(),
+		Dropped:     ar.Dropped(),
+		Seed:        ar.Seed(),
+		Shard:       ar.shard,
+		Stats:       stats,
+	}
+}
+
+// Stats is funcNameごとの計測結果を返す
+func (ar *AppRunnner) Stats() []*StatsSnapshot {
+	ar.statsMu.Lock()
+	defer ar.statsMu.Unlock()
+
+	var ret []*StatsSnapshot
+	for _, v := range ar.stats {
+		ret = append(ret, v.Snapshot())
+	}
+	return ret
+}
+
+// StatsByFuncName is 指定したfuncNameの計測結果を返す
+// まだRunしていないfuncNameの場合はfalseを返す
+func (ar *AppRunnner) StatsByFuncName(funcName string) (*StatsSnapshot, bool) {
+	ar.statsMu.Lock()
+	defer ar.statsMu.Unlock()
+
+	v, ok := ar.stats[funcName]
+	if !ok {
+		return nil, false
+	}
+	return v.Snapshot(), true
+}
+
+func (ar *AppRunnner) runnerStats(funcName string) *RunnerStats {
+	ar.statsMu.Lock()
+	defer ar.statsMu.Unlock()
+
+	v, ok := ar.stats[funcName]
+	if !ok {
+		v = NewRunnerStats(funcName)
+		ar.stats[funcName] = v
+	}
+	return v
+}
+
+func (ar *AppRunnner) internalRun(ctx context.Context, name string, next func(r *rand.Rand) (Runnner, *RunnerStats), r *rand.Rand, quit <-chan struct{}) {
+	defer ar.wg.Done()
+
+	// source is metricsに記録するRunner名. WithNameを指定していない場合はfuncNameかmixNameを使う
+	source := ar.name
+	if source == "" {
+		source = name
+	}
+
+	// errorCounts is funcNameごとの連続エラー回数. RunMixで他のRunnerが成功しても、失敗しているRunnerのBackoffは延びていく
+	errorCounts := make(map[string]int)
 	for {
 		select {
+		case <-ar.stopCtx.Done():
+			fmt.Printf("stop run %s\n", name)
+			return
 		case <-ctx.Done():
-			fmt.Printf("stop run %s\n", funcName)
+			fmt.Printf("stop run %s\n", name)
+			return
+		case <-quit:
 			return
 		default:
-			if err := ar.limiter.Wait(ctx); err != nil {
-				fmt.Printf("failed limitter funcName=%s, err=%s\n", funcName, err)
+			if !ar.waitResume(ctx, quit) {
+				continue
+			}
+			if err := ar.limiter.Wait(ar.stopCtx); err != nil {
+				if ar.stopCtx.Err() != nil {
+					continue
+				}
+				fmt.Printf("failed limitter funcName=%s, err=%s\n", name, err)
 				time.Sleep(1 * time.Second)
 				continue
 			}
-			if err := runnner.Run(ctx); err != nil {
-				errorCount++
-				fmt.Printf("failed %s. errCount=%d err=%s\n", funcName, errorCount, err)
-				time.Sleep(time.Duration(600*errorCount+rand.Intn(600)) * time.Second)
+			if !ar.claimIteration() {
+				ar.Stop()
 				continue
 			}
-			errorCount = 0
+			runnner, stats := next(r)
+			runCtx, keys := ar.runContext(ctx, r, stats)
+			start := time.Now()
+			err := runnner.Run(runCtx)
+			elapsed := time.Since(start)
+			stats.recordRun(runCtx, source, elapsed, err)
+			stats.recordKeys(keys, elapsed, err)
+			if err != nil {
+				errorCounts[stats.funcName]++
+				errorCount := errorCounts[stats.funcName]
+				wait := ar.backoff.Backoff(r, err, errorCount)
+				fmt.Printf("failed %s. errCount=%d code=%s backoff=%s err=%s\n", stats.funcName, errorCount, ErrorCode(err), wait, err)
+				sleep(ar.stopCtx, wait)
+				continue
+			}
+			delete(errorCounts, stats.funcName)
 		}
 	}
 }
+
+// runContext is 1回のRunに渡すctxを作る. workerのrandと、選んだkeyを記録するkeyObservationと、RecordOutcomeで使うstatsを入れる
+func (ar *AppRunnner) runContext(ctx context.Context, r *rand.Rand, stats *RunnerStats) (context.Context, *keyObservation) {
+	ctx = withStopping(withRunnerStats(withRand(ctx, r), stats), ar.stopCtx.Done())
+	return withKeyObservation(ctx, ar.keyDistribution, ar.shard)
+}
+
+type stoppingKey struct{}
+
+func withStopping(ctx context.Context, stopping <-chan struct{}) context.Context {
+	return context.WithValue(ctx, stoppingKey{}, stopping)
+}
+
+// Stopping is ctxのRunを実行しているAppRunnnerのStopが呼ばれるとcloseされるchannelを返す
+// StopやDrainでRunのctxはcancelされないので、Runの中で長く待つ時はこれも見て途中でやめる
+// AppRunnnerのRun以外から呼ばれた場合はnilを返す
+func Stopping(ctx context.Context) <-chan struct{} {
+	stopping, _ := ctx.Value(stoppingKey{}).(<-chan struct{})
+	return stopping
+}
+
+// claimIteration is 次のRunを開始して良いかを返す
+// WithIterationsで指定した回数に到達している場合はfalseを返す
+func (ar *AppRunnner) claimIteration() bool {
+	n := atomic.AddInt64(&ar.started, 1)
+	if ar.iterations > 0 && n > ar.iterations {
+		atomic.AddInt64(&ar.started, -1)
+		return false
+	}
+	return true
+}
+
+// sleep is dだけ待つ。ctxが終了した場合は即座に戻る
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
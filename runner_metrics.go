@@ -0,0 +1,96 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MeterName is srunnerがOpenTelemetryのmetricsを記録する時のinstrumentation scope
+const MeterName = "github.com/sinmetal/srunner"
+
+// runLatencyBuckets is srunner.run.latency のbucketの境界(ms)
+var runLatencyBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 30000, 60000}
+
+// runnerMetrics is Runの結果を記録するOpenTelemetryのinstrument
+// otel.SetMeterProviderより前に作っても、SetMeterProvider後のMeterProviderに記録される
+type runnerMetrics struct {
+	runs    metric.Int64Counter
+	errors  metric.Int64Counter
+	latency metric.Float64Histogram
+}
+
+var (
+	runnerMetricsOnce sync.Once
+	runnerMetricsV    *runnerMetrics
+)
+
+func getRunnerMetrics() *runnerMetrics {
+	runnerMetricsOnce.Do(func() {
+		m, err := newRunnerMetrics(otel.Meter(MeterName))
+		if err != nil {
+			fmt.Printf("failed create runner metrics err=%s\n", err)
+			return
+		}
+		runnerMetricsV = m
+	})
+	return runnerMetricsV
+}
+
+func newRunnerMetrics(meter metric.Meter) (*runnerMetrics, error) {
+	runs, err := meter.Int64Counter("srunner.runs",
+		metric.WithDescription("number of Runnner.Run"),
+		metric.WithUnit("{run}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.runs : %w", err)
+	}
+	errs, err := meter.Int64Counter("srunner.run.errors",
+		metric.WithDescription("number of failed Runnner.Run by code"),
+		metric.WithUnit("{run}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.run.errors : %w", err)
+	}
+	latency, err := meter.Float64Histogram("srunner.run.latency",
+		metric.WithDescription("latency of Runnner.Run"),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(runLatencyBuckets...))
+	if err != nil {
+		return nil, fmt.Errorf("failed create srunner.run.latency : %w", err)
+	}
+	return &runnerMetrics{
+		runs:    runs,
+		errors:  errs,
+		latency: latency,
+	}, nil
+}
+
+// record is Run 1回分の結果を記録する
+// srunner.runs にはsourceとkind (MetricsKindOK, MetricsKindNG, MetricsKindTimeout) も付ける
+func (m *runnerMetrics) record(ctx context.Context, funcName string, source string, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	code := ErrorCode(err)
+	m.runs.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("func_name", funcName),
+		KeySource.String(source),
+		KeyKind.String(MetricsKind(err)),
+		KeyCode.String(code.String()),
+	))
+	m.latency.Record(ctx, float64(elapsed)/float64(time.Millisecond), metric.WithAttributes(
+		attribute.String("func_name", funcName),
+		KeyCode.String(code.String()),
+	))
+	if err != nil {
+		m.errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("func_name", funcName),
+			KeyCode.String(code.String()),
+			attribute.String("class", ClassifyError(err).String()),
+		))
+	}
+}
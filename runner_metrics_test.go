@@ -0,0 +1,94 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRunnerMetrics_Record(t *testing.T) {
+	ctx := context.Background()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := newRunnerMetrics(provider.Meter(MeterName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.record(ctx, "Balance.Deposit", "DEPOSIT", 10*time.Millisecond, nil)
+	m.record(ctx, "Balance.Deposit", "DEPOSIT", 20*time.Millisecond, nil)
+	m.record(ctx, "Balance.Deposit", "DEPOSIT", 30*time.Millisecond, spanner.ToSpannerError(errors.New("hoge")))
+	m.record(ctx, "Balance.Deposit", "DEPOSIT", 30*time.Millisecond, context.DeadlineExceeded)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, v := range sm.Metrics {
+			got[v.Name] = v.Data
+		}
+	}
+
+	runs, ok := got["srunner.runs"].(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("srunner.runs not found")
+	}
+	var total int64
+	kinds := make(map[string]int64)
+	for _, dp := range runs.DataPoints {
+		total += dp.Value
+		source, _ := dp.Attributes.Value(KeySource)
+		if e, g := "DEPOSIT", source.AsString(); e != g {
+			t.Errorf("want source %s but got %s", e, g)
+		}
+		kind, _ := dp.Attributes.Value(KeyKind)
+		kinds[kind.AsString()] += dp.Value
+		code, _ := dp.Attributes.Value("code")
+		if code.AsString() == codes.OK.String() {
+			if e, g := int64(2), dp.Value; e != g {
+				t.Errorf("want OK runs %d but got %d", e, g)
+			}
+		}
+	}
+	if e, g := int64(4), total; e != g {
+		t.Errorf("want runs %d but got %d", e, g)
+	}
+	wantKinds := map[string]int64{
+		MetricsKindOK:      2,
+		MetricsKindNG:      1,
+		MetricsKindTimeout: 1,
+	}
+	for k, e := range wantKinds {
+		if g := kinds[k]; e != g {
+			t.Errorf("want %s runs %d but got %d", k, e, g)
+		}
+	}
+
+	errs, ok := got["srunner.run.errors"].(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("srunner.run.errors not found")
+	}
+	if e, g := 2, len(errs.DataPoints); e != g {
+		t.Errorf("want %d error codes but got %d", e, g)
+	}
+
+	latency, ok := got["srunner.run.latency"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("srunner.run.latency not found")
+	}
+	var count uint64
+	for _, dp := range latency.DataPoints {
+		count += dp.Count
+	}
+	if e, g := uint64(4), count; e != g {
+		t.Errorf("want latency count %d but got %d", e, g)
+	}
+}
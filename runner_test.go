@@ -0,0 +1,253 @@
+package srunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countRunner struct {
+	count int64
+	err   error
+}
+
+func (r *countRunner) Run(ctx context.Context) error {
+	atomic.AddInt64(&r.count, 1)
+	return r.err
+}
+
+func TestAppRunnner_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 2)
+	r := &countRunner{}
+	ar.Run(ctx, "Count", r)
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	v, ok := ar.StatsByFuncName("Count")
+	if !ok {
+		t.Fatal("Count stats not found")
+	}
+	if v.Count == 0 {
+		t.Errorf("want Count > 0")
+	}
+	if v.ErrorCount != 0 {
+		t.Errorf("want ErrorCount 0 but got %d", v.ErrorCount)
+	}
+	if _, ok := ar.StatsByFuncName("Unknown"); ok {
+		t.Errorf("want Unknown stats not found")
+	}
+}
+
+func TestWriteStatsTable(t *testing.T) {
+	s := NewRunnerStats("Balance.Deposit")
+	s.Record(context.Background(), 10*time.Millisecond, nil)
+	s.Record(context.Background(), 20*time.Millisecond, errors.New("failed"))
+
+	var buf bytes.Buffer
+	if err := WriteStatsTable(&buf, []*StatsSnapshot{s.Snapshot()}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if e, g := 2, len(lines); e != g {
+		t.Fatalf("want %d lines but got %d\n%s", e, g, buf.String())
+	}
+	fields := strings.Fields(lines[1])
+	if e, g := "Balance.Deposit", fields[0]; e != g {
+		t.Errorf("want FuncName %s but got %s", e, g)
+	}
+	if e, g := "2", fields[1]; e != g {
+		t.Errorf("want Count %s but got %s", e, g)
+	}
+	if e, g := "1", fields[2]; e != g {
+		t.Errorf("want Errors %s but got %s", e, g)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 1, WithIterations(3))
+	ar.Run(ctx, "Count", &countRunner{})
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, []*AppRunnner{ar}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"FuncName", "KeyRank", "Outcome", "Count"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in report\n%s", want, buf.String())
+		}
+	}
+}
+
+type slowRunner struct {
+	d        time.Duration
+	finished int64
+}
+
+func (r *slowRunner) Run(ctx context.Context) error {
+	time.Sleep(r.d)
+	atomic.AddInt64(&r.finished, 1)
+	return nil
+}
+
+func TestAppRunnner_Iterations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 4, WithIterations(20))
+	r := &countRunner{}
+	ar.Run(ctx, "Count", r)
+
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if e, g := int64(20), atomic.LoadInt64(&r.count); e != g {
+		t.Errorf("want Run count %d but got %d", e, g)
+	}
+	if e, g := int64(20), ar.Started(); e != g {
+		t.Errorf("want Started %d but got %d", e, g)
+	}
+}
+
+func TestAppRunnner_Duration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 2, WithDuration(100*time.Millisecond))
+	ar.Run(ctx, "Count", &countRunner{})
+
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestAppRunnner_Drain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 2)
+	r := &slowRunner{d: 200 * time.Millisecond}
+	ar.Run(ctx, "Slow", r)
+	time.Sleep(50 * time.Millisecond)
+
+	// 実行中のRunが終わるまで待つ
+	if err := ar.Drain(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := ar.Started(), atomic.LoadInt64(&r.finished); e != g {
+		t.Errorf("want finished %d but got %d", e, g)
+	}
+
+	ar = NewAppRunner(ctx, 1000, 1)
+	ar.Run(ctx, "Slow", &slowRunner{d: time.Second})
+	time.Sleep(50 * time.Millisecond)
+	if err := ar.Drain(10 * time.Millisecond); !errors.Is(err, ErrDrainTimeout) {
+		t.Errorf("want ErrDrainTimeout but got %v", err)
+	}
+}
+
+type stoppingRunner struct{}
+
+func (r *stoppingRunner) Run(ctx context.Context) error {
+	select {
+	case <-Stopping(ctx):
+	case <-time.After(10 * time.Second):
+	}
+	return nil
+}
+
+func TestAppRunnner_Stopping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if Stopping(ctx) != nil {
+		t.Errorf("want nil outside of Run")
+	}
+
+	ar := NewAppRunner(ctx, 1000, 1)
+	ar.Run(ctx, "Stopping", &stoppingRunner{})
+	time.Sleep(50 * time.Millisecond)
+
+	// StopされるとRunの中で待っているRunnerもすぐに終わる
+	if err := ar.Drain(time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppRunnner_PauseResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 2)
+	ar.Pause()
+	r := &countRunner{}
+	ar.Run(ctx, "Count", r)
+
+	time.Sleep(50 * time.Millisecond)
+	if e, g := int64(0), atomic.LoadInt64(&r.count); e != g {
+		t.Errorf("want Run count %d while paused but got %d", e, g)
+	}
+	if !ar.Paused() {
+		t.Errorf("want Paused")
+	}
+
+	ar.Resume()
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt64(&r.count) == 0 {
+		t.Errorf("want Run count > 0 after Resume")
+	}
+	if err := ar.Drain(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppRunnner_SetParallelism(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 1)
+	r := &slowRunner{d: 20 * time.Millisecond}
+	ar.Run(ctx, "Slow", r)
+
+	if err := ar.SetParallelism(0); err == nil {
+		t.Errorf("want error")
+	}
+	if err := ar.SetParallelism(4); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 4, ar.Parallelism(); e != g {
+		t.Errorf("want Parallelism %d but got %d", e, g)
+	}
+	if err := ar.SetParallelism(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ar.Drain(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := ar.Started(), atomic.LoadInt64(&r.finished); e != g {
+		t.Errorf("want finished %d but got %d", e, g)
+	}
+	if err := ar.SetParallelism(3); !errors.Is(err, ErrStopped) {
+		t.Errorf("want ErrStopped but got %v", err)
+	}
+}
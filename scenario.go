@@ -0,0 +1,468 @@
+package srunner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultRunnerRate is RunnerSpecでRateを指定しなかった場合のrate
+	DefaultRunnerRate = 1
+
+	// DefaultRunnerParallelism is RunnerSpecでParallelismを指定しなかった場合の並列数
+	DefaultRunnerParallelism = 50
+)
+
+// MixRunnerName is 複数のRunnerを重みに応じて混ぜて実行するRunnerSpecのName
+const MixRunnerName = "MIX"
+
+// Scenario is どのDBに、どのRunnerを、どれぐらいの負荷で実行するかの宣言
+type Scenario struct {
+	Target       Target        `json:"target" yaml:"target"`
+	Duration     Duration      `json:"duration" yaml:"duration"`
+	Iterations   int64         `json:"iterations" yaml:"iterations"`
+	DrainTimeout Duration      `json:"drainTimeout" yaml:"drainTimeout"`
+	Seed         int64         `json:"seed" yaml:"seed"`
+	Runners      []*RunnerSpec `json:"runners" yaml:"runners"`
+
+	// Shard is このpodが担当するShard. podごとに違う値になるので、fileには書かずにShardFromEnvで指定する
+	// PartitionKeysを指定したRunnerと、CREATE_USER_ACCOUNTの範囲を分けるのに使う
+	Shard Shard `json:"-" yaml:"-"`
+}
+
+// Target is 負荷をかける対象のDB
+type Target struct {
+	Backend Backend `json:"backend" yaml:"backend"`
+
+	// Database is Spannerの場合は projects/{PROJECT_ID}/instances/{INSTANCE_ID}/databases/{DATABASE_ID}
+	// AlloyDBの場合はdatabase名
+	Database string `json:"database" yaml:"database"`
+
+	// Instance is AlloyDBのprimary instance名
+	Instance string `json:"instance" yaml:"instance"`
+
+	// ReadReplicaInstances is AlloyDBのread replica instance名
+	ReadReplicaInstances []string `json:"readReplicaInstances" yaml:"readReplicaInstances"`
+
+	// ReadReplicaPolicy is read replicaの選び方. round_robin, least_in_flight, lowest_latency のいずれか
+	ReadReplicaPolicy string `json:"readReplicaPolicy" yaml:"readReplicaPolicy"`
+}
+
+// RunnerSpec is 1つのAppRunnnerの設定
+// Duration, Iterations, Seed を指定しなかった場合はScenarioの値を使う
+// Seedも0の場合は起動時刻をseedにする
+type RunnerSpec struct {
+	Name        string         `json:"name" yaml:"name"`
+	Rate        int            `json:"rate" yaml:"rate"`
+	Parallelism int            `json:"parallelism" yaml:"parallelism"`
+	Profile     string         `json:"profile" yaml:"profile"`
+	Backoff     string         `json:"backoff" yaml:"backoff"`
+	Arrival     string         `json:"arrival" yaml:"arrival"`
+	Duration    Duration       `json:"duration" yaml:"duration"`
+	Iterations  int64          `json:"iterations" yaml:"iterations"`
+	Seed        int64          `json:"seed" yaml:"seed"`
+	Mix         map[string]int `json:"mix" yaml:"mix"`
+
+	// KeyDistribution is RunnerがUserIDなどのkeyを選ぶ時の偏り. ParseKeyDistributionの形式で指定する
+	// e.g. zipf,1.2  hotset,1,90  指定しない場合はuniform
+	KeyDistribution string `json:"keyDistribution" yaml:"keyDistribution"`
+
+	// PartitionKeys is trueの場合、ScenarioのShardが担当する範囲からkeyを選ぶ
+	// 複数のpodで同じRunnerを動かす時に、podごとにkeyが重ならないようにする
+	PartitionKeys bool `json:"partitionKeys" yaml:"partitionKeys"`
+}
+
+// Duration is "30s" のような文字列でJSON, YAMLに書けるtime.Duration
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("invalid duration %s : %w", string(b), err)
+	}
+	return d.parse(v)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var v string
+	if err := node.Decode(&v); err != nil {
+		return fmt.Errorf("invalid duration %s : %w", node.Value, err)
+	}
+	return d.parse(v)
+}
+
+func (d *Duration) parse(v string) error {
+	if v == "" {
+		*d = 0
+		return nil
+	}
+	pd, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s : %w", v, err)
+	}
+	*d = Duration(pd)
+	return nil
+}
+
+// LoadScenario is Scenarioをfileから読み込む
+// 拡張子が .json の場合はJSON, それ以外はYAMLとして読む
+// Shardはpodごとに違うので、fileではなく ShardFromEnv で指定する
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed read scenario %s : %w", path, err)
+	}
+
+	var s Scenario
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("failed parse scenario %s : %w", path, err)
+		}
+	} else {
+		if err := yaml.Unmarshal(b, &s); err != nil {
+			return nil, fmt.Errorf("failed parse scenario %s : %w", path, err)
+		}
+	}
+	shard, err := ShardFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	s.Shard = shard
+	s.setDefaults()
+	return &s, nil
+}
+
+// ScenarioFromEnv is 環境変数からScenarioを作る
+//
+// $SRUNNER_RUNNERS は DEPOSIT:10;TWEET:1 というformatを期待している
+// 3つ目にLoadProfileを、4つ目にBackoffPolicyを、5つ目にArrivalProcessを、6つ目にKeyDistributionを指定することもできる
+//
+//	DEPOSIT:10:ramp,100,10m;TWEET:1
+//	DEPOSIT:10:constant:contention=none/default=exponential,1s,5m
+//	DEPOSIT:100:constant::poisson
+//
+// MIXの重みは $SRUNNER_MIX に FIND_USER_DEPOSIT_HISTORIES=70,DEPOSIT=25,DEPOSIT_DML=5 のように指定する
+// 前回のRunを再現する場合は、その時に表示されたseedを $SRUNNER_SEED に指定する
+// Shardは ShardFromEnv で指定する. $SRUNNER_PARTITION_KEYS=true の場合はすべてのRunnerのkeyをShardで分ける
+// Duration, Iterations, DrainTimeout は RunModeFromEnv と同じ環境変数から読む
+func ScenarioFromEnv(backend Backend) (*Scenario, error) {
+	runners, err := ParseRunnersShorthand(os.Getenv("SRUNNER_RUNNERS"))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range runners {
+		if r.Name != MixRunnerName {
+			continue
+		}
+		mix, err := ParseMixWeights(os.Getenv("SRUNNER_MIX"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_MIX : %w", err)
+		}
+		r.Mix = mix
+	}
+	if v := os.Getenv("SRUNNER_PARTITION_KEYS"); v != "" {
+		partitionKeys, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_PARTITION_KEYS %s : %w", v, err)
+		}
+		for _, r := range runners {
+			r.PartitionKeys = partitionKeys
+		}
+	}
+
+	runMode, err := RunModeFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	var seed int64
+	if v := os.Getenv("SRUNNER_SEED"); v != "" {
+		seed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $SRUNNER_SEED %s : %w", v, err)
+		}
+	}
+	shard, err := ShardFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{
+		Target:       Target{Backend: backend},
+		Duration:     Duration(runMode.Duration),
+		Iterations:   runMode.Iterations,
+		DrainTimeout: Duration(runMode.DrainTimeout),
+		Seed:         seed,
+		Runners:      runners,
+		Shard:        shard,
+	}
+	s.setDefaults()
+	return s, nil
+}
+
+// ParseRunnersShorthand is $SRUNNER_RUNNERS の文字列をRunnerSpecにする
+func ParseRunnersShorthand(runnersParam string) ([]*RunnerSpec, error) {
+	var ret []*RunnerSpec
+	for _, v := range strings.Split(runnersParam, ";") {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		l := strings.Split(v, ":")
+		spec := &RunnerSpec{Name: l[0], Rate: DefaultRunnerRate}
+		if len(l) > 1 {
+			rate, err := strconv.Atoi(l[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid $SRUNNER_RUNNERS format %s : %w", runnersParam, err)
+			}
+			spec.Rate = rate
+		}
+		if len(l) > 2 {
+			spec.Profile = l[2]
+		}
+		if len(l) > 3 {
+			spec.Backoff = l[3]
+		}
+		if len(l) > 4 {
+			spec.Arrival = l[4]
+		}
+		if len(l) > 5 {
+			spec.KeyDistribution = l[5]
+		}
+		ret = append(ret, spec)
+	}
+	return ret, nil
+}
+
+func (s *Scenario) setDefaults() {
+	if s.Target.Backend == "" {
+		s.Target.Backend = BackendSpanner
+	}
+	if s.DrainTimeout == 0 {
+		s.DrainTimeout = Duration(DefaultDrainTimeout)
+	}
+	if s.Shard.Count == 0 {
+		s.Shard = NoShard
+	}
+	for _, r := range s.Runners {
+		s.setRunnerDefaults(r)
+	}
+}
+
+func (s *Scenario) setRunnerDefaults(r *RunnerSpec) {
+	if r.Rate == 0 {
+		r.Rate = DefaultRunnerRate
+	}
+	if r.Parallelism == 0 {
+		r.Parallelism = DefaultRunnerParallelism
+	}
+	if r.Duration == 0 {
+		r.Duration = s.Duration
+	}
+	if r.Iterations == 0 {
+		r.Iterations = s.Iterations
+	}
+	if r.Seed == 0 {
+		r.Seed = s.Seed
+	}
+}
+
+// Runner is 指定したNameのRunnerSpecを返す
+func (s *Scenario) Runner(name string) (*RunnerSpec, bool) {
+	for _, r := range s.Runners {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// TakeRunner is 指定したNameのRunnerSpecをScenarioから取り除いて返す
+// CREATE_USER_ACCOUNT のように、AppRunnnerではなく起動時に1回だけ実行するものに使う
+func (s *Scenario) TakeRunner(name string) (*RunnerSpec, bool) {
+	for i, r := range s.Runners {
+		if r.Name == name {
+			s.Runners = append(s.Runners[:i], s.Runners[i+1:]...)
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Bounded is すべてのRunnerにDurationかIterationsが指定されていて、signalを待たずに終了するかどうか
+func (s *Scenario) Bounded() bool {
+	if len(s.Runners) < 1 {
+		return false
+	}
+	for _, r := range s.Runners {
+		if r.Duration <= 0 && r.Iterations <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate is Scenarioに書かれているRunnerが登録されているか、設定値が正しいかを確認する
+func (s *Scenario) Validate() error {
+	if err := s.Shard.Validate(); err != nil {
+		return err
+	}
+	names := make(map[string]bool)
+	for _, r := range s.Runners {
+		if names[r.Name] {
+			return fmt.Errorf("runner %s is duplicated", r.Name)
+		}
+		names[r.Name] = true
+		if err := s.validateRunner(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Scenario) validateRunner(r *RunnerSpec) error {
+	if r.Rate < 1 {
+		return fmt.Errorf("runner %s : rate must be positive", r.Name)
+	}
+	if r.Parallelism < 1 {
+		return fmt.Errorf("runner %s : parallelism must be positive", r.Name)
+	}
+	if _, err := r.options(); err != nil {
+		return err
+	}
+	if r.Name == MixRunnerName {
+		if len(r.Mix) < 1 {
+			return fmt.Errorf("runner %s : mix is empty", r.Name)
+		}
+		var total int
+		for name, weight := range r.Mix {
+			if _, ok := LookupRunner(s.Target.Backend, name); !ok {
+				return fmt.Errorf("runner %s : %s/%s is not registered", r.Name, s.Target.Backend, name)
+			}
+			if weight < 0 {
+				return fmt.Errorf("runner %s : weight of %s must not be negative", r.Name, name)
+			}
+			total += weight
+		}
+		if total == 0 {
+			return fmt.Errorf("runner %s : at least one mix weight must be positive", r.Name)
+		}
+		return nil
+	}
+	if _, ok := LookupRunner(s.Target.Backend, r.Name); !ok {
+		return fmt.Errorf("runner %s/%s is not registered", s.Target.Backend, r.Name)
+	}
+	return nil
+}
+
+// Start is Scenarioに書かれているRunnerを起動する
+func (s *Scenario) Start(ctx context.Context, env *RunnerEnv) ([]*AppRunnner, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	var ret []*AppRunnner
+	for _, r := range s.Runners {
+		ar, err := s.StartRunner(ctx, env, r)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ar)
+	}
+	return ret, nil
+}
+
+// StartRunner is Scenarioに書かれていないRunnerSpecを、ScenarioのTargetに対して起動する
+// RunnerSpecで指定していない値はScenarioの値を使う
+func (s *Scenario) StartRunner(ctx context.Context, env *RunnerEnv, r *RunnerSpec) (*AppRunnner, error) {
+	s.setRunnerDefaults(r)
+	if err := s.validateRunner(r); err != nil {
+		return nil, err
+	}
+	opts, err := r.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithName(r.Name))
+	if r.PartitionKeys {
+		opts = append(opts, WithShard(s.Shard))
+	}
+	ar := NewAppRunner(ctx, r.Rate, r.Parallelism, opts...)
+	// 同じRunを再現できるように、seedを表示しておく
+	fmt.Printf("Ignite %s:%d seed=%d shard=%s\n", r.Name, r.Rate, ar.Seed(), ar.Shard())
+
+	if r.Name == MixRunnerName {
+		mix := NewMix()
+		for name, weight := range r.Mix {
+			reg, _ := LookupRunner(s.Target.Backend, name)
+			runnner, err := reg.Factory(ctx, env, r)
+			if err != nil {
+				return nil, fmt.Errorf("failed create runner %s : %w", name, err)
+			}
+			mix.Add(reg.FuncName, weight, runnner)
+		}
+		if err := ar.RunMix(ctx, "Mix", mix); err != nil {
+			return nil, err
+		}
+		return ar, nil
+	}
+
+	reg, _ := LookupRunner(s.Target.Backend, r.Name)
+	runnner, err := reg.Factory(ctx, env, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed create runner %s : %w", r.Name, err)
+	}
+	ar.Run(ctx, reg.FuncName, runnner)
+	return ar, nil
+}
+
+func (r *RunnerSpec) options() ([]AppRunnerOption, error) {
+	var opts []AppRunnerOption
+	if r.Profile != "" {
+		profile, err := ParseLoadProfile(float64(r.Rate), r.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("runner %s : %w", r.Name, err)
+		}
+		opts = append(opts, WithLoadProfile(profile))
+	}
+	if r.Backoff != "" {
+		backoff, err := ParseBackoffPolicy(r.Backoff)
+		if err != nil {
+			return nil, fmt.Errorf("runner %s : %w", r.Name, err)
+		}
+		opts = append(opts, WithBackoffPolicy(backoff))
+	}
+	arrival, err := ParseArrival(r.Arrival)
+	if err != nil {
+		return nil, fmt.Errorf("runner %s : %w", r.Name, err)
+	}
+	if arrival != nil {
+		opts = append(opts, WithArrival(arrival))
+	}
+	if r.KeyDistribution != "" {
+		keyDistribution, err := ParseKeyDistribution(r.KeyDistribution)
+		if err != nil {
+			return nil, fmt.Errorf("runner %s : %w", r.Name, err)
+		}
+		opts = append(opts, WithKeyDistribution(keyDistribution))
+	}
+	if r.Duration > 0 {
+		opts = append(opts, WithDuration(time.Duration(r.Duration)))
+	}
+	if r.Iterations > 0 {
+		opts = append(opts, WithIterations(r.Iterations))
+	}
+	if r.Seed != 0 {
+		opts = append(opts, WithSeed(r.Seed))
+	}
+	return opts, nil
+}
@@ -0,0 +1,209 @@
+package srunner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterRunner(BackendSpanner, "TEST_COUNT", "Test.Count", func(ctx context.Context, env *RunnerEnv, spec *RunnerSpec) (Runnner, error) {
+		return &countRunner{}, nil
+	})
+	RegisterRunner(BackendSpanner, "TEST_ERROR", "Test.Error", func(ctx context.Context, env *RunnerEnv, spec *RunnerSpec) (Runnner, error) {
+		return &countRunner{err: errors.New("failed")}, nil
+	})
+}
+
+func TestLoadScenario(t *testing.T) {
+	for _, path := range []string{"testdata/scenario.yaml", "testdata/scenario.json"} {
+		path := path
+		t.Run(path, func(t *testing.T) {
+			s, err := LoadScenario(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := BackendSpanner, s.Target.Backend; e != g {
+				t.Errorf("want Backend %s but got %s", e, g)
+			}
+			if e, g := "projects/fake/instances/fake/databases/fake", s.Target.Database; e != g {
+				t.Errorf("want Database %s but got %s", e, g)
+			}
+			if e, g := Duration(DefaultDrainTimeout), s.DrainTimeout; e != g {
+				t.Errorf("want DrainTimeout %s but got %s", time.Duration(e), time.Duration(g))
+			}
+			if e, g := 2, len(s.Runners); e != g {
+				t.Fatalf("want %d runners but got %d", e, g)
+			}
+
+			count := s.Runners[0]
+			if e, g := 10, count.Rate; e != g {
+				t.Errorf("want Rate %d but got %d", e, g)
+			}
+			if e, g := 2, count.Parallelism; e != g {
+				t.Errorf("want Parallelism %d but got %d", e, g)
+			}
+			if e, g := Duration(10*time.Minute), count.Duration; e != g {
+				t.Errorf("want Duration %s but got %s", time.Duration(e), time.Duration(g))
+			}
+			if e, g := int64(200), count.Seed; e != g {
+				t.Errorf("want Seed %d but got %d", e, g)
+			}
+			if e, g := "zipf,1.2", count.KeyDistribution; e != g {
+				t.Errorf("want KeyDistribution %s but got %s", e, g)
+			}
+
+			mix := s.Runners[1]
+			if e, g := DefaultRunnerParallelism, mix.Parallelism; e != g {
+				t.Errorf("want Parallelism %d but got %d", e, g)
+			}
+			if e, g := int64(1000), mix.Iterations; e != g {
+				t.Errorf("want Iterations %d but got %d", e, g)
+			}
+			if e, g := int64(100), mix.Seed; e != g {
+				t.Errorf("want Seed %d but got %d", e, g)
+			}
+			if e, g := 70, mix.Mix["TEST_COUNT"]; e != g {
+				t.Errorf("want mix weight %d but got %d", e, g)
+			}
+
+			if err := s.Validate(); err != nil {
+				t.Error(err)
+			}
+			if !s.Bounded() {
+				t.Errorf("want Bounded")
+			}
+		})
+	}
+}
+
+func TestParseRunnersShorthand(t *testing.T) {
+	got, err := ParseRunnersShorthand("DEPOSIT:10:ramp,100,10m:none::zipf,1.2;TWEET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 2, len(got); e != g {
+		t.Fatalf("want %d runners but got %d", e, g)
+	}
+	if e, g := "DEPOSIT", got[0].Name; e != g {
+		t.Errorf("want Name %s but got %s", e, g)
+	}
+	if e, g := 10, got[0].Rate; e != g {
+		t.Errorf("want Rate %d but got %d", e, g)
+	}
+	if e, g := "ramp,100,10m", got[0].Profile; e != g {
+		t.Errorf("want Profile %s but got %s", e, g)
+	}
+	if e, g := "none", got[0].Backoff; e != g {
+		t.Errorf("want Backoff %s but got %s", e, g)
+	}
+	if e, g := "zipf,1.2", got[0].KeyDistribution; e != g {
+		t.Errorf("want KeyDistribution %s but got %s", e, g)
+	}
+	if e, g := DefaultRunnerRate, got[1].Rate; e != g {
+		t.Errorf("want Rate %d but got %d", e, g)
+	}
+
+	if _, err := ParseRunnersShorthand("DEPOSIT:hoge"); err == nil {
+		t.Errorf("want error")
+	}
+}
+
+func TestScenario_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		runners []*RunnerSpec
+	}{
+		{"not registered", []*RunnerSpec{{Name: "HOGE"}}},
+		{"invalid profile", []*RunnerSpec{{Name: "TEST_COUNT", Profile: "hoge"}}},
+		{"invalid backoff", []*RunnerSpec{{Name: "TEST_COUNT", Backoff: "hoge"}}},
+		{"empty mix", []*RunnerSpec{{Name: MixRunnerName}}},
+		{"mix not registered", []*RunnerSpec{{Name: MixRunnerName, Mix: map[string]int{"HOGE": 1}}}},
+		{"negative mix weight", []*RunnerSpec{{Name: MixRunnerName, Mix: map[string]int{"TEST_COUNT": -1}}}},
+		{"all zero mix weights", []*RunnerSpec{{Name: MixRunnerName, Mix: map[string]int{"TEST_COUNT": 0, "TEST_ERROR": 0}}}},
+	}
+
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scenario{Runners: tt.runners}
+			s.setDefaults()
+			if err := s.Validate(); err == nil {
+				t.Errorf("want error")
+			}
+		})
+	}
+}
+
+func TestScenario_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &Scenario{
+		Iterations: 10,
+		Seed:       100,
+		Runners: []*RunnerSpec{
+			{Name: "TEST_COUNT", Rate: 1000, Parallelism: 2},
+			{Name: MixRunnerName, Rate: 1000, Parallelism: 2, Mix: map[string]int{"TEST_COUNT": 1}},
+		},
+	}
+	s.setDefaults()
+
+	runners, err := s.Start(ctx, &RunnerEnv{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 2, len(runners); e != g {
+		t.Fatalf("want %d runners but got %d", e, g)
+	}
+	select {
+	case <-AllDone(runners...):
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	for _, ar := range runners {
+		v, ok := ar.StatsByFuncName("Test.Count")
+		if !ok {
+			t.Fatal("Test.Count stats not found")
+		}
+		if e, g := int64(10), v.Count; e != g {
+			t.Errorf("want Count %d but got %d", e, g)
+		}
+		if e, g := int64(100), ar.Seed(); e != g {
+			t.Errorf("want Seed %d but got %d", e, g)
+		}
+	}
+}
+
+func TestScenario_Start_PartitionKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &Scenario{
+		Iterations: 1,
+		Shard:      Shard{Index: 1, Count: 2},
+		Runners: []*RunnerSpec{
+			{Name: "TEST_COUNT", Rate: 1000, Parallelism: 1, PartitionKeys: true},
+			{Name: MixRunnerName, Rate: 1000, Parallelism: 1, Mix: map[string]int{"TEST_COUNT": 1}},
+		},
+	}
+	s.setDefaults()
+
+	runners, err := s.Start(ctx, &RunnerEnv{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-AllDone(runners...):
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	if e, g := (Shard{Index: 1, Count: 2}), runners[0].Shard(); e != g {
+		t.Errorf("want Shard %s but got %s", e, g)
+	}
+	// partitionKeysを指定しないRunnerはすべてのkeyを使う
+	if e, g := NoShard, runners[1].Shard(); e != g {
+		t.Errorf("want Shard %s but got %s", e, g)
+	}
+}
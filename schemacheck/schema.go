@@ -0,0 +1,258 @@
+// Package schemacheck is Goのstructやstoreのクエリと ddl/*.sql のschemaのずれを検出する
+//
+// structはspanner tagを見てColumnと型を比べる
+// storeはsource codeを読んで、spanner.NewStatementに渡しているSQL, Readに渡しているTableとColumn, Mutationに渡しているColumnを比べる
+// SpannerのTable名とColumn名は大文字小文字を区別しないので、大文字小文字だけ違う場合はWarningにする
+package schemacheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner/spansql"
+	"github.com/sinmetal/srunner/ddl"
+)
+
+// Schema is DDLから読み込んだTableとIndex
+type Schema struct {
+	tables  map[string]*Table
+	indexes map[string]*Index
+}
+
+// Table is DDLで定義されているTable
+type Table struct {
+	Name    string
+	Columns []*Column
+}
+
+// Column is DDLで定義されているColumn
+type Column struct {
+	Name      string
+	Type      spansql.Type
+	NotNull   bool
+	Generated bool
+}
+
+// Index is DDLで定義されているIndex
+type Index struct {
+	Name  string
+	Table string
+}
+
+// LoadSchema is GoogleSQLのDDL fileを読んでSchemaを作る
+func LoadSchema(files ...string) (*Schema, error) {
+	var stmts []string
+	for _, fn := range files {
+		v, err := ddl.ReadFile(fn, ddl.GoogleSQL)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, v...)
+	}
+	return ParseSchema(stmts)
+}
+
+// ParseSchema is DDLのStatementを順番に適用してSchemaを作る
+// CREATE TABLE, ALTER TABLE ADD/DROP COLUMN, CREATE INDEX, DROP TABLE, DROP INDEX 以外のStatementは無視する
+func ParseSchema(stmts []string) (*Schema, error) {
+	s := &Schema{
+		tables:  make(map[string]*Table),
+		indexes: make(map[string]*Index),
+	}
+	for _, stmt := range stmts {
+		v, err := spansql.ParseDDLStmt(stmt)
+		if err != nil {
+			return nil, fmt.Errorf("failed parse ddl %q : %w", stmt, err)
+		}
+		switch v := v.(type) {
+		case *spansql.CreateTable:
+			t := &Table{Name: string(v.Name)}
+			for _, cd := range v.Columns {
+				t.Columns = append(t.Columns, newColumn(cd))
+			}
+			s.tables[key(t.Name)] = t
+		case *spansql.AlterTable:
+			t, ok := s.Table(string(v.Name))
+			if !ok {
+				return nil, fmt.Errorf("alter table %s is not found", v.Name)
+			}
+			switch a := v.Alteration.(type) {
+			case spansql.AddColumn:
+				t.Columns = append(t.Columns, newColumn(a.Def))
+			case spansql.DropColumn:
+				t.dropColumn(string(a.Name))
+			}
+		case *spansql.DropTable:
+			delete(s.tables, key(string(v.Name)))
+		case *spansql.CreateIndex:
+			s.indexes[key(string(v.Name))] = &Index{Name: string(v.Name), Table: string(v.Table)}
+		case *spansql.DropIndex:
+			delete(s.indexes, key(string(v.Name)))
+		}
+	}
+	return s, nil
+}
+
+func newColumn(cd spansql.ColumnDef) *Column {
+	return &Column{
+		Name:      string(cd.Name),
+		Type:      cd.Type,
+		NotNull:   cd.NotNull,
+		Generated: cd.Generated != nil,
+	}
+}
+
+// key is 大文字小文字を区別しないで引くためのkey
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+// Table is nameのTableを返す. 大文字小文字は区別しない
+func (s *Schema) Table(name string) (*Table, bool) {
+	t, ok := s.tables[key(name)]
+	return t, ok
+}
+
+// Tables is Table名の順に並べたTableを返す
+func (s *Schema) Tables() []*Table {
+	var ret []*Table
+	for _, t := range s.tables {
+		ret = append(ret, t)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Index is nameのIndexを返す. 大文字小文字は区別しない
+func (s *Schema) Index(name string) (*Index, bool) {
+	idx, ok := s.indexes[key(name)]
+	return idx, ok
+}
+
+// Column is nameのColumnを返す. 大文字小文字は区別しない
+func (t *Table) Column(name string) (*Column, bool) {
+	for _, c := range t.Columns {
+		if key(c.Name) == key(name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func (t *Table) dropColumn(name string) {
+	for i, c := range t.Columns {
+		if key(c.Name) == key(name) {
+			t.Columns = append(t.Columns[:i], t.Columns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Kind is Issueの種類
+type Kind string
+
+const (
+	KindMissingTable   Kind = "missing table"
+	KindMissingColumn  Kind = "missing column"
+	KindMissingIndex   Kind = "missing index"
+	KindTypeMismatch   Kind = "type mismatch"
+	KindUnmappedColumn Kind = "unmapped column"
+	KindCaseMismatch   Kind = "case mismatch"
+)
+
+// Issue is schemaとのずれ
+type Issue struct {
+	// Pos is ずれがある場所. source codeの場合は file:line, structの場合は型名
+	Pos     string
+	Kind    Kind
+	Table   string
+	Column  string
+	Message string
+}
+
+// Warning is 実行はできるが、確認した方がいいIssueかどうか
+// KindUnmappedColumn はstructがColumnを読み書きしないだけで、KindCaseMismatch はSpannerでは同じ名前として扱われる
+func (i *Issue) Warning() bool {
+	return i.Kind == KindUnmappedColumn || i.Kind == KindCaseMismatch
+}
+
+func (i *Issue) String() string {
+	level := "error"
+	if i.Warning() {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", i.Pos, level, i.Kind, i.Message)
+}
+
+// Errors is Warning以外のIssueを返す
+func Errors(issues []*Issue) []*Issue {
+	var ret []*Issue
+	for _, v := range issues {
+		if !v.Warning() {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// checker is Issueを集める
+type checker struct {
+	schema *Schema
+	pos    string
+	issues []*Issue
+}
+
+func (c *checker) add(kind Kind, table string, column string, format string, args ...interface{}) {
+	c.issues = append(c.issues, &Issue{
+		Pos:     c.pos,
+		Kind:    kind,
+		Table:   table,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// table is nameのTableがあるかを確認する
+func (c *checker) table(name string) (*Table, bool) {
+	t, ok := c.schema.Table(name)
+	if !ok {
+		c.add(KindMissingTable, name, "", "table %s is not found", name)
+		return nil, false
+	}
+	if t.Name != name {
+		c.add(KindCaseMismatch, name, "", "table %s is defined as %s", name, t.Name)
+	}
+	return t, true
+}
+
+// column is tableにnameのColumnがあるかを確認する
+func (c *checker) column(t *Table, name string) (*Column, bool) {
+	col, ok := t.Column(name)
+	if !ok {
+		c.add(KindMissingColumn, t.Name, name, "column %s is not found in %s", name, t.Name)
+		return nil, false
+	}
+	if col.Name != name {
+		c.add(KindCaseMismatch, t.Name, name, "column %s.%s is defined as %s", t.Name, name, col.Name)
+	}
+	return col, true
+}
+
+// index is nameのIndexがtableにあるかを確認する. tableが空の場合はIndexがあるかだけを確認する
+func (c *checker) index(table string, name string) {
+	idx, ok := c.schema.Index(name)
+	if !ok {
+		c.add(KindMissingIndex, table, "", "index %s is not found", name)
+		return
+	}
+	if table != "" && key(idx.Table) != key(table) {
+		c.add(KindMissingIndex, table, "", "index %s is defined on %s, not %s", name, idx.Table, table)
+		return
+	}
+	if idx.Name != name {
+		c.add(KindCaseMismatch, table, "", "index %s is defined as %s", name, idx.Name)
+	}
+}
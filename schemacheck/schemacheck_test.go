@@ -0,0 +1,140 @@
+package schemacheck
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestParseSchema(t *testing.T) {
+	s := Load(t, "testdata/schema.sql")
+
+	albums, ok := s.Table("albums")
+	if !ok {
+		t.Fatal("Albums is not found")
+	}
+	if e, g := "Albums", albums.Name; e != g {
+		t.Errorf("want %s but got %s", e, g)
+	}
+	if _, ok := albums.Column("Price"); !ok {
+		t.Errorf("Albums.Price added by ALTER TABLE is not found")
+	}
+	if idx, ok := s.Index("SingersByName"); !ok || idx.Table != "Singers" {
+		t.Errorf("SingersByName is not found or wrong table : %+v", idx)
+	}
+}
+
+func TestCheckStruct(t *testing.T) {
+	s := Load(t, "testdata/schema.sql")
+
+	type Singer struct {
+		SingerID  string
+		Name      spanner.NullString
+		Tags      []string
+		Info      spanner.NullJSON
+		CreatedAt time.Time
+	}
+	type SingerDrift struct {
+		ID        string `spanner:"SingerID"`
+		Name      int64
+		Tags      string
+		Age       int64
+		Info      interface{} `spanner:"-"`
+		CreatedAt time.Time
+		secret    string
+	}
+
+	cases := []struct {
+		name string
+		v    interface{}
+		want []string
+	}{
+		{"match", &Singer{}, nil},
+		{"drift", SingerDrift{}, []string{
+			"schemacheck.SingerDrift: error: type mismatch: field Name int64 can not be used for Singers.Name STRING(MAX)",
+			"schemacheck.SingerDrift: error: type mismatch: field Tags string can not be used for Singers.Tags ARRAY<STRING(MAX)>",
+			"schemacheck.SingerDrift: error: missing column: column Age is not found in Singers",
+			"schemacheck.SingerDrift: warning: unmapped column: column Singers.Info has no field in schemacheck.SingerDrift",
+		}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueStrings(CheckStruct(s, "Singers", tt.v))
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("want %q\n but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckSQL(t *testing.T) {
+	s := Load(t, "testdata/schema.sql")
+
+	cases := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"select", "SELECT SingerID, Name FROM Singers WHERE Name = @Name ORDER BY CreatedAt DESC LIMIT 10", nil},
+		{"join and alias", "SELECT s.Name, a.Title, COUNT(*) AS Cnt FROM Singers AS s JOIN Albums a ON s.SingerID = a.SingerID GROUP BY s.Name, a.Title ORDER BY Cnt", nil},
+		{"subquery and unnest", `SELECT c.Name FROM UNNEST(ARRAY(SELECT AS STRUCT * FROM Singers WHERE Name LIKE "%;FROM x%" LIMIT 1)) AS c`, nil},
+		{"dml", "INSERT INTO Albums (SingerID, AlbumID, Title) VALUES (@SingerID, @AlbumID, 'FROM Songs')", nil},
+		{"function and keyword", "SELECT EXTRACT(DATE FROM CreatedAt) AS d, CAST(Price AS STRING) FROM Singers JOIN Albums USING (SingerID)", nil},
+		{"missing table", "SELECT * FROM Songs WHERE Title = @Title", []string{
+			": error: missing table: table Songs is not found",
+		}},
+		{"missing column", "UPDATE Singers SET Age = 1 WHERE SingerID = @ID", []string{
+			": error: missing column: column Age is not found in Singers",
+		}},
+		{"qualified column", "SELECT a.Name FROM Albums a", []string{
+			": error: missing column: column Name is not found in Albums",
+		}},
+		{"index", "SELECT Name FROM Singers@{FORCE_INDEX=SingersByAge} WHERE Name = 'a'", []string{
+			": error: missing index: index SingersByAge is not found",
+		}},
+		{"case", "SELECT singerId FROM singers", []string{
+			": warning: case mismatch: table singers is defined as Singers",
+			": warning: case mismatch: column Singers.singerId is defined as SingerID",
+		}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueStrings(CheckSQL(s, tt.sql))
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("want %q\n but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckPackage(t *testing.T) {
+	s := Load(t, "testdata/schema.sql")
+
+	issues, err := CheckPackage(s, filepath.Join("testdata", "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join("testdata", "store", "store.go")
+	want := []string{
+		fn + ":21: error: missing index: index SingersByAge is not found",
+		fn + ":21: error: missing column: column Nmae is not found in Singers",
+		fn + ":34: error: missing column: column Titel is not found in Albums",
+		fn + ":43: error: missing table: table Songs is not found",
+		fn + ":44: warning: case mismatch: column Singers.singerid is defined as SingerID",
+		fn + ":58: error: missing column: column Rating is not found in Albums",
+	}
+	if got := issueStrings(issues); !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q\n but got %q", want, got)
+	}
+}
+
+func issueStrings(issues []*Issue) []string {
+	var ret []string
+	for _, v := range issues {
+		ret = append(ret, v.String())
+	}
+	return ret
+}
@@ -0,0 +1,464 @@
+package schemacheck
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const spannerImportPath = "cloud.google.com/go/spanner"
+
+// readMethods is Table, Columnを引数に取るReadのmethodと、Index, Columnsが何番目の引数か
+// 引数は (ctx, table, ...) なので、Tableは常に1番目
+var readMethods = map[string]struct{ index, columns int }{
+	"Read":                {-1, 3},
+	"ReadWithOptions":     {-1, 3},
+	"ReadRow":             {-1, 3},
+	"ReadRowWithOptions":  {-1, 3},
+	"ReadUsingIndex":      {2, 4},
+	"ReadRowUsingIndex":   {2, 4},
+	"ReadRowUsingIndexes": {2, 4},
+}
+
+// mutationFuncs is spanner packageのMutationを作る関数. 引数は (table, columns, values)
+var mutationFuncs = map[string]bool{
+	"Insert":         true,
+	"Update":         true,
+	"InsertOrUpdate": true,
+	"Replace":        true,
+}
+
+// mutationMapFuncs is spanner packageのmapからMutationを作る関数. 引数は (table, map)
+var mutationMapFuncs = map[string]bool{
+	"InsertMap":         true,
+	"UpdateMap":         true,
+	"InsertOrUpdateMap": true,
+	"ReplaceMap":        true,
+}
+
+// CheckPackage is dirにあるGoのsource code(testは除く)から、Spannerに渡しているSQL, Table, Column, Indexを探してschemaと比べる
+//
+// 次のものを確認する
+//   - spanner.NewStatement, spanner.Statement{SQL: ...} に渡しているSQL
+//   - Read, ReadRow などに渡しているTable, Column, ReadOptions.Index
+//   - spanner.Insert, spanner.InsertMap などに渡しているTable, Column
+//
+// 引数はstring literal, package内の定数, 同じ関数内で代入した変数, literalを返すだけのmethodの場合に解決する
+// 解決できない引数は確認しない
+func CheckPackage(s *Schema, dir string) ([]*Issue, error) {
+	fset := token.NewFileSet()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	pkg := &sourcePackage{
+		consts: make(map[string]ast.Expr),
+		funcs:  make(map[string]ast.Expr),
+		byName: make(map[string][]string),
+	}
+	var parsed []*ast.File
+	for _, fn := range files {
+		if strings.HasSuffix(fn, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fn, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed parse %s : %w", fn, err)
+		}
+		pkg.collect(f)
+		parsed = append(parsed, f)
+	}
+
+	var issues []*Issue
+	for _, f := range parsed {
+		spannerName := importName(f, spannerImportPath)
+		if spannerName == "" {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			sc := &sourceChecker{
+				pkg:     pkg,
+				fset:    fset,
+				schema:  s,
+				spanner: spannerName,
+				locals:  make(map[string]ast.Expr),
+			}
+			if fd.Recv != nil && len(fd.Recv.List[0].Names) > 0 {
+				sc.recv = fd.Recv.List[0].Names[0].Name
+				sc.recvType = recvTypeName(fd)
+			}
+			ast.Inspect(fd.Body, sc.visit)
+			issues = append(issues, sc.issues...)
+		}
+	}
+	return issues, nil
+}
+
+// sourcePackage is package全体で解決できる定数とmethod
+type sourcePackage struct {
+	// consts is package levelの const, var
+	consts map[string]ast.Expr
+
+	// funcs is 値を1つ返すだけの関数, method. e.g. func (s *Store) TableName() string { return "Tweets" }
+	// keyは関数名か 型名.method名
+	funcs map[string]ast.Expr
+
+	// byName is method名から funcs のkeyを引く
+	byName map[string][]string
+}
+
+func (p *sourcePackage) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.CONST && d.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range d.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if !ok || len(vs.Names) != len(vs.Values) {
+					continue
+				}
+				for i, name := range vs.Names {
+					p.consts[name.Name] = vs.Values[i]
+				}
+			}
+		case *ast.FuncDecl:
+			if d.Body == nil || len(d.Body.List) != 1 {
+				continue
+			}
+			ret, ok := d.Body.List[0].(*ast.ReturnStmt)
+			if !ok || len(ret.Results) != 1 {
+				continue
+			}
+			name := d.Name.Name
+			if d.Recv != nil {
+				name = recvTypeName(d) + "." + name
+				p.byName[d.Name.Name] = append(p.byName[d.Name.Name], name)
+			}
+			p.funcs[name] = ret.Results[0]
+		}
+	}
+}
+
+// recvTypeName is methodのreceiverの型名を返す
+func recvTypeName(fd *ast.FuncDecl) string {
+	e := fd.Recv.List[0].Type
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	if id, ok := e.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// method is x.name() で呼んでいるmethodの値を返す
+// xがreceiverの場合はreceiverの型のmethod, それ以外はpackageに同じ名前のmethodが1つだけの場合にそのmethodを使う
+func (sc *sourceChecker) method(x ast.Expr, name string) (ast.Expr, bool) {
+	if id, ok := x.(*ast.Ident); ok && sc.recv != "" && id.Name == sc.recv {
+		v, ok := sc.pkg.funcs[sc.recvType+"."+name]
+		return v, ok
+	}
+	if keys := sc.pkg.byName[name]; len(keys) == 1 {
+		return sc.pkg.funcs[keys[0]], true
+	}
+	return nil, false
+}
+
+func importName(f *ast.File, path string) string {
+	for _, imp := range f.Imports {
+		if v, err := strconv.Unquote(imp.Path.Value); err != nil || v != path {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return filepath.Base(path)
+	}
+	return ""
+}
+
+// sourceChecker is 1つの関数を確認する
+type sourceChecker struct {
+	pkg     *sourcePackage
+	fset    *token.FileSet
+	schema  *Schema
+	spanner string
+
+	// recv, recvType is 確認している関数がmethodの場合のreceiverの名前と型名
+	recv     string
+	recvType string
+
+	// locals is 関数内で代入した変数. 後から代入したもので上書きする
+	locals map[string]ast.Expr
+	issues []*Issue
+}
+
+func (sc *sourceChecker) visit(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.AssignStmt:
+		if n.Tok != token.DEFINE && n.Tok != token.ASSIGN || len(n.Lhs) != len(n.Rhs) {
+			return true
+		}
+		for i, lhs := range n.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok {
+				sc.locals[id.Name] = n.Rhs[i]
+			}
+		}
+	case *ast.ValueSpec:
+		if len(n.Names) == len(n.Values) {
+			for i, name := range n.Names {
+				sc.locals[name.Name] = n.Values[i]
+			}
+		}
+	case *ast.CompositeLit:
+		if sc.isSpannerType(n.Type, "Statement") {
+			if sql, ok := sc.resolveString(fieldValue(n, "SQL"), 0); ok {
+				sc.checkSQL(n.Pos(), sql)
+			}
+		}
+	case *ast.CallExpr:
+		sc.call(n)
+	}
+	return true
+}
+
+func (sc *sourceChecker) call(call *ast.CallExpr) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	name := sel.Sel.Name
+	if sc.isSpannerIdent(sel.X) {
+		switch {
+		case name == "NewStatement" && len(call.Args) == 1:
+			if sql, ok := sc.resolveString(call.Args[0], 0); ok {
+				sc.checkSQL(call.Pos(), sql)
+			}
+		case mutationFuncs[name] && len(call.Args) == 3:
+			sc.checkColumns(call.Pos(), call.Args[0], call.Args[1], nil)
+		case mutationMapFuncs[name] && len(call.Args) == 2:
+			sc.checkColumns(call.Pos(), call.Args[0], nil, sc.mapKeys(call.Args[1]))
+		}
+		return
+	}
+	m, ok := readMethods[name]
+	if !ok || len(call.Args) <= m.columns {
+		return
+	}
+	table, ok := sc.resolveString(call.Args[1], 0)
+	if !ok {
+		return
+	}
+	c := sc.checker(call.Pos())
+	t, ok := c.table(table)
+	if !ok {
+		sc.issues = append(sc.issues, c.issues...)
+		return
+	}
+	if m.index >= 0 {
+		if idx, ok := sc.resolveString(call.Args[m.index], 0); ok && idx != "" {
+			c.index(t.Name, idx)
+		}
+	}
+	if len(call.Args) > m.columns+1 {
+		if idx, ok := sc.resolveString(fieldValue(sc.compositeLit(call.Args[m.columns+1]), "Index"), 0); ok && idx != "" {
+			c.index(t.Name, idx)
+		}
+	}
+	if cols, ok := sc.resolveStrings(call.Args[m.columns]); ok {
+		for _, col := range cols {
+			c.column(t, col)
+		}
+	}
+	sc.issues = append(sc.issues, c.issues...)
+}
+
+func (sc *sourceChecker) checker(pos token.Pos) *checker {
+	p := sc.fset.Position(pos)
+	return &checker{schema: sc.schema, pos: fmt.Sprintf("%s:%d", p.Filename, p.Line)}
+}
+
+func (sc *sourceChecker) checkSQL(pos token.Pos, sql string) {
+	c := sc.checker(pos)
+	c.sql(sql)
+	sc.issues = append(sc.issues, c.issues...)
+}
+
+// checkColumns is tableにcolumnsExprかkeysのColumnがあるかを確認する
+func (sc *sourceChecker) checkColumns(pos token.Pos, tableExpr ast.Expr, columnsExpr ast.Expr, keys []string) {
+	table, ok := sc.resolveString(tableExpr, 0)
+	if !ok {
+		return
+	}
+	c := sc.checker(pos)
+	t, ok := c.table(table)
+	if ok {
+		cols := keys
+		if columnsExpr != nil {
+			cols, _ = sc.resolveStrings(columnsExpr)
+		}
+		for _, col := range cols {
+			c.column(t, col)
+		}
+	}
+	sc.issues = append(sc.issues, c.issues...)
+}
+
+func (sc *sourceChecker) isSpannerIdent(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == sc.spanner
+}
+
+// isSpannerType is eが spanner.name か *spanner.name かどうか
+func (sc *sourceChecker) isSpannerType(e ast.Expr, name string) bool {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	sel, ok := e.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == name && sc.isSpannerIdent(sel.X)
+}
+
+// compositeLit is e が T{...} か &T{...} の場合にCompositeLitを返す
+func (sc *sourceChecker) compositeLit(e ast.Expr) *ast.CompositeLit {
+	if u, ok := e.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		e = u.X
+	}
+	if id, ok := e.(*ast.Ident); ok {
+		if v, ok := sc.locals[id.Name]; ok {
+			return sc.compositeLit(v)
+		}
+	}
+	cl, _ := e.(*ast.CompositeLit)
+	return cl
+}
+
+// fieldValue is T{Field: value} のvalueを返す
+func fieldValue(cl *ast.CompositeLit, field string) ast.Expr {
+	if cl == nil {
+		return nil
+	}
+	for _, elt := range cl.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if id, ok := kv.Key.(*ast.Ident); ok && id.Name == field {
+			return kv.Value
+		}
+	}
+	return nil
+}
+
+// mapKeys is map literalのkeyを返す
+func (sc *sourceChecker) mapKeys(e ast.Expr) []string {
+	cl := sc.compositeLit(e)
+	if cl == nil {
+		return nil
+	}
+	var ret []string
+	for _, elt := range cl.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if v, ok := sc.resolveString(kv.Key, 0); ok {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// resolveStrings is []string{...} の値を返す
+func (sc *sourceChecker) resolveStrings(e ast.Expr) ([]string, bool) {
+	cl := sc.compositeLit(e)
+	if cl == nil {
+		return nil, false
+	}
+	var ret []string
+	for _, elt := range cl.Elts {
+		v, ok := sc.resolveString(elt, 0)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, v)
+	}
+	return ret, true
+}
+
+// fmtVerb is fmt.Sprintfのverb. SQLでは値の場所に使っているので 0 に置き換える
+var fmtVerb = regexp.MustCompile(`%%|%[-+# 0-9.\[\]]*[a-zA-Z]`)
+
+// resolveString is eのstringの値を返す
+func (sc *sourceChecker) resolveString(e ast.Expr, depth int) (string, bool) {
+	if e == nil || depth > 8 {
+		return "", false
+	}
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		v, err := strconv.Unquote(e.Value)
+		return v, err == nil
+	case *ast.ParenExpr:
+		return sc.resolveString(e.X, depth+1)
+	case *ast.Ident:
+		if v, ok := sc.locals[e.Name]; ok {
+			return sc.resolveString(v, depth+1)
+		}
+		if v, ok := sc.pkg.consts[e.Name]; ok {
+			return sc.resolveString(v, depth+1)
+		}
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := sc.resolveString(e.X, depth+1)
+		if !ok {
+			return "", false
+		}
+		y, ok := sc.resolveString(e.Y, depth+1)
+		if !ok {
+			return "", false
+		}
+		return x + y, true
+	case *ast.CallExpr:
+		switch fun := e.Fun.(type) {
+		case *ast.Ident:
+			if v, ok := sc.pkg.funcs[fun.Name]; ok && len(e.Args) == 0 {
+				return sc.resolveString(v, depth+1)
+			}
+		case *ast.SelectorExpr:
+			if id, ok := fun.X.(*ast.Ident); ok && id.Name == "fmt" && fun.Sel.Name == "Sprintf" && len(e.Args) > 0 {
+				format, ok := sc.resolveString(e.Args[0], depth+1)
+				if !ok {
+					return "", false
+				}
+				return fmtVerb.ReplaceAllStringFunc(format, func(v string) string {
+					if v == "%%" {
+						return "%"
+					}
+					return "0"
+				}), true
+			}
+			if v, ok := sc.method(fun.X, fun.Sel.Name); ok && len(e.Args) == 0 {
+				return sc.resolveString(v, depth+1)
+			}
+		}
+	}
+	return "", false
+}
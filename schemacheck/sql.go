@@ -0,0 +1,278 @@
+package schemacheck
+
+import (
+	"strings"
+)
+
+// CheckSQL is GoogleSQLのQueryとDMLが参照しているTable, Column, Indexがschemaにあるかを確認する
+//
+// spansqlはsubqueryなどをparseできないので、tokenに分けて次のように確認する
+//   - FROM, JOIN, INTO, UPDATE の次のidentifierをTableとして扱う. @{FORCE_INDEX=...} があればIndexも確認する
+//   - alias.Column はaliasがTableの場合にColumnを確認する
+//   - 修飾されていないidentifierは、参照しているTableのどれかにあるかを確認する
+//     AS で定義した名前, 関数名, keywordは除く. 参照しているTableにschemaにないものがある場合は確認しない
+func CheckSQL(s *Schema, sql string) []*Issue {
+	c := &checker{schema: s}
+	c.sql(sql)
+	return c.issues
+}
+
+func (c *checker) sql(sql string) {
+	toks := tokenize(sql)
+
+	tables := make(map[string]*Table) // alias or table name -> Table
+	var refs []*Table
+	defined := make(map[string]bool)
+	skip := make(map[int]bool)
+	allFound := true
+
+	for i, tok := range toks {
+		if tok.kind != tokIdent {
+			continue
+		}
+		// AS x, ) x で定義した名前
+		if i > 0 && (toks[i-1].is("AS") || toks[i-1].text == ")") && !isKeyword(tok.text) {
+			defined[key(tok.text)] = true
+			skip[i] = true
+			continue
+		}
+		if !(tok.is("FROM") || tok.is("JOIN") || tok.is("INTO") || tok.is("UPDATE")) {
+			continue
+		}
+		if i >= 3 && toks[i-3].is("EXTRACT") {
+			// EXTRACT(DATE FROM CreatedAt)
+			continue
+		}
+		j := i + 1
+		if j >= len(toks) || toks[j].kind != tokIdent || isKeyword(toks[j].text) {
+			continue
+		}
+		name := toks[j].text
+		skip[j] = true
+		t, ok := c.table(name)
+		if !ok {
+			allFound = false
+			defined[key(name)] = true
+		} else {
+			refs = append(refs, t)
+			tables[key(name)] = t
+		}
+		j++
+		if j < len(toks) && toks[j].kind == tokHint {
+			if idx, ok := forceIndex(toks[j].text); ok && t != nil {
+				c.index(t.Name, idx)
+			}
+			j++
+		}
+		if j < len(toks) && toks[j].is("AS") {
+			j++
+		}
+		if j < len(toks) && toks[j].kind == tokIdent && !isKeyword(toks[j].text) {
+			skip[j] = true
+			defined[key(toks[j].text)] = true
+			if t != nil {
+				tables[key(toks[j].text)] = t
+			}
+		}
+	}
+
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.kind != tokIdent || skip[i] || isKeyword(tok.text) {
+			continue
+		}
+		if i+1 < len(toks) && toks[i+1].text == "(" {
+			// 関数
+			continue
+		}
+		if i > 0 && toks[i-1].text == "." {
+			continue
+		}
+		if i+2 < len(toks) && toks[i+1].text == "." && toks[i+2].kind == tokIdent {
+			// alias.Column
+			if t, ok := tables[key(tok.text)]; ok {
+				c.column(t, toks[i+2].text)
+			}
+			i += 2
+			continue
+		}
+		if defined[key(tok.text)] || tables[key(tok.text)] != nil {
+			continue
+		}
+		if !allFound || len(refs) == 0 {
+			continue
+		}
+		c.unqualifiedColumn(refs, tok.text)
+	}
+}
+
+// unqualifiedColumn is refsのどれかにnameのColumnがあるかを確認する
+func (c *checker) unqualifiedColumn(refs []*Table, name string) {
+	var names []string
+	for _, t := range refs {
+		if _, ok := t.Column(name); ok {
+			c.column(t, name)
+			return
+		}
+		names = append(names, t.Name)
+	}
+	c.add(KindMissingColumn, strings.Join(names, ","), name, "column %s is not found in %s", name, strings.Join(names, ", "))
+}
+
+// forceIndex is @{FORCE_INDEX=xxx} からIndex名を取り出す. _BASE_TABLE の場合はfalseを返す
+func forceIndex(hint string) (string, bool) {
+	body := strings.TrimSuffix(strings.TrimPrefix(hint, "@{"), "}")
+	for _, kv := range strings.Split(body, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "FORCE_INDEX") {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if strings.EqualFold(v, "_BASE_TABLE") {
+			return "", false
+		}
+		return v, true
+	}
+	return "", false
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokParam
+	tokHint
+	tokPunct
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+}
+
+// is is keywordかどうかを大文字小文字を区別せずに比べる
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, keyword)
+}
+
+// tokenize is GoogleSQLをtokenに分ける. commentは取り除く
+// `...` のquoted identifierはquoteを外したidentifierにする
+func tokenize(sql string) []sqlToken {
+	var toks []sqlToken
+	pos := 0
+	for pos < len(sql) {
+		c := sql[pos]
+		rest := sql[pos:]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+		case strings.HasPrefix(rest, "--") || c == '#':
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			pos += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				pos = len(sql)
+			} else {
+				pos += end + 4
+			}
+		case strings.HasPrefix(rest, "@{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			toks = append(toks, sqlToken{kind: tokHint, text: rest[:end+1]})
+			pos += end + 1
+		case c == '@':
+			end := 1
+			for end < len(rest) && isIdentByte(rest[end]) {
+				end++
+			}
+			toks = append(toks, sqlToken{kind: tokParam, text: rest[:end]})
+			pos += end
+		case c == '\'' || c == '"':
+			end := quotedEnd(rest)
+			toks = append(toks, sqlToken{kind: tokString, text: rest[:end]})
+			pos += end
+		case c == '`':
+			end := strings.IndexByte(rest[1:], '`')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			toks = append(toks, sqlToken{kind: tokIdent, text: rest[1 : end+1]})
+			pos += end + 2
+		case c >= '0' && c <= '9':
+			end := 1
+			for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			toks = append(toks, sqlToken{kind: tokNumber, text: rest[:end]})
+			pos += end
+		case isIdentByte(c):
+			end := 1
+			for end < len(rest) && isIdentByte(rest[end]) {
+				end++
+			}
+			toks = append(toks, sqlToken{kind: tokIdent, text: rest[:end]})
+			pos += end
+		default:
+			toks = append(toks, sqlToken{kind: tokPunct, text: rest[:1]})
+			pos++
+		}
+	}
+	return toks
+}
+
+// quotedEnd is quoteを1つか3つ続けて囲んだ文字列literalの終わりの位置を返す
+func quotedEnd(s string) int {
+	quote := s[:1]
+	if triple := strings.Repeat(quote, 3); strings.HasPrefix(s, triple) {
+		if end := strings.Index(s[3:], triple); end >= 0 {
+			return end + 6
+		}
+		return len(s)
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote[0]:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isKeyword(v string) bool {
+	return keywords[strings.ToUpper(v)]
+}
+
+// keywords is identifierとして扱わない語
+// 予約語に加えて、型名, 日付のpart, 引数なしで書ける関数を含む
+var keywords = map[string]bool{}
+
+func init() {
+	for _, v := range strings.Fields(`
+ALL AND ANY ARRAY AS ASC ASSERT_ROWS_MODIFIED AT BETWEEN BY CASE CAST COLLATE CONTAINS CREATE CROSS CUBE CURRENT
+DEFAULT DEFINE DESC DISTINCT ELSE END ENUM ESCAPE EXCEPT EXCLUDE EXISTS EXTRACT FALSE FETCH FOLLOWING FOR FROM FULL
+GROUP GROUPING GROUPS HASH HAVING IF IGNORE IN INNER INTERSECT INTERVAL INTO IS JOIN LATERAL LEFT LIKE LIMIT LOOKUP
+MERGE NATURAL NEW NO NOT NULL NULLS OF OFFSET ON OR ORDER OUTER OVER PARTITION PRECEDING PROTO RANGE RECURSIVE
+RESPECT RIGHT ROLLUP ROWS SELECT SET SOME STRUCT TABLESAMPLE THEN TO TREAT TRUE UNBOUNDED UNION UNNEST USING WHEN
+WHERE WINDOW WITH WITHIN
+INSERT UPDATE DELETE VALUES RETURN
+BOOL INT64 FLOAT32 FLOAT64 NUMERIC STRING BYTES DATE TIMESTAMP JSON MAX
+MICROSECOND MILLISECOND SECOND MINUTE HOUR DAY DAYOFWEEK DAYOFYEAR WEEK ISOWEEK MONTH QUARTER YEAR ISOYEAR
+CURRENT_DATE CURRENT_TIMESTAMP PENDING_COMMIT_TIMESTAMP
+`) {
+		keywords[v] = true
+	}
+}
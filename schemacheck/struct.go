@@ -0,0 +1,118 @@
+package schemacheck
+
+import (
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/spansql"
+)
+
+// CheckStruct is vのspanner tagを見て、tableのColumnと比べる
+//
+// structのFieldにColumnがない場合と、Fieldの型をColumnの型として読み書きできない場合はErrorにする
+// tableのColumnのうち、structにFieldがないものはWarningにする. spanner:"-" にしてFromRowで読んでいる場合もWarningになる
+func CheckStruct(s *Schema, table string, v interface{}) []*Issue {
+	rt := reflect.TypeOf(v)
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	c := &checker{schema: s, pos: rt.String()}
+	t, ok := c.table(table)
+	if !ok {
+		return c.issues
+	}
+
+	mapped := make(map[string]bool)
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("spanner"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		col, ok := c.column(t, name)
+		if !ok {
+			continue
+		}
+		mapped[key(col.Name)] = true
+		if base, array, known := spannerType(f.Type); known && (base != col.Type.Base || array != col.Type.Array) {
+			c.add(KindTypeMismatch, t.Name, col.Name, "field %s %s can not be used for %s.%s %s", f.Name, f.Type, t.Name, col.Name, col.Type.SQL())
+		}
+	}
+	for _, col := range t.Columns {
+		if !mapped[key(col.Name)] {
+			c.add(KindUnmappedColumn, t.Name, col.Name, "column %s.%s has no field in %s", t.Name, col.Name, rt.String())
+		}
+	}
+	return c.issues
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	nullTimeType    = reflect.TypeOf(spanner.NullTime{})
+	dateType        = reflect.TypeOf(civil.Date{})
+	nullDateType    = reflect.TypeOf(spanner.NullDate{})
+	ratType         = reflect.TypeOf(big.Rat{})
+	nullNumericType = reflect.TypeOf(spanner.NullNumeric{})
+	nullJSONType    = reflect.TypeOf(spanner.NullJSON{})
+	nullStringType  = reflect.TypeOf(spanner.NullString{})
+	nullInt64Type   = reflect.TypeOf(spanner.NullInt64{})
+	nullFloat64Type = reflect.TypeOf(spanner.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(spanner.NullBool{})
+)
+
+// spannerType is Goの型をSpannerの型にする. 判断できない型の場合はknown=falseを返す
+func spannerType(t reflect.Type) (base spansql.TypeBase, array bool, known bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType, nullTimeType:
+		return spansql.Timestamp, false, true
+	case dateType, nullDateType:
+		return spansql.Date, false, true
+	case ratType, nullNumericType:
+		return spansql.Numeric, false, true
+	case nullJSONType:
+		return spansql.JSON, false, true
+	case nullStringType:
+		return spansql.String, false, true
+	case nullInt64Type:
+		return spansql.Int64, false, true
+	case nullFloat64Type:
+		return spansql.Float64, false, true
+	case nullBoolType:
+		return spansql.Bool, false, true
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return spansql.String, false, true
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8,
+		reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16:
+		return spansql.Int64, false, true
+	case reflect.Float64, reflect.Float32:
+		return spansql.Float64, false, true
+	case reflect.Bool:
+		return spansql.Bool, false, true
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return spansql.Bytes, false, true
+		}
+		base, array, known := spannerType(t.Elem())
+		if !known || array {
+			return 0, false, false
+		}
+		return base, true, true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,21 @@
+CREATE TABLE Singers (
+    SingerID STRING(MAX) NOT NULL,
+    Name STRING(MAX) NOT NULL,
+    Tags ARRAY<STRING(MAX)>,
+    Info JSON,
+    CreatedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true),
+) PRIMARY KEY (SingerID);
+
+CREATE INDEX SingersByName
+ON Singers (
+    Name
+);
+
+CREATE TABLE Albums (
+    SingerID STRING(MAX) NOT NULL,
+    AlbumID STRING(MAX) NOT NULL,
+    Title STRING(MAX),
+) PRIMARY KEY (SingerID, AlbumID),
+INTERLEAVE IN PARENT Singers ON DELETE CASCADE;
+
+ALTER TABLE Albums ADD COLUMN Price INT64;
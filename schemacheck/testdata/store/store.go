@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+)
+
+const albumsTable = "Albums"
+
+type SingerStore struct {
+	sc *spanner.Client
+}
+
+func (s *SingerStore) TableName() string {
+	return "Singers"
+}
+
+func (s *SingerStore) Read(ctx context.Context) error {
+	_, err := s.sc.Single().ReadRowWithOptions(ctx, s.TableName(), spanner.Key{"a"},
+		[]string{"SingerID", "Nmae"},
+		&spanner.ReadOptions{Index: "SingersByAge"})
+	return err
+}
+
+func (s *SingerStore) Query(ctx context.Context) error {
+	sql := `
+SELECT s.SingerID, s.Name, a.Titel
+FROM Singers@{FORCE_INDEX=SingersByName} s
+JOIN Albums a ON s.SingerID = a.SingerID
+WHERE s.Name = @Name AND Price > %d
+`
+	iter := s.sc.Single().Query(ctx, spanner.NewStatement(fmt.Sprintf(sql, 100)))
+	defer iter.Stop()
+	return nil
+}
+
+func (s *SingerStore) Update(ctx context.Context) error {
+	cols := []string{"SingerID", "AlbumID", "Title"}
+	_, err := s.sc.Apply(ctx, []*spanner.Mutation{
+		spanner.Update(albumsTable, cols, []interface{}{"a", "b", "c"}),
+		spanner.InsertMap("Songs", map[string]interface{}{"SingerID": "a"}),
+		spanner.UpdateMap(s.TableName(), map[string]interface{}{"singerid": "a", "Name": "b"}),
+	})
+	return err
+}
+
+type AlbumStore struct {
+	sc *spanner.Client
+}
+
+func (s *AlbumStore) TableName() string {
+	return albumsTable
+}
+
+func (s *AlbumStore) Count(ctx context.Context) error {
+	stmt := spanner.Statement{SQL: "SELECT COUNT(*) AS Count FROM " + s.TableName() + " WHERE Rating > 0 ORDER BY Count"}
+	iter := s.sc.Single().Query(ctx, stmt)
+	defer iter.Stop()
+	return nil
+}
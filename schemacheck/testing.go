@@ -0,0 +1,40 @@
+package schemacheck
+
+import (
+	"testing"
+
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+// Load is testのためのhelper. ddlFilesを読んでSchemaを作る
+// ddlFilesは spannertest.Setup と同じように "balance" のようなddl/のfile名か、.sqlのpathを指定する
+func Load(t testing.TB, ddlFiles ...string) *Schema {
+	t.Helper()
+
+	var paths []string
+	for _, fn := range ddlFiles {
+		path, err := spannertest.DDLFilePath(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	s, err := LoadSchema(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Verify is testのためのhelper. ErrorのIssueがあればtestを失敗させる. WarningはLogに出す
+func Verify(t testing.TB, issues []*Issue) {
+	t.Helper()
+
+	for _, issue := range issues {
+		if issue.Warning() {
+			t.Log(issue)
+			continue
+		}
+		t.Error(issue)
+	}
+}
@@ -0,0 +1,30 @@
+package score
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sinmetal/srunner"
+)
+
+func init() {
+	srunner.RegisterRunner(srunner.BackendSpanner, "SCORE_UPSERT", "Score.Upsert", newUpsertRunner)
+}
+
+func newUpsertRunner(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+	if env.Spanner == nil {
+		return nil, fmt.Errorf("spanner client is required")
+	}
+	ss, err := NewScoreStore(ctx, env.Spanner)
+	if err != nil {
+		return nil, err
+	}
+	sus, err := NewScoreUserStore(ctx, env.Spanner)
+	if err != nil {
+		return nil, err
+	}
+	return &UpsertRunner{
+		ScoreStore:     ss,
+		ScoreUserStore: sus,
+	}, nil
+}
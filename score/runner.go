@@ -0,0 +1,38 @@
+package score
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
+)
+
+const (
+	// scoreUserIDMax is ScoreUserStore.IDで作るIDの最大値
+	scoreUserIDMax = 100000000
+
+	// circleIDMax is 所属するサークルの種類
+	circleIDMax = 100000
+)
+
+// UpsertRunner is ランダムなUserのScoreを更新する
+type UpsertRunner struct {
+	ScoreStore     *ScoreStore
+	ScoreUserStore *ScoreUserStore
+}
+
+func (r *UpsertRunner) Run(ctx context.Context) error {
+	rnd := srunner.RandFromContext(ctx)
+	id := r.ScoreUserStore.ID(ctx, srunner.PickKey(ctx, scoreUserIDMax))
+	err := r.ScoreStore.Upsert(ctx, &Score{
+		ID:         id,
+		CircleID:   r.ScoreStore.CircleID(rnd.Int63n(circleIDMax)),
+		Score:      rnd.Int63n(10000000000),
+		CommitedAt: spanner.CommitTimestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed ScoreStore.Upsert id=%s : %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package score_test
+
+import (
+	"testing"
+
+	"github.com/sinmetal/srunner/schemacheck"
+	"github.com/sinmetal/srunner/score"
+)
+
+func TestSchema(t *testing.T) {
+	s := schemacheck.Load(t, "score")
+
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "Score", score.Score{}))
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "ScoreUser", score.ScoreUser{}))
+
+	issues, err := schemacheck.CheckPackage(s, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemacheck.Verify(t, issues)
+}
@@ -3,10 +3,10 @@ package score
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
 	"google.golang.org/grpc/codes"
 )
 
@@ -71,7 +71,7 @@ func (s *ScoreStore) Upsert(ctx context.Context, e *Score) error {
 					"CircleId":   circleID,
 					"Score":      e.Score,
 					"MaxScore":   e.Score,
-					"Shard":      rand.Int63n(9),
+					"Shard":      srunner.RandFromContext(ctx).Int63n(9),
 					"CommitedAt": spanner.CommitTimestamp,
 				})
 			} else {
@@ -90,7 +90,7 @@ func (s *ScoreStore) Upsert(ctx context.Context, e *Score) error {
 				"Id":         e.ID,
 				"Score":      e.Score,
 				"MaxScore":   maxScore,
-				"Shard":      rand.Int63n(9), // データがすべて埋まったら、これは消していい
+				"Shard":      srunner.RandFromContext(ctx).Int63n(9), // データがすべて埋まったら、これは消していい
 				"CommitedAt": spanner.CommitTimestamp,
 			})
 		}
@@ -10,9 +10,11 @@ import (
 )
 
 func TestScoreStore_Upsert(t *testing.T) {
+	// ClassRankはGenerated Columnで、in-memoryのfakeでは計算されないので、Emulatorの時だけ確認する
+	checkClassRank := spannertest.IsSpannerEmulatorHost()
+
 	ctx := context.Background()
-	sc, teardown := SetupSpannerTest(t, spannertest.RandomDatabaseName())
-	defer teardown()
+	sc := spannertest.Setup(t, "score")
 
 	ss := newTestScoreStore(t, sc)
 	sus := newTestScoreUserStore(t, sc)
@@ -40,7 +42,7 @@ func TestScoreStore_Upsert(t *testing.T) {
 	if e, g := firstScore, v.MaxScore; e != g {
 		t.Errorf("want MaxScore %d but got %d", e, g)
 	}
-	if e, g := int64(0), v.ClassRank; e != g {
+	if e, g := int64(0), v.ClassRank; checkClassRank && e != g {
 		t.Errorf("want ClassRank %d but got %d", e, g)
 	}
 	if e, g := circleID, v.CircleID; e != g {
@@ -72,7 +74,7 @@ func TestScoreStore_Upsert(t *testing.T) {
 	if e, g := firstScore, v.MaxScore; e != g {
 		t.Errorf("want MaxScore %d but got %d", e, g)
 	}
-	if e, g := int64(0), v.ClassRank; e != g {
+	if e, g := int64(0), v.ClassRank; checkClassRank && e != g {
 		t.Errorf("want ClassRank %d but got %d", e, g)
 	}
 	// CircleIDは最初のものが入っているはず
@@ -102,7 +104,7 @@ func TestScoreStore_Upsert(t *testing.T) {
 		t.Errorf("want MaxScore %d but got %d", e, g)
 	}
 	// ClassRank更新
-	if e, g := int64(6), v.ClassRank; e != g {
+	if e, g := int64(6), v.ClassRank; checkClassRank && e != g {
 		t.Errorf("want ClassRank %d but got %d", e, g)
 	}
 }
@@ -0,0 +1,39 @@
+package score
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/sinmetal/srunner/seed"
+)
+
+// ScoreSeedDataset is UpsertRunnerが更新するIdが 0 ~ n-1 のScoreを作るDataset
+// nが0の場合はUpsertRunnerが選ぶすべてのIdを作る
+func ScoreSeedDataset(n int64) *seed.Dataset {
+	if n <= 0 {
+		n = scoreUserIDMax
+	}
+	users := &ScoreUserStore{}
+	scores := &ScoreStore{}
+	return &seed.Dataset{
+		Name:             "Score",
+		Table:            "Score",
+		Columns:          []string{"Id", "CircleID", "Score", "MaxScore", "Shard"},
+		TimestampColumns: []string{"CommitedAt"},
+		// 4つのindexとClassRank
+		Indexes:     5,
+		Start:       0,
+		End:         n,
+		SpannerOnly: true,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			score := r.Int63n(10000000000)
+			return []interface{}{
+				users.ID(context.Background(), id),
+				scores.CircleID(r.Int63n(circleIDMax)),
+				score,
+				score,
+				r.Int63n(9),
+			}
+		},
+	}
+}
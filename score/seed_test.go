@@ -0,0 +1,37 @@
+package score_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/score"
+	"github.com/sinmetal/srunner/seed"
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+func TestScoreSeedDataset(t *testing.T) {
+	ctx := context.Background()
+
+	sc := spannertest.Setup(t, "score", "seed")
+	results, err := seed.Run(ctx, seed.NewSpannerTarget(sc), []*seed.Dataset{score.ScoreSeedDataset(50)}, seed.Options{ChunkSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(50), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+
+	sus := newTestScoreUserStore(t, sc)
+	row, err := sc.Single().ReadRow(ctx, "Score", spanner.Key{sus.ID(ctx, 49)}, []string{"Score", "MaxScore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s, maxScore int64
+	if err := row.Columns(&s, &maxScore); err != nil {
+		t.Fatal(err)
+	}
+	if s != maxScore {
+		t.Errorf("want MaxScore %d but got %d", s, maxScore)
+	}
+}
@@ -0,0 +1,105 @@
+package srunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WithSeed is workerごとの *rand.Rand を作る時のseedを指定する
+// 同じseed, parallelismで実行すると、各workerは同じ順番でkeyやデータを選ぶので、失敗したRunを再現できる
+// 0の場合は起動時刻からseedを決める. 決めたseedは Seed() や Status() で確認できる
+func WithSeed(seed int64) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.seed = seed
+	}
+}
+
+// Seed is workerのrandを作るのに使っているseedを返す
+func (ar *AppRunnner) Seed() int64 {
+	return ar.seed
+}
+
+// newSeed is WithSeedを指定しなかった時のseed
+func newSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// workerRand is seedとrunの名前とworkerの番号から、workerのrandを作る
+// 同じAppRunnnerの中でも、runとworkerごとに違う値を返すようにする
+func workerRand(seed int64, name string, worker int) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	v := uint64(seed) ^ h.Sum64()
+	v += uint64(worker) * 0x9e3779b97f4a7c15
+	// splitmix64 で近いseedのworker同士の値が偏らないようにする
+	v = (v ^ (v >> 30)) * 0xbf58476d1ce4e5b9
+	v = (v ^ (v >> 27)) * 0x94d049bb133111eb
+	v = v ^ (v >> 31)
+	return rand.New(rand.NewSource(int64(v)))
+}
+
+type randKey struct{}
+
+func withRand(ctx context.Context, r *rand.Rand) context.Context {
+	return context.WithValue(ctx, randKey{}, r)
+}
+
+// RandFromContext is ctxのRunを実行しているworkerの *rand.Rand を返す
+// Runnerがkeyやデータをrandomに作る時はmath/randのglobalな関数ではなく、これを使う
+// workerのrandは1つのgoroutineからしか使わないので、Runの中で別のgoroutineに渡さないこと
+// AppRunnnerのRun以外から呼ばれた場合は、起動時刻をseedにしたgoroutine safeなrandを返す
+func RandFromContext(ctx context.Context) *rand.Rand {
+	if r, ok := ctx.Value(randKey{}).(*rand.Rand); ok {
+		return r
+	}
+	return fallbackRand
+}
+
+// NewUUID is RandFromContextのrandでUUIDを作る
+// 同じseed, parallelismで実行すると、workerは同じ順番で同じUUIDを作る
+// rand.RandのReadは複数のgoroutineから使えないので、Uint64で作ったbyteから読む
+func NewUUID(ctx context.Context) uuid.UUID {
+	r := RandFromContext(ctx)
+	var b [16]byte
+	binary.LittleEndian.PutUint64(b[:8], r.Uint64())
+	binary.LittleEndian.PutUint64(b[8:], r.Uint64())
+	ret, err := uuid.NewRandomFromReader(bytes.NewReader(b[:]))
+	if err != nil {
+		// 16byteあるのでerrorにはならない
+		panic(err)
+	}
+	return ret
+}
+
+var fallbackRand = rand.New(&lockedSource{src: rand.NewSource(newSeed()).(rand.Source64)})
+
+// lockedSource is 複数のgoroutineから使えるrand.Source
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
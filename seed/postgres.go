@@ -0,0 +1,125 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresTarget is PostgreSQL, AlloyDBに書き込む
+type PostgresTarget struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresTarget is PostgresTargetを作る
+func NewPostgresTarget(pool *pgxpool.Pool) *PostgresTarget {
+	return &PostgresTarget{pool: pool}
+}
+
+func (t *PostgresTarget) Completed(ctx context.Context, dataset string) ([]Chunk, error) {
+	rows, err := t.pool.Query(ctx, fmt.Sprintf("SELECT ChunkStart, ChunkEnd FROM %s WHERE Dataset = @Dataset ORDER BY ChunkStart", ProgressTableName),
+		pgx.NamedArgs{"Dataset": dataset})
+	if err != nil {
+		return nil, progressTableErr(err)
+	}
+	defer rows.Close()
+
+	var ret []Chunk
+	for rows.Next() {
+		var c Chunk
+		if err := rows.Scan(&c.Start, &c.End); err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, progressTableErr(err)
+	}
+	return ret, nil
+}
+
+// progressTableErr is SeedProgress Tableがない時のerrorを ErrProgressTableNotFound にする
+func progressTableErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+		return fmt.Errorf("%w : %w", ErrProgressTableNotFound, err)
+	}
+	return err
+}
+
+// Write is rowsを1つのtransactionでInsertする. 既にあるRowは ON CONFLICT DO NOTHING でskipする
+// TimestampColumnsはDDLのDEFAULT NOW()に任せる
+func (t *PostgresTarget) Write(ctx context.Context, ds *Dataset, chunk Chunk, rows [][]interface{}) (inserted int64, err error) {
+	if ds.SpannerOnly {
+		return 0, fmt.Errorf("dataset %s is not supported on postgres", ds.Name)
+	}
+
+	tx, err := t.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if err2 := tx.Rollback(ctx); err2 != nil && !errors.Is(err2, pgx.ErrTxClosed) {
+				err = fmt.Errorf("rollback: %s : %w", err2, err)
+			}
+		}
+	}()
+
+	insertSQL := insertRowSQL(ds)
+	b := &pgx.Batch{}
+	for _, row := range rows {
+		args := pgx.NamedArgs{}
+		for i, column := range ds.Columns {
+			args[column] = row[i]
+		}
+		b.Queue(insertSQL, args)
+	}
+	br := tx.SendBatch(ctx, b)
+	for range rows {
+		tag, err := br.Exec()
+		if err != nil {
+			br.Close()
+			return 0, fmt.Errorf("failed insert %s : %w", ds.Table, err)
+		}
+		inserted += tag.RowsAffected()
+	}
+	if err := br.Close(); err != nil {
+		return 0, fmt.Errorf("failed insert %s : %w", ds.Table, err)
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (Dataset, ChunkStart, ChunkEnd, Inserted) VALUES (@Dataset, @ChunkStart, @ChunkEnd, @Inserted)
+ON CONFLICT (Dataset, ChunkStart) DO UPDATE SET ChunkEnd = EXCLUDED.ChunkEnd, Inserted = EXCLUDED.Inserted, CompletedAt = NOW()`, ProgressTableName),
+		pgx.NamedArgs{
+			"Dataset":    ds.Name,
+			"ChunkStart": chunk.Start,
+			"ChunkEnd":   chunk.End,
+			"Inserted":   inserted,
+		})
+	if err != nil {
+		return 0, fmt.Errorf("insert progress %s : %w", ds.Name, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return inserted, nil
+}
+
+// MaxChunkSize is PostgreSQLではRowごとにINSERTするので制限しない
+func (t *PostgresTarget) MaxChunkSize(ds *Dataset) int64 {
+	return 0
+}
+
+func insertRowSQL(ds *Dataset) string {
+	params := make([]string, len(ds.Columns))
+	for i, column := range ds.Columns {
+		params[i] = "@" + column
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+		ds.Table, strings.Join(ds.Columns, ", "), strings.Join(params, ", "))
+}
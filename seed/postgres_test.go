@@ -0,0 +1,47 @@
+package seed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinmetal/srunner/pgtest"
+)
+
+func TestPostgresTarget(t *testing.T) {
+	ctx := context.Background()
+	pool := pgtest.Setup(t, "../ddl/alloy/balance.sql", "../ddl/alloy/seed.sql")
+	target := NewPostgresTarget(pool)
+
+	if _, err := pool.Exec(ctx, "INSERT INTO UserBalance (UserId, Amount, Point) VALUES ('u0000000001', -1, -1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	ds := userBalanceDataset(25)
+	results, err := Run(ctx, target, []*Dataset{ds}, Options{ChunkSize: 10, Parallelism: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(24), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+
+	var amount int64
+	if err := pool.QueryRow(ctx, "SELECT Amount FROM UserBalance WHERE UserId = 'u0000000001'").Scan(&amount); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(-1), amount; e != g {
+		t.Errorf("want Amount %d but got %d", e, g)
+	}
+
+	results, err = Run(ctx, target, []*Dataset{ds}, Options{ChunkSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(25), results[0].Skipped; e != g {
+		t.Errorf("want Skipped %d but got %d", e, g)
+	}
+
+	if _, err := target.Write(ctx, &Dataset{Name: "Score", SpannerOnly: true}, Chunk{}, nil); err == nil {
+		t.Errorf("want error for spanner only dataset")
+	}
+}
@@ -0,0 +1,361 @@
+// Package seed is 負荷をかける前に、RunnerがaccessするRowをまとめて作る
+//
+// DatasetのIDの範囲をchunkに分けて、複数のworkerでchunkごとに1回のtransactionで書き込む
+// 書き込んだchunkは同じtransactionでSeedProgress Tableに記録するので、中断した後に再実行すると、まだ書き込んでいない範囲から再開する
+// SeedProgressは ddl/seed.sql, ddl/alloy/seed.sql を cmd/migrate で作っておく
+// 複数のpodでseedする場合は、Options.ShardでpodごとにIDの範囲を分ける
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sinmetal/srunner"
+)
+
+// ProgressTableName is 書き込んだchunkを記録するTable
+const ProgressTableName = "SeedProgress"
+
+// ErrProgressTableNotFound is SeedProgress Tableがない
+// Runは1 Rowも書き込まずにこのerrorを返すので、cmd/migrate -sets seed でSeedProgressを作ってから再実行する
+var ErrProgressTableNotFound = errors.New("SeedProgress table not found. create it with `cmd/migrate -sets seed` before seeding")
+
+const (
+	// DefaultChunkSize is 1 chunkのRow数. SpannerではmutationのlimitからDatasetごとに小さくすることがある
+	DefaultChunkSize = 1000
+
+	// DefaultParallelism is 同時に書き込むchunkの数
+	DefaultParallelism = 16
+
+	// DefaultProgressInterval is 途中経過を表示する間隔
+	DefaultProgressInterval = 10 * time.Second
+)
+
+// Dataset is 1つのTableに作るRowの定義
+type Dataset struct {
+	// Name is SeedProgressに記録する名前. cmd/seed の -datasets で指定する e.g. UserAccount
+	Name string
+
+	Table string
+
+	// Columns is Rowが返す値のColumn. 先頭はSTRINGのPrimary Keyにする
+	// 既にあるRowを確認する時に使う
+	Columns []string
+
+	// TimestampColumns is Spannerではcommit timestamp, PostgreSQLではDEFAULT NOW()にするColumn
+	TimestampColumns []string
+
+	// Indexes is 1 Row書き込んだ時に更新されるsecondary indexとstored generated columnの数
+	// Spannerの1 commitあたりのmutationの数を計算するのに使う
+	Indexes int
+
+	// Start, End is [Start, End) のIDのRowを作る
+	Start int64
+	End   int64
+
+	// SpannerOnly is PostgreSQLにTableがないDataset
+	SpannerOnly bool
+
+	// Row is idのRowのColumnsの値を返す
+	// rはchunkごとにseedから作るので、同じseedとchunk sizeで実行すると同じ値になる
+	Row func(r *rand.Rand, id int64) []interface{}
+}
+
+// Rows is 範囲に含まれるRowの数
+func (ds *Dataset) Rows() int64 {
+	return ds.End - ds.Start
+}
+
+// Chunk is [Start, End) のIDの範囲
+type Chunk struct {
+	Start int64
+	End   int64
+}
+
+// Rows is 範囲に含まれるRowの数
+func (c Chunk) Rows() int64 {
+	return c.End - c.Start
+}
+
+// Target is Rowを書き込むDB
+type Target interface {
+	// Completed is SeedProgressに記録されているdatasetのchunkを返す
+	// SeedProgress Tableがない場合は ErrProgressTableNotFound を返す
+	Completed(ctx context.Context, dataset string) ([]Chunk, error)
+
+	// Write is まだないRowを書き込んで、同じtransactionでchunkをSeedProgressに記録する
+	// 既にあるRowは上書きしない. 書き込んだRowの数を返す
+	Write(ctx context.Context, ds *Dataset, chunk Chunk, rows [][]interface{}) (inserted int64, err error)
+
+	// MaxChunkSize is 1回のWriteで書き込めるRowの数. 0の場合は制限しない
+	MaxChunkSize(ds *Dataset) int64
+}
+
+// Options is Runの設定
+type Options struct {
+	// ChunkSize is 1 chunkのRow数. 0の場合はDefaultChunkSize
+	ChunkSize int64
+
+	// Parallelism is 同時に書き込むchunkの数. 0の場合はDefaultParallelism
+	Parallelism int
+
+	// Seed is Rowの値を作る *rand.Rand のseed
+	Seed int64
+
+	// Progress is 途中経過の書き出し先. nilの場合は書き出さない
+	Progress io.Writer
+
+	// ProgressInterval is 途中経過を書き出す間隔. 0の場合はDefaultProgressInterval
+	ProgressInterval time.Duration
+
+	// Shard is Datasetの [Start, End) のうち、このRunが担当する範囲
+	// 複数のpodでseedする時に、podごとに別のShardを指定すると範囲が重ならない. 指定しない場合はすべての範囲
+	Shard srunner.Shard
+}
+
+func (o Options) withDefaults() Options {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = DefaultChunkSize
+	}
+	if o.Parallelism <= 0 {
+		o.Parallelism = DefaultParallelism
+	}
+	if o.ProgressInterval <= 0 {
+		o.ProgressInterval = DefaultProgressInterval
+	}
+	if o.Shard.Count == 0 {
+		o.Shard = srunner.NoShard
+	}
+	return o
+}
+
+// Result is 1つのDatasetをseedした結果
+type Result struct {
+	Dataset string
+
+	// Shard is このResultを作ったRunのOptions.Shard
+	Shard srunner.Shard
+
+	// Rows is Shardが担当する範囲のRowの数
+	Rows int64
+
+	// Skipped is 前回までにSeedProgressに記録されていたので、書き込まなかったRowの数
+	Skipped int64
+
+	// Inserted is 書き込んだRowの数
+	Inserted int64
+
+	// Existing is SeedProgressには記録されていないが、既にあったので書き込まなかったRowの数
+	Existing int64
+
+	Chunks  int
+	Elapsed time.Duration
+}
+
+// Run is datasetsを順番にtargetに書き込む
+// 途中で失敗した場合は、それまでのResultとerrorを返す. 書き込み済みのchunkは次のRunでskipする
+func Run(ctx context.Context, target Target, datasets []*Dataset, opts Options) ([]*Result, error) {
+	opts = opts.withDefaults()
+	if err := opts.Shard.Validate(); err != nil {
+		return nil, err
+	}
+
+	var results []*Result
+	for _, ds := range datasets {
+		result, err := runDataset(ctx, target, ds, opts)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("failed seed %s : %w", ds.Name, err)
+		}
+	}
+	return results, nil
+}
+
+func runDataset(ctx context.Context, target Target, ds *Dataset, opts Options) (*Result, error) {
+	start := time.Now()
+	lo, hi := opts.Shard.Range(ds.Start, ds.End)
+	result := &Result{Dataset: ds.Name, Shard: opts.Shard, Rows: hi - lo}
+
+	completed, err := target.Completed(ctx, ds.Name)
+	if err != nil {
+		return result, fmt.Errorf("failed read %s : %w", ProgressTableName, err)
+	}
+	size := opts.ChunkSize
+	if max := target.MaxChunkSize(ds); max > 0 && size > max {
+		size = max
+	}
+	chunks := Chunks(lo, hi, size, completed)
+	var pending int64
+	for _, c := range chunks {
+		pending += c.Rows()
+	}
+	result.Skipped = result.Rows - pending
+	result.Chunks = len(chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var inserted, written int64
+	stopProgress := startProgress(opts, ds, result.Rows, result.Skipped, &written, start)
+	defer stopProgress()
+
+	ch := make(chan Chunk)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range ch {
+				n, err := writeChunk(ctx, target, ds, c, opts.Seed)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("chunk %d-%d : %w", c.Start, c.End, err)
+						cancel()
+					})
+					return
+				}
+				atomic.AddInt64(&inserted, n)
+				atomic.AddInt64(&written, c.Rows())
+			}
+		}()
+	}
+dispatch:
+	for _, c := range chunks {
+		select {
+		case ch <- c:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	result.Inserted = atomic.LoadInt64(&inserted)
+	result.Existing = atomic.LoadInt64(&written) - result.Inserted
+	result.Elapsed = time.Since(start)
+	if firstErr != nil {
+		return result, firstErr
+	}
+	return result, ctx.Err()
+}
+
+// writeChunk is chunkのRowを作ってtargetに書き込む
+func writeChunk(ctx context.Context, target Target, ds *Dataset, c Chunk, seed int64) (int64, error) {
+	r := chunkRand(seed, ds.Name, c)
+	rows := make([][]interface{}, 0, c.Rows())
+	for id := c.Start; id < c.End; id++ {
+		rows = append(rows, ds.Row(r, id))
+	}
+	return target.Write(ctx, ds, c, rows)
+}
+
+// chunkRand is seedとDatasetとchunkから *rand.Rand を作る
+// 並列数や書き込む順番に関係なく、同じchunkは同じ値になる
+func chunkRand(seed int64, dataset string, c Chunk) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(dataset))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64()) ^ c.Start))
+}
+
+// startProgress is opts.ProgressInterval ごとに途中経過を書き出す. 返したfuncで止める
+// rowsはShardが担当する範囲のRowの数
+func startProgress(opts Options, ds *Dataset, rows int64, skipped int64, written *int64, start time.Time) func() {
+	if opts.Progress == nil {
+		return func() {}
+	}
+	fmt.Fprintf(opts.Progress, "seed %s %s shard=%s start. rows=%d skipped=%d\n", ds.Name, ds.Table, opts.Shard, rows, skipped)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(opts.ProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				n := atomic.LoadInt64(written)
+				elapsed := time.Since(start)
+				fmt.Fprintf(opts.Progress, "seed %s shard=%s %d/%d rows (%.1f%%) %.0f rows/s\n",
+					ds.Name, opts.Shard, skipped+n, rows, float64(skipped+n)/float64(rows)*100, float64(n)/elapsed.Seconds())
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// Chunks is [start, end) からcompletedの範囲を除いて、sizeのRow数ごとのchunkに分ける
+// completedは前回のRunと違うchunk sizeで書き込まれていてもよい
+func Chunks(start int64, end int64, size int64, completed []Chunk) []Chunk {
+	done := make([]Chunk, len(completed))
+	copy(done, completed)
+	sort.Slice(done, func(i, j int) bool {
+		return done[i].Start < done[j].Start
+	})
+
+	var ret []Chunk
+	add := func(from int64, to int64) {
+		for from < to {
+			next := from + size
+			if next > to {
+				next = to
+			}
+			ret = append(ret, Chunk{Start: from, End: next})
+			from = next
+		}
+	}
+	cursor := start
+	for _, c := range done {
+		if c.End <= cursor {
+			continue
+		}
+		if c.Start >= end {
+			break
+		}
+		if c.Start > cursor {
+			add(cursor, c.Start)
+		}
+		cursor = c.End
+	}
+	if cursor < end {
+		add(cursor, end)
+	}
+	return ret
+}
+
+// WriteResults is Resultを表形式でwに書き出す
+func WriteResults(w io.Writer, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if _, err := fmt.Fprintln(tw, "Dataset\tShard\tRows\tSkipped\tInserted\tExisting\tChunks\tElapsed\tRow/s\t"); err != nil {
+		return err
+	}
+	for _, v := range results {
+		var throughput float64
+		if v.Elapsed > 0 {
+			throughput = float64(v.Inserted+v.Existing) / v.Elapsed.Seconds()
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\t%.0f\t\n",
+			v.Dataset, v.Shard, v.Rows, v.Skipped, v.Inserted, v.Existing, v.Chunks, v.Elapsed.Round(time.Millisecond), throughput)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
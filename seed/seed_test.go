@@ -0,0 +1,219 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sinmetal/srunner"
+)
+
+// fakeTarget is memory上にRowとSeedProgressを持つTarget
+type fakeTarget struct {
+	mu       sync.Mutex
+	rows     map[string][]interface{}
+	progress map[string][]Chunk
+
+	// failAfter is Writeがこの回数成功した後はerrorを返す. 0の場合は失敗しない
+	failAfter int
+	writes    int
+	maxChunk  int64
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{
+		rows:     make(map[string][]interface{}),
+		progress: make(map[string][]Chunk),
+	}
+}
+
+func (t *fakeTarget) Completed(ctx context.Context, dataset string) ([]Chunk, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Chunk{}, t.progress[dataset]...), nil
+}
+
+func (t *fakeTarget) Write(ctx context.Context, ds *Dataset, chunk Chunk, rows [][]interface{}) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failAfter > 0 && t.writes >= t.failAfter {
+		return 0, errors.New("fake error")
+	}
+	t.writes++
+
+	var inserted int64
+	for _, row := range rows {
+		key := fmt.Sprintf("%s/%v", ds.Table, row[0])
+		if _, ok := t.rows[key]; ok {
+			continue
+		}
+		t.rows[key] = row
+		inserted++
+	}
+	t.progress[ds.Name] = append(t.progress[ds.Name], chunk)
+	return inserted, nil
+}
+
+func (t *fakeTarget) MaxChunkSize(ds *Dataset) int64 {
+	return t.maxChunk
+}
+
+func testDataset(n int64) *Dataset {
+	return &Dataset{
+		Name:    "Test",
+		Table:   "TestTable",
+		Columns: []string{"ID", "Value"},
+		Start:   1,
+		End:     n + 1,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			return []interface{}{fmt.Sprintf("t%05d", id), r.Int63()}
+		},
+	}
+}
+
+func TestChunks(t *testing.T) {
+	cases := []struct {
+		name      string
+		completed []Chunk
+		want      []Chunk
+	}{
+		{"empty", nil, []Chunk{{0, 4}, {4, 8}, {8, 10}}},
+		{"head", []Chunk{{0, 4}}, []Chunk{{4, 8}, {8, 10}}},
+		{"middle with other size", []Chunk{{3, 6}}, []Chunk{{0, 3}, {6, 10}}},
+		{"unsorted", []Chunk{{6, 8}, {0, 2}}, []Chunk{{2, 6}, {8, 10}}},
+		{"outside", []Chunk{{10, 20}}, []Chunk{{0, 4}, {4, 8}, {8, 10}}},
+		{"all", []Chunk{{0, 5}, {5, 10}}, nil},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := Chunks(0, 10, 4, tt.completed)
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("want %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRun_Resume(t *testing.T) {
+	ctx := context.Background()
+	target := newFakeTarget()
+	target.failAfter = 3
+	ds := testDataset(1000)
+
+	opts := Options{ChunkSize: 100, Parallelism: 1}
+	results, err := Run(ctx, target, []*Dataset{ds}, opts)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	if e, g := int64(300), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+
+	// 途中まで書き込んだchunkはskipして再開する
+	target.failAfter = 0
+	results, err = Run(ctx, target, []*Dataset{ds}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(300), results[0].Skipped; e != g {
+		t.Errorf("want Skipped %d but got %d", e, g)
+	}
+	if e, g := int64(700), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+	if e, g := 1000, len(target.rows); e != g {
+		t.Errorf("want %d rows but got %d", e, g)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteResults(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Test") {
+		t.Errorf("unexpected results %s", buf.String())
+	}
+}
+
+func TestRun_Existing(t *testing.T) {
+	ctx := context.Background()
+	target := newFakeTarget()
+	target.rows["TestTable/t00001"] = []interface{}{"t00001", int64(0)}
+	target.maxChunk = 3
+
+	results, err := Run(ctx, target, []*Dataset{testDataset(10)}, Options{ChunkSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(9), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+	if e, g := int64(1), results[0].Existing; e != g {
+		t.Errorf("want Existing %d but got %d", e, g)
+	}
+	// MaxChunkSizeより大きいChunkSizeは小さくする
+	if e, g := 4, results[0].Chunks; e != g {
+		t.Errorf("want Chunks %d but got %d", e, g)
+	}
+}
+
+func TestRun_Deterministic(t *testing.T) {
+	ctx := context.Background()
+	a := newFakeTarget()
+	b := newFakeTarget()
+	if _, err := Run(ctx, a, []*Dataset{testDataset(500)}, Options{ChunkSize: 50, Parallelism: 1, Seed: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(ctx, b, []*Dataset{testDataset(500)}, Options{ChunkSize: 50, Parallelism: 8, Seed: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.rows, b.rows) {
+		t.Errorf("want same rows with same seed and chunk size")
+	}
+}
+
+func TestRun_Shard(t *testing.T) {
+	ctx := context.Background()
+	target := newFakeTarget()
+	ds := testDataset(1000)
+
+	// 同じTargetに複数のpodから書き込んでも、範囲が重ならないのでExistingにならない
+	var inserted int64
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		shard := srunner.Shard{Index: i, Count: 3}
+		results, err := Run(ctx, target, []*Dataset{ds}, Options{ChunkSize: 100, Parallelism: 4, Progress: &buf, Shard: shard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, g := shard, results[0].Shard; e != g {
+			t.Errorf("want Shard %s but got %s", e, g)
+		}
+		if e, g := results[0].Rows, results[0].Inserted; e != g {
+			t.Errorf("shard %s want Inserted %d but got %d", shard, e, g)
+		}
+		if e, g := int64(0), results[0].Existing; e != g {
+			t.Errorf("shard %s want Existing %d but got %d", shard, e, g)
+		}
+		if !strings.Contains(buf.String(), "shard="+shard.String()) {
+			t.Errorf("want shard in progress but got %s", buf.String())
+		}
+		inserted += results[0].Inserted
+	}
+	if e, g := int64(1000), inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+	if e, g := 1000, len(target.rows); e != g {
+		t.Errorf("want %d rows but got %d", e, g)
+	}
+
+	if _, err := Run(ctx, target, []*Dataset{ds}, Options{Shard: srunner.Shard{Index: 3, Count: 3}}); err == nil {
+		t.Errorf("want error")
+	}
+}
@@ -0,0 +1,117 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/spanners"
+	"google.golang.org/grpc/codes"
+)
+
+// SpannerMutationLimit is Spannerの1 commitあたりのmutationの上限
+// https://cloud.google.com/spanner/quotas#limits-for
+const SpannerMutationLimit = 80000
+
+// progressMutations is SeedProgressに記録する時のmutationの数
+const progressMutations = 5
+
+// SpannerTarget is Spannerに書き込む
+type SpannerTarget struct {
+	sc *spanner.Client
+}
+
+// NewSpannerTarget is SpannerTargetを作る
+func NewSpannerTarget(sc *spanner.Client) *SpannerTarget {
+	return &SpannerTarget{sc: sc}
+}
+
+func (t *SpannerTarget) Completed(ctx context.Context, dataset string) ([]Chunk, error) {
+	stm := spanner.NewStatement(fmt.Sprintf("SELECT ChunkStart, ChunkEnd FROM %s WHERE Dataset = @Dataset ORDER BY ChunkStart", ProgressTableName))
+	stm.Params = map[string]interface{}{"Dataset": dataset}
+
+	var ret []Chunk
+	iter := t.sc.Single().QueryWithOptions(ctx, stm, spanner.QueryOptions{RequestTag: spanners.AppTag()})
+	err := iter.Do(func(row *spanner.Row) error {
+		var c Chunk
+		if err := row.Columns(&c.Start, &c.End); err != nil {
+			return err
+		}
+		ret = append(ret, c)
+		return nil
+	})
+	if isSpannerTableNotFound(err) {
+		return nil, fmt.Errorf("%w : %w", ErrProgressTableNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// isSpannerTableNotFound is QueryしたTableがない時のerrorかどうか
+// Spannerは InvalidArgument の "Table not found"、in-memoryのfakeは NotFound を返す
+func isSpannerTableNotFound(err error) bool {
+	switch spanner.ErrCode(err) {
+	case codes.NotFound:
+		return true
+	case codes.InvalidArgument:
+		return strings.Contains(spanner.ErrDesc(err), "Table not found")
+	}
+	return false
+}
+
+// Write is chunkの範囲で既にあるRowを読んでから、ないRowだけをInsertする
+func (t *SpannerTarget) Write(ctx context.Context, ds *Dataset, chunk Chunk, rows [][]interface{}) (int64, error) {
+	columns := append(append([]string{}, ds.Columns...), ds.TimestampColumns...)
+
+	var inserted int64
+	_, err := t.sc.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		keys := make([]spanner.KeySet, 0, len(rows))
+		for _, row := range rows {
+			keys = append(keys, spanner.Key{row[0]})
+		}
+		existing := make(map[string]bool)
+		err := tx.Read(ctx, ds.Table, spanner.KeySets(keys...), []string{ds.Columns[0]}).Do(func(row *spanner.Row) error {
+			var key string
+			if err := row.Column(0, &key); err != nil {
+				return err
+			}
+			existing[key] = true
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed read existing %s : %w", ds.Table, err)
+		}
+
+		inserted = 0
+		mus := make([]*spanner.Mutation, 0, len(rows)+1)
+		for _, row := range rows {
+			if existing[fmt.Sprint(row[0])] {
+				continue
+			}
+			values := append([]interface{}{}, row...)
+			for range ds.TimestampColumns {
+				values = append(values, spanner.CommitTimestamp)
+			}
+			mus = append(mus, spanner.Insert(ds.Table, columns, values))
+			inserted++
+		}
+		mus = append(mus, spanner.InsertOrUpdate(ProgressTableName,
+			[]string{"Dataset", "ChunkStart", "ChunkEnd", "Inserted", "CompletedAt"},
+			[]interface{}{ds.Name, chunk.Start, chunk.End, inserted, spanner.CommitTimestamp}))
+		return tx.BufferWrite(mus)
+	}, spanner.TransactionOptions{TransactionTag: spanners.AppTag()})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+// MaxChunkSize is 1 commitのmutationがSpannerMutationLimitを超えないRow数を返す
+// 1 RowのmutationはColumnの数と、更新されるindexの数の合計になる
+func (t *SpannerTarget) MaxChunkSize(ds *Dataset) int64 {
+	perRow := len(ds.Columns) + len(ds.TimestampColumns) + ds.Indexes
+	return int64((SpannerMutationLimit - progressMutations) / perRow)
+}
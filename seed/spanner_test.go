@@ -0,0 +1,104 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/spannertest"
+)
+
+// userBalanceDataset is testでUserBalanceに書き込むDataset
+func userBalanceDataset(n int64) *Dataset {
+	return &Dataset{
+		Name:             "UserBalance",
+		Table:            "UserBalance",
+		Columns:          []string{"UserID", "Amount", "Point"},
+		TimestampColumns: []string{"CreatedAt", "UpdatedAt"},
+		Start:            1,
+		End:              n + 1,
+		Row: func(r *rand.Rand, id int64) []interface{} {
+			return []interface{}{fmt.Sprintf("u%010d", id), r.Int63n(1000), int64(0)}
+		},
+	}
+}
+
+func TestSpannerTarget(t *testing.T) {
+	ctx := context.Background()
+	sc := spannertest.Setup(t, "balance", "seed")
+	target := NewSpannerTarget(sc)
+
+	// 既にあるRowは上書きしない
+	_, err := sc.Apply(ctx, []*spanner.Mutation{
+		spanner.Insert("UserBalance", []string{"UserID", "Amount", "Point", "CreatedAt", "UpdatedAt"},
+			[]interface{}{"u0000000001", int64(-1), int64(-1), spanner.CommitTimestamp, spanner.CommitTimestamp}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := userBalanceDataset(25)
+	results, err := Run(ctx, target, []*Dataset{ds}, Options{ChunkSize: 10, Parallelism: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(24), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+	if e, g := int64(1), results[0].Existing; e != g {
+		t.Errorf("want Existing %d but got %d", e, g)
+	}
+
+	row, err := sc.Single().ReadRow(ctx, "UserBalance", spanner.Key{"u0000000001"}, []string{"Amount"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var amount int64
+	if err := row.Column(0, &amount); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(-1), amount; e != g {
+		t.Errorf("want Amount %d but got %d", e, g)
+	}
+
+	completed, err := target.Completed(ctx, ds.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := 3, len(completed); e != g {
+		t.Errorf("want %d completed chunks but got %d", e, g)
+	}
+
+	// 2回目はすべてskipする
+	results, err = Run(ctx, target, []*Dataset{ds}, Options{ChunkSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(25), results[0].Skipped; e != g {
+		t.Errorf("want Skipped %d but got %d", e, g)
+	}
+}
+
+func TestSpannerTarget_ProgressTableNotFound(t *testing.T) {
+	ctx := context.Background()
+	sc := spannertest.Setup(t, "balance")
+
+	results, err := Run(ctx, NewSpannerTarget(sc), []*Dataset{userBalanceDataset(10)}, Options{})
+	if !errors.Is(err, ErrProgressTableNotFound) {
+		t.Fatalf("want ErrProgressTableNotFound but got %v", err)
+	}
+	if e, g := int64(0), results[0].Inserted; e != g {
+		t.Errorf("want Inserted %d but got %d", e, g)
+	}
+}
+
+func TestSpannerTarget_MaxChunkSize(t *testing.T) {
+	target := &SpannerTarget{}
+	ds := &Dataset{Columns: []string{"A", "B", "C"}, TimestampColumns: []string{"D"}, Indexes: 4}
+	if e, g := int64((SpannerMutationLimit-progressMutations)/8), target.MaxChunkSize(ds); e != g {
+		t.Errorf("want %d but got %d", e, g)
+	}
+}
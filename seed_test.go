@@ -0,0 +1,118 @@
+package srunner
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recordRunner is Runごとに選んだkeyとrandの値を記録する
+type recordRunner struct {
+	mu     sync.Mutex
+	values []int64
+}
+
+func (r *recordRunner) Run(ctx context.Context) error {
+	key := PickKey(ctx, 1000000)
+	v := RandFromContext(ctx).Int63()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values = append(r.values, key, v)
+	return nil
+}
+
+func runWithSeed(t *testing.T, seed int64) (*AppRunnner, []int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ar := NewAppRunner(ctx, 1000, 1,
+		WithSeed(seed),
+		WithKeyDistribution(&HotSetKeyDistribution{HotPercent: 1, TrafficPercent: 50}),
+		WithIterations(20))
+	r := &recordRunner{}
+	ar.Run(ctx, "Record", r)
+	select {
+	case <-ar.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+	return ar, r.values
+}
+
+func TestWithSeed_Replay(t *testing.T) {
+	_, first := runWithSeed(t, 100)
+	_, second := runWithSeed(t, 100)
+	if e, g := 40, len(first); e != g {
+		t.Fatalf("want %d values but got %d", e, g)
+	}
+	if e, g := len(first), len(second); e != g {
+		t.Fatalf("want %d values but got %d", e, g)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("values[%d] : want %d but got %d", i, first[i], second[i])
+		}
+	}
+
+	_, other := runWithSeed(t, 200)
+	same := true
+	for i := range first {
+		if first[i] != other[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Errorf("want different values with different seed")
+	}
+}
+
+func TestNewAppRunner_Seed(t *testing.T) {
+	ar := NewAppRunner(context.Background(), 1, 1)
+	if ar.Seed() == 0 {
+		t.Errorf("want generated seed")
+	}
+	if e, g := ar.Seed(), ar.Status().Seed; e != g {
+		t.Errorf("want Status().Seed %d but got %d", e, g)
+	}
+}
+
+func TestWorkerRand(t *testing.T) {
+	if workerRand(1, "A", 0).Int63() != workerRand(1, "A", 0).Int63() {
+		t.Errorf("want same value with same seed, name and worker")
+	}
+	if workerRand(1, "A", 0).Int63() == workerRand(1, "A", 1).Int63() {
+		t.Errorf("want different value for each worker")
+	}
+	if workerRand(1, "A", 0).Int63() == workerRand(1, "B", 0).Int63() {
+		t.Errorf("want different value for each name")
+	}
+}
+
+func TestRandFromContext_Fallback(t *testing.T) {
+	if RandFromContext(context.Background()) != fallbackRand {
+		t.Errorf("want fallbackRand")
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	newCtx := func() context.Context {
+		return withRand(context.Background(), rand.New(rand.NewSource(1)))
+	}
+	if e, g := NewUUID(newCtx()), NewUUID(newCtx()); e != g {
+		t.Errorf("want same uuid with same seed but got %s and %s", e, g)
+	}
+	ctx := newCtx()
+	v := NewUUID(ctx)
+	if v == NewUUID(ctx) {
+		t.Errorf("want different uuid for each call")
+	}
+	if e, g := uuid.Version(4), v.Version(); e != g {
+		t.Errorf("want version %d but got %d", e, g)
+	}
+}
@@ -0,0 +1,146 @@
+package srunner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Shard is 複数のpodで同じScenarioを動かす時に、このpodが担当するID範囲の番号
+// [start, end) をCount個に分けたうちのIndex番目を担当するので、podごとに重ならない範囲になる
+type Shard struct {
+	// Index is 0 ~ Count-1
+	Index int `json:"index"`
+
+	Count int `json:"count"`
+}
+
+// NoShard is 分割しない. すべての範囲を担当する
+var NoShard = Shard{Index: 0, Count: 1}
+
+// ShardFromEnv is 環境変数からShardを作る
+//
+// $SRUNNER_SHARD_COUNT が指定されていない場合はNoShardを返す
+// Indexは次の順番で決める
+//
+//  1. $SRUNNER_SHARD_INDEX
+//  2. $JOB_COMPLETION_INDEX (Indexed Job)
+//  3. $POD_NAME かhostnameの末尾の -{ordinal} (StatefulSet) e.g. srunner-2 なら 2
+func ShardFromEnv() (Shard, error) {
+	countParam := os.Getenv("SRUNNER_SHARD_COUNT")
+	if countParam == "" {
+		return NoShard, nil
+	}
+	count, err := strconv.Atoi(countParam)
+	if err != nil {
+		return Shard{}, fmt.Errorf("invalid $SRUNNER_SHARD_COUNT %s : %w", countParam, err)
+	}
+
+	var index int
+	switch {
+	case os.Getenv("SRUNNER_SHARD_INDEX") != "":
+		v := os.Getenv("SRUNNER_SHARD_INDEX")
+		index, err = strconv.Atoi(v)
+		if err != nil {
+			return Shard{}, fmt.Errorf("invalid $SRUNNER_SHARD_INDEX %s : %w", v, err)
+		}
+	case os.Getenv("JOB_COMPLETION_INDEX") != "":
+		v := os.Getenv("JOB_COMPLETION_INDEX")
+		index, err = strconv.Atoi(v)
+		if err != nil {
+			return Shard{}, fmt.Errorf("invalid $JOB_COMPLETION_INDEX %s : %w", v, err)
+		}
+	default:
+		name := os.Getenv("POD_NAME")
+		if name == "" {
+			name, err = os.Hostname()
+			if err != nil {
+				return Shard{}, fmt.Errorf("failed get hostname : %w", err)
+			}
+		}
+		index, err = PodOrdinal(name)
+		if err != nil {
+			return Shard{}, err
+		}
+	}
+
+	s := Shard{Index: index, Count: count}
+	if err := s.Validate(); err != nil {
+		return Shard{}, err
+	}
+	return s, nil
+}
+
+// PodOrdinal is StatefulSetのpod名 {name}-{ordinal} からordinalを返す
+func PodOrdinal(podName string) (int, error) {
+	i := strings.LastIndex(podName, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid pod name %s : want {name}-{ordinal}", podName)
+	}
+	v, err := strconv.Atoi(podName[i+1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid pod name %s : want {name}-{ordinal} : %w", podName, err)
+	}
+	return v, nil
+}
+
+// Validate is Countが1以上で、Indexが 0 ~ Count-1 かを確認する
+func (s Shard) Validate() error {
+	if s.Count < 1 {
+		return fmt.Errorf("invalid shard %s : count must be positive", s)
+	}
+	if s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("invalid shard %s : index must be in [0, %d)", s, s.Count)
+	}
+	return nil
+}
+
+// Sharded is 2つ以上に分割しているかどうか
+func (s Shard) Sharded() bool {
+	return s.Count > 1
+}
+
+// Range is [start, end) をCount個に分けたうち、Index番目の範囲を返す
+// 割り切れない分は先頭のShardから1つずつ多く担当する
+func (s Shard) Range(start int64, end int64) (int64, int64) {
+	if !s.Sharded() || end <= start {
+		return start, end
+	}
+	n := end - start
+	count := int64(s.Count)
+	index := int64(s.Index)
+	size := n / count
+	rem := n % count
+
+	lo := start + index*size + min64(index, rem)
+	hi := lo + size
+	if index < rem {
+		hi++
+	}
+	return lo, hi
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+func min64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// WithShard is PickKeyでkeyを選ぶ範囲を、Shardが担当する範囲に限定する
+// 複数のpodで同じRunnerを動かしても、podごとに別のkeyを使うようになる
+func WithShard(s Shard) AppRunnerOption {
+	return func(ar *AppRunnner) {
+		ar.shard = s
+	}
+}
+
+// Shard is PickKeyでkeyを選ぶ範囲のShardを返す
+func (ar *AppRunnner) Shard() Shard {
+	return ar.shard
+}
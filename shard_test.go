@@ -0,0 +1,89 @@
+package srunner
+
+import (
+	"testing"
+)
+
+func TestShard_Range(t *testing.T) {
+	for _, count := range []int{1, 3, 7, 10} {
+		var cursor int64 = 1
+		for i := 0; i < count; i++ {
+			lo, hi := Shard{Index: i, Count: count}.Range(1, 101)
+			// 前のShardの続きから始まり、重ならない
+			if e, g := cursor, lo; e != g {
+				t.Errorf("count=%d index=%d want start %d but got %d", count, i, e, g)
+			}
+			if size := hi - lo; size < 100/int64(count) || size > 100/int64(count)+1 {
+				t.Errorf("count=%d index=%d unexpected size %d", count, i, size)
+			}
+			cursor = hi
+		}
+		if e, g := int64(101), cursor; e != g {
+			t.Errorf("count=%d want end %d but got %d", count, e, g)
+		}
+	}
+}
+
+func TestShard_Validate(t *testing.T) {
+	cases := []struct {
+		name  string
+		shard Shard
+		ok    bool
+	}{
+		{"no shard", NoShard, true},
+		{"last", Shard{Index: 2, Count: 3}, true},
+		{"zero count", Shard{Index: 0, Count: 0}, false},
+		{"index out of range", Shard{Index: 3, Count: 3}, false},
+		{"negative index", Shard{Index: -1, Count: 3}, false},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.shard.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("unexpected error %s", err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("want error")
+			}
+		})
+	}
+}
+
+func TestShardFromEnv(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		want    Shard
+		wantErr bool
+	}{
+		{"no count", map[string]string{"SRUNNER_SHARD_INDEX": "2"}, NoShard, false},
+		{"index", map[string]string{"SRUNNER_SHARD_COUNT": "4", "SRUNNER_SHARD_INDEX": "2", "POD_NAME": "srunner-sts-1"}, Shard{Index: 2, Count: 4}, false},
+		{"job completion index", map[string]string{"SRUNNER_SHARD_COUNT": "4", "JOB_COMPLETION_INDEX": "3"}, Shard{Index: 3, Count: 4}, false},
+		{"pod ordinal", map[string]string{"SRUNNER_SHARD_COUNT": "4", "POD_NAME": "srunner-sts-1"}, Shard{Index: 1, Count: 4}, false},
+		{"deployment pod name", map[string]string{"SRUNNER_SHARD_COUNT": "4", "POD_NAME": "srunner-dep-7d9f8-abcde"}, Shard{}, true},
+		{"out of range", map[string]string{"SRUNNER_SHARD_COUNT": "4", "SRUNNER_SHARD_INDEX": "4"}, Shard{}, true},
+		{"invalid count", map[string]string{"SRUNNER_SHARD_COUNT": "hoge"}, Shard{}, true},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"SRUNNER_SHARD_COUNT", "SRUNNER_SHARD_INDEX", "JOB_COMPLETION_INDEX", "POD_NAME"} {
+				t.Setenv(k, tt.env[k])
+			}
+			got, err := ShardFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e, g := tt.want, got; e != g {
+				t.Errorf("want %s but got %s", e, g)
+			}
+		})
+	}
+}
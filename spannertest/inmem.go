@@ -0,0 +1,212 @@
+package spannertest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	inmem "cloud.google.com/go/spanner/spannertest"
+	"cloud.google.com/go/spanner/spansql"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// setupInMemory is in-memoryのfake Spanner Serverを起動して、statementsを適用したClientを返す
+// fakeはServerごとにdatabaseを1つしか持たないので、testごとにServerを起動する
+func setupInMemory(t testing.TB, statements []string) *spanner.Client {
+	t.Helper()
+
+	ctx := context.Background()
+
+	schema := &spansql.DDL{}
+	names := make(schemaNames)
+	for _, stmt := range statements {
+		v, err := spansql.ParseDDLStmt(stmt)
+		if err != nil {
+			t.Fatalf("failed parse ddl %q : %s", stmt, err)
+		}
+		if ct, ok := v.(*spansql.CreateTable); ok {
+			adaptColumnsForInMemory(t, string(ct.Name), ct.Columns)
+			names.add(ct)
+		}
+		schema.List = append(schema.List, v)
+	}
+
+	srv, err := inmem.NewServer("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	srv.SetLogger(t.Logf)
+	if err := srv.UpdateDDL(schema); err != nil {
+		t.Fatalf("failed update ddl : %s", err)
+	}
+
+	conn, err := grpc.NewClient(srv.Addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(names.unaryClientInterceptor),
+		grpc.WithChainStreamInterceptor(names.streamClientInterceptor),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	dbName := fmt.Sprintf("projects/%s/instances/%s/databases/%s", ProjectID, InstanceID, RandomDatabaseName())
+	sc, err := spanner.NewClient(ctx, dbName, option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sc.Close)
+	return sc
+}
+
+// adaptColumnsForInMemory is fakeが扱えないColumnを、fakeで扱える形に置き換える
+// 置き換えたColumnはTableごとにt.Logfで出力する
+//
+// JSONはSTRING(MAX)にする. 書き込みはできるが、spanner.NullJSONとして読むことはできない
+// Generated Columnはfakeが式を評価できないことが多いので、型のzero値を返すGenerated Columnにする. 式の結果は入らない
+// zero値がない型の場合は、NULLを許容する普通のColumnにする
+func adaptColumnsForInMemory(t testing.TB, table string, columns []spansql.ColumnDef) {
+	t.Helper()
+
+	var jsons, zeros, nullables []string
+	for i := range columns {
+		name := string(columns[i].Name)
+		if columns[i].Type.Base == spansql.JSON {
+			columns[i].Type.Base = spansql.String
+			columns[i].Type.Len = spansql.MaxLen
+			jsons = append(jsons, name)
+		}
+		if columns[i].Generated != nil {
+			columns[i].Generated = zeroValueExpr(columns[i].Type)
+			if columns[i].Generated != nil {
+				zeros = append(zeros, name)
+				continue
+			}
+			if columns[i].NotNull {
+				columns[i].NotNull = false
+				nullables = append(nullables, name)
+			}
+		}
+	}
+	if len(jsons) > 0 {
+		t.Logf("in-memory fake : %s JSON columns %s are STRING(MAX)", table, strings.Join(jsons, ", "))
+	}
+	if len(zeros) > 0 {
+		t.Logf("in-memory fake : %s generated columns %s are always zero value", table, strings.Join(zeros, ", "))
+	}
+	if len(nullables) > 0 {
+		t.Logf("in-memory fake : %s generated columns %s are not generated and NOT NULL is dropped", table, strings.Join(nullables, ", "))
+	}
+}
+
+// zeroValueExpr is typeのzero値のliteralを返す. zero値のliteralを作れない型の場合はnilを返す
+func zeroValueExpr(typ spansql.Type) spansql.Expr {
+	if typ.Array {
+		return nil
+	}
+	switch typ.Base {
+	case spansql.Int64:
+		return spansql.IntegerLiteral(0)
+	case spansql.Float64:
+		return spansql.FloatLiteral(0)
+	case spansql.String:
+		return spansql.StringLiteral("")
+	case spansql.Bool:
+		return spansql.False
+	}
+	return nil
+}
+
+// schemaNames is Table名とColumn名を、小文字からDDLに書かれている名前に変換する
+//
+// Spannerは名前の大文字と小文字を区別しないが、fakeは区別するので、
+// ReadとCommitのrequestに含まれる名前をDDLと同じ名前に置き換えてからfakeに送る. e.g. CircleId -> CircleID
+// SQLの中の名前は置き換えない
+type schemaNames map[string]*tableNames
+
+type tableNames struct {
+	name    string
+	columns map[string]string
+}
+
+func (n schemaNames) add(ct *spansql.CreateTable) {
+	t := &tableNames{name: string(ct.Name), columns: make(map[string]string)}
+	for _, c := range ct.Columns {
+		t.columns[strings.ToLower(string(c.Name))] = string(c.Name)
+	}
+	n[strings.ToLower(string(ct.Name))] = t
+}
+
+// canonical is tableとcolumnsをDDLと同じ名前にする. DDLにない名前はそのままにする
+func (n schemaNames) canonical(table *string, columns []string) {
+	t, ok := n[strings.ToLower(*table)]
+	if !ok {
+		return
+	}
+	*table = t.name
+	for i, c := range columns {
+		if v, ok := t.columns[strings.ToLower(c)]; ok {
+			columns[i] = v
+		}
+	}
+}
+
+func (n schemaNames) rewrite(req interface{}) {
+	switch v := req.(type) {
+	case *spannerpb.ReadRequest:
+		n.canonical(&v.Table, v.Columns)
+	case *spannerpb.CommitRequest:
+		for _, m := range v.Mutations {
+			var w *spannerpb.Mutation_Write
+			switch op := m.Operation.(type) {
+			case *spannerpb.Mutation_Insert:
+				w = op.Insert
+			case *spannerpb.Mutation_Update:
+				w = op.Update
+			case *spannerpb.Mutation_InsertOrUpdate:
+				w = op.InsertOrUpdate
+			case *spannerpb.Mutation_Replace:
+				w = op.Replace
+			case *spannerpb.Mutation_Delete_:
+				if t, ok := n[strings.ToLower(op.Delete.Table)]; ok {
+					op.Delete.Table = t.name
+				}
+			}
+			if w != nil {
+				n.canonical(&w.Table, w.Columns)
+			}
+		}
+	}
+}
+
+func (n schemaNames) unaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	n.rewrite(req)
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (n schemaNames) streamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &rewriteClientStream{ClientStream: s, names: n}, nil
+}
+
+// rewriteClientStream is StreamingReadのrequestの名前を置き換える
+type rewriteClientStream struct {
+	grpc.ClientStream
+	names schemaNames
+}
+
+func (s *rewriteClientStream) SendMsg(m interface{}) error {
+	s.names.rewrite(m)
+	return s.ClientStream.SendMsg(m)
+}
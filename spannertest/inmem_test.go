@@ -0,0 +1,69 @@
+package spannertest
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestSetup_InMemory(t *testing.T) {
+	t.Setenv("SPANNER_EMULATOR_HOST", "")
+
+	ctx := context.Background()
+
+	// ScoreにはGenerated Column, UserDepositHistoryにはJSONがある
+	// ScoreのCircleIDはScoreStoreと同じくCircleIdで書き込む
+	sc := Setup(t, "score", "balance")
+
+	_, err := sc.Apply(ctx, []*spanner.Mutation{
+		spanner.InsertMap("Score", map[string]interface{}{
+			"Id":         "u1",
+			"CircleId":   "c1",
+			"Score":      int64(100),
+			"MaxScore":   int64(100),
+			"CommitedAt": spanner.CommitTimestamp,
+		}),
+		spanner.InsertMap("UserDepositHistory", map[string]interface{}{
+			"UserID":                   "u1",
+			"DepositID":                "d1",
+			"DepositType":              int64(1),
+			"Amount":                   int64(100),
+			"Point":                    int64(0),
+			"SupplementaryInformation": spanner.NullJSON{Value: map[string]string{"name": "hoge"}, Valid: true},
+			"CreatedAt":                spanner.CommitTimestamp,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := sc.Single().ReadRow(ctx, "Score", spanner.Key{"u1"}, []string{"Score", "ClassRank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var score int64
+	var classRank spanner.NullInt64
+	if err := row.Columns(&score, &classRank); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := int64(100), score; e != g {
+		t.Errorf("want Score %d but got %d", e, g)
+	}
+	// ClassRankの式は評価されず、INT64のzero値になる
+	if !classRank.Valid || classRank.Int64 != 0 {
+		t.Errorf("want ClassRank 0 in memory but got %v", classRank)
+	}
+
+	row, err = sc.Single().ReadRow(ctx, "score", spanner.Key{"u1"}, []string{"CIRCLEID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var circleID string
+	if err := row.Columns(&circleID); err != nil {
+		t.Fatal(err)
+	}
+	if e, g := "c1", circleID; e != g {
+		t.Errorf("want CircleID %s but got %s", e, g)
+	}
+}
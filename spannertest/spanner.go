@@ -1,36 +1,174 @@
+// Package spannertest is Spanner Emulatorかin-memoryのfake Spannerを使ったtestのためのhelper
+//
+// gcloud emulators spanner start --host-port localhost:9050
+// export SPANNER_EMULATOR_HOST="localhost:9050"
 package spannertest
 
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
-	sadb "cloud.google.com/go/spanner/admin/database/apiv1"
-	sai "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
 	"github.com/google/uuid"
-	"google.golang.org/api/option"
-	sadbpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
-	saipb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
-	"google.golang.org/grpc"
+	"github.com/sinmetal/srunner/ddl"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	// ProjectID is Setupで使うEmulatorのProject
+	ProjectID = "fake"
+
+	// InstanceID is Setupで使うEmulatorのInstance
+	InstanceID = "fake"
+)
+
+var (
+	instanceOnce sync.Once
+	instanceErr  error
+)
+
+// Setup is ddlFilesを適用したdatabaseを作り、そのdatabaseのClientを返す
+// databaseはtestごとに作るので、他のtestのdataは見えない. Clientとdatabaseはt.Cleanupで削除する
+//
+// ddlFilesは "balance" のようにddl/のfile名から.sqlを除いたものか、.sqlのpathを指定する
+// $SPANNER_EMULATOR_HOST が指定されている場合はEmulatorにdatabaseを作る
+// 指定されていない場合はin-memoryのfake Spannerを使うので、Emulatorなしでtestを実行できる
+// fakeはTransactionのLockなど、一部の機能をサポートしていないので、それらが必要なtestはSkipIfNoEmulatorを呼ぶ
+func Setup(t testing.TB, ddlFiles ...string) *spanner.Client {
+	t.Helper()
+
+	statements := readStatements(t, ddlFiles...)
+	if !IsSpannerEmulatorHost() {
+		return setupInMemory(t, statements)
+	}
+	dbName := setupEmulatorDatabase(t, statements)
+	sc, err := spanner.NewClient(context.Background(), dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sc.Close)
+	return sc
+}
+
+// SetupDatabase is Emulatorにdatabaseを作り、database名を返す
+// 1つのdatabaseに複数のClientを作りたい場合に使う
+// in-memoryのfakeは使えないので、$SPANNER_EMULATOR_HOST が指定されていない場合はtestをSkipする
+func SetupDatabase(t testing.TB, ddlFiles ...string) string {
+	t.Helper()
+
+	SkipIfNoEmulator(t)
+	return setupEmulatorDatabase(t, readStatements(t, ddlFiles...))
+}
+
+// IsSpannerEmulatorHost is $SPANNER_EMULATOR_HOST が指定されているか
+func IsSpannerEmulatorHost() bool {
+	return os.Getenv("SPANNER_EMULATOR_HOST") != ""
+}
+
+func readStatements(t testing.TB, ddlFiles ...string) []string {
+	t.Helper()
+
+	var statements []string
+	for _, fn := range ddlFiles {
+		path, err := DDLFilePath(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := ddl.ReadFile(path, ddl.GoogleSQL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statements = append(statements, stmts...)
+	}
+	return statements
+}
+
+func setupEmulatorDatabase(t testing.TB, statements []string) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	instanceOnce.Do(func() {
+		instanceErr = NewInstance(ProjectID, InstanceID)
+	})
+	if instanceErr != nil {
+		t.Fatal(instanceErr)
+	}
+
+	admin, err := database.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbName, err := createDatabase(ctx, admin, ProjectID, InstanceID, RandomDatabaseName(), statements)
+	if err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		defer admin.Close()
+		if err := admin.DropDatabase(context.Background(), &databasepb.DropDatabaseRequest{Database: dbName}); err != nil {
+			t.Errorf("failed drop database %s : %s", dbName, err)
+		}
+	})
+	return dbName
+}
+
+// SkipIfNoEmulator is $SPANNER_EMULATOR_HOST が指定されていない場合はtestをSkipする
+func SkipIfNoEmulator(t testing.TB) {
+	t.Helper()
+
+	if !IsSpannerEmulatorHost() {
+		t.Skip("SPANNER_EMULATOR_HOST is required")
+	}
+}
+
+// DDLFilePath is "balance" のような名前をrepositoryのddl/balance.sqlのpathにする
+// .sqlで終わる場合はそのまま返す
+func DDLFilePath(name string) (string, error) {
+	if strings.HasSuffix(name, ".sql") {
+		return name, nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	// testはpackageのdirectoryで実行されるので、go.modがあるdirectoryまで遡る
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "ddl", name+".sql"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod is not found. ddl file %s", name)
+		}
+		dir = parent
+	}
+}
+
+// NewInstance is EmulatorにInstanceを作る. すでにある場合は何もしない
 func NewInstance(projectID string, instanceID string) error {
 	ctx := context.Background()
 
-	if len(os.Getenv("SPANNER_EMULATOR_HOST")) < 1 {
+	if !IsSpannerEmulatorHost() {
 		return fmt.Errorf("SPANNER_EMULATOR_HOST is required")
 	}
 
-	saiCli, err := sai.NewInstanceAdminClient(ctx)
+	saiCli, err := instance.NewInstanceAdminClient(ctx)
 	if err != nil {
 		return err
 	}
-	ope, err := saiCli.CreateInstance(ctx, &saipb.CreateInstanceRequest{
+	defer saiCli.Close()
+	ope, err := saiCli.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
 		Parent:     fmt.Sprintf("projects/%s", projectID),
 		InstanceId: instanceID,
 	})
@@ -52,32 +190,22 @@ func NewInstance(projectID string, instanceID string) error {
 	return nil
 }
 
-func NewDatabase(t *testing.T, projectID string, instanceID string, databaseName string, statements []string) string {
-	t.Helper()
-
-	ctx := context.Background()
-
-	IsSpannerEmulatorHost(t)
-
-	sadbCli, err := sadb.NewDatabaseAdminClient(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	ope, err := sadbCli.CreateDatabase(ctx, &sadbpb.CreateDatabaseRequest{
+func createDatabase(ctx context.Context, admin *database.DatabaseAdminClient, projectID string, instanceID string, databaseName string, statements []string) (string, error) {
+	ope, err := admin.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
 		Parent:          fmt.Sprintf("projects/%s/instances/%s", projectID, instanceID),
 		CreateStatement: fmt.Sprintf("CREATE DATABASE %s", databaseName),
 		ExtraStatements: statements,
 	})
 	if err != nil {
-		t.Fatal(err)
+		return "", fmt.Errorf("failed create database %s : %w", databaseName, err)
 	}
-	_, err = ope.Wait(ctx)
-	if err != nil {
-		t.Fatal(err)
+	if _, err := ope.Wait(ctx); err != nil {
+		return "", fmt.Errorf("failed create database %s : %w", databaseName, err)
 	}
-	return fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseName)
+	return fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, databaseName), nil
 }
 
+// RandomDatabaseName is Spannerのdatabase名として使えるrandomな名前を返す
 func RandomDatabaseName() string {
 	v := uuid.NewString()
 	v = strings.ReplaceAll(v, "-", "")
@@ -85,62 +213,13 @@ func RandomDatabaseName() string {
 	return "a" + strings.ToLower(v)
 }
 
-func updateDDL(t *testing.T, dbName string, statements []string) {
-	ctx := context.Background()
-
-	IsSpannerEmulatorHost(t)
-
-	var opts []option.ClientOption
-	if emulatorAddr := os.Getenv("SPANNER_EMULATOR_HOST"); emulatorAddr != "" {
-		emulatorOpts := []option.ClientOption{
-			option.WithEndpoint(emulatorAddr),
-			option.WithGRPCDialOption(grpc.WithInsecure()),
-			option.WithoutAuthentication(),
-		}
-		opts = append(opts, emulatorOpts...)
-	}
-
-	admin, err := sadb.NewDatabaseAdminClient(ctx, opts...)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = admin.UpdateDatabaseDdl(ctx, &sadbpb.UpdateDatabaseDdlRequest{
-		Database:   dbName,
-		Statements: statements,
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-}
-
+// ReadDDLFile is GoogleSQLのDDL fileをStatementに分割する
 func ReadDDLFile(t *testing.T, path string) []string {
 	t.Helper()
 
-	data, err := ioutil.ReadFile(path)
+	ret, err := ddl.ReadFile(path, ddl.GoogleSQL)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	l := strings.Split(string(data), ";")
-
-	var ret []string
-	for _, v := range l {
-		nv := strings.Replace(v, "\n", " ", -1)
-		nv = strings.TrimSpace(nv)
-		nv = strings.Trim(nv, ";")
-		if len(nv) < 10 {
-			continue
-		}
-		ret = append(ret, nv)
-	}
 	return ret
 }
-
-func IsSpannerEmulatorHost(t *testing.T) {
-	t.Helper()
-
-	if len(os.Getenv("SPANNER_EMULATOR_HOST")) < 1 {
-		t.Fatalf("SPANNER_EMULATOR_HOST is required")
-	}
-}
@@ -0,0 +1,333 @@
+package srunner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// RunnerStats is 1つのfuncNameに対するRunの計測結果を保持する
+type RunnerStats struct {
+	funcName  string
+	startedAt time.Time
+	histogram *Histogram
+
+	// startDelay is open-loopで開始予定時刻から実際にRunを開始するまでの遅れ
+	startDelay *Histogram
+
+	mu         sync.Mutex
+	errorCount int64
+	lateStarts int64
+
+	// keyBuckets is PickKeyで選んだkeyのbucketごとの結果
+	keyBuckets map[int]*keyBucketStats
+
+	// outcomes is RecordOutcomeで記録したoutcomeごとの数
+	outcomes map[string]int64
+}
+
+// keyBucketStats is 1つのkey bucketのRunの結果
+type keyBucketStats struct {
+	runs      int64
+	errors    int64
+	aborts    int64
+	abortWait time.Duration
+	histogram *Histogram
+}
+
+// NewRunnerStats is funcNameの計測を開始する
+func NewRunnerStats(funcName string) *RunnerStats {
+	return &RunnerStats{
+		funcName:   funcName,
+		startedAt:  time.Now(),
+		histogram:  NewHistogram(),
+		startDelay: NewHistogram(),
+		keyBuckets: make(map[int]*keyBucketStats),
+		outcomes:   make(map[string]int64),
+	}
+}
+
+// Record is Runnner.Run 1回分の結果を記録する
+// 失敗したRunのlatencyも記録する。OpenTelemetryのmetricsにも同じ値を記録する
+// ctxはRunに渡したctxを渡す. metricsのexemplarにctxのspanが使われる
+// metricsのsourceはfuncNameになる
+func (s *RunnerStats) Record(ctx context.Context, elapsed time.Duration, err error) {
+	s.recordRun(ctx, s.funcName, elapsed, err)
+}
+
+// recordRun is Recordと同じだが、metricsのsourceにAppRunnnerの名前を指定する
+func (s *RunnerStats) recordRun(ctx context.Context, source string, elapsed time.Duration, err error) {
+	s.histogram.Record(elapsed)
+	getRunnerMetrics().record(ctx, s.funcName, source, elapsed, err)
+	if err != nil {
+		s.mu.Lock()
+		s.errorCount++
+		s.mu.Unlock()
+	}
+}
+
+// recordKeys is Runで選んだkeyのbucketに、Runの結果とabortの数を記録する
+// Runの中でabortが記録されていなくても、Runがabortで失敗した場合は1回abortされたとして数える
+func (s *RunnerStats) recordKeys(o *keyObservation, elapsed time.Duration, err error) {
+	bucket, aborts, abortWait, ok := o.result()
+	if !ok {
+		return
+	}
+	if aborts == 0 && ErrorCode(err) == codes.Aborted {
+		aborts = 1
+		abortWait = elapsed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.keyBuckets[bucket]
+	if !ok {
+		b = &keyBucketStats{histogram: NewHistogram()}
+		s.keyBuckets[bucket] = b
+	}
+	b.runs++
+	if err != nil {
+		b.errors++
+	}
+	b.aborts += aborts
+	b.abortWait += abortWait
+	b.histogram.Record(elapsed)
+}
+
+// RecordOutcome is Runの成功・失敗とは別に、outcomeの数を1つ増やす
+func (s *RunnerStats) RecordOutcome(outcome string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[outcome]++
+}
+
+// lateStartThreshold is 開始予定時刻からこれ以上遅れて開始したRunをLateStartsとして数える
+const lateStartThreshold = time.Millisecond
+
+// RecordStartDelay is open-loopで開始予定時刻から実際に開始するまでの遅れを記録する
+func (s *RunnerStats) RecordStartDelay(delay time.Duration) {
+	s.startDelay.Record(delay)
+	if delay >= lateStartThreshold {
+		s.mu.Lock()
+		s.lateStarts++
+		s.mu.Unlock()
+	}
+}
+
+// Histogram is 計測中のHistogramを返す
+func (s *RunnerStats) Histogram() *Histogram {
+	return s.histogram
+}
+
+// Snapshot is その時点の計測結果を返す
+func (s *RunnerStats) Snapshot() *StatsSnapshot {
+	s.mu.Lock()
+	errorCount := s.errorCount
+	lateStarts := s.lateStarts
+	var keyBuckets []*KeyBucketSnapshot
+	for bucket, v := range s.keyBuckets {
+		keyBuckets = append(keyBuckets, &KeyBucketSnapshot{
+			bucket:    bucket,
+			Bucket:    keyBucketLabel(bucket),
+			Runs:      v.runs,
+			Errors:    v.errors,
+			Aborts:    v.aborts,
+			AbortWait: v.abortWait,
+			Mean:      v.histogram.Mean(),
+			P99:       v.histogram.Percentile(99),
+		})
+	}
+	var outcomes map[string]int64
+	if len(s.outcomes) > 0 {
+		outcomes = make(map[string]int64, len(s.outcomes))
+		for k, v := range s.outcomes {
+			outcomes[k] = v
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(keyBuckets, func(i, j int) bool {
+		return keyBuckets[i].bucket < keyBuckets[j].bucket
+	})
+
+	elapsed := time.Since(s.startedAt)
+	count := s.histogram.Count()
+	var throughput float64
+	if elapsed > 0 {
+		throughput = float64(count) / elapsed.Seconds()
+	}
+	return &StatsSnapshot{
+		FuncName:   s.funcName,
+		Count:      count,
+		ErrorCount: errorCount,
+		Elapsed:    elapsed,
+		Throughput: throughput,
+		Mean:       s.histogram.Mean(),
+		P50:        s.histogram.Percentile(50),
+		P90:        s.histogram.Percentile(90),
+		P99:        s.histogram.Percentile(99),
+		P999:       s.histogram.Percentile(99.9),
+		Max:        s.histogram.Max(),
+		LateStarts: lateStarts,
+		MaxDelay:   s.startDelay.Max(),
+		KeyBuckets: keyBuckets,
+		Outcomes:   outcomes,
+	}
+}
+
+// StatsSnapshot is RunnerStatsのある時点の値
+type StatsSnapshot struct {
+	FuncName   string        `json:"funcName"`
+	Count      int64         `json:"count"`
+	ErrorCount int64         `json:"errorCount"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Throughput float64       `json:"throughput"` // Run per second
+	Mean       time.Duration `json:"mean"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P99        time.Duration `json:"p99"`
+	P999       time.Duration `json:"p999"`
+	Max        time.Duration `json:"max"`
+
+	// LateStarts is open-loopで開始予定時刻から遅れて開始したRunの数
+	LateStarts int64 `json:"lateStarts"`
+
+	// MaxDelay is open-loopで開始予定時刻から実際に開始するまでの遅れの最大値
+	MaxDelay time.Duration `json:"maxDelay"`
+
+	// KeyBuckets is PickKeyで選んだkeyのhotさ(KeyDistribution.Rank)の桁ごとの結果
+	KeyBuckets []*KeyBucketSnapshot `json:"keyBuckets,omitempty"`
+
+	// Outcomes is RecordOutcomeで記録したoutcomeごとの数
+	Outcomes map[string]int64 `json:"outcomes,omitempty"`
+}
+
+// KeyBucketSnapshot is 1つのkey bucketのある時点の値
+type KeyBucketSnapshot struct {
+	bucket int
+
+	// Bucket is KeyDistribution.Rankの範囲 e.g. "10-99". "0" が一番hotなkey
+	Bucket string `json:"bucket"`
+
+	Runs   int64 `json:"runs"`
+	Errors int64 `json:"errors"`
+
+	// Aborts is abortされたtransactionの数. Spannerのclientの中でretryされたものも含む
+	Aborts int64 `json:"aborts"`
+
+	// AbortWait is abortされるまでに待った時間の合計. lockを待っていてabortされた時間になる
+	AbortWait time.Duration `json:"abortWait"`
+
+	Mean time.Duration `json:"mean"`
+	P99  time.Duration `json:"p99"`
+}
+
+// WriteStatsTable is StatsSnapshotを表形式でwに書き出す
+func WriteStatsTable(w io.Writer, snapshots []*StatsSnapshot) error {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FuncName < snapshots[j].FuncName
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if _, err := fmt.Fprintln(tw, "FuncName\tCount\tErrors\tRun/s\tMean\tP50\tP90\tP99\tP99.9\tMax\tLate\tMaxDelay\t"); err != nil {
+		return err
+	}
+	for _, v := range snapshots {
+		_, err := fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t\n",
+			v.FuncName, v.Count, v.ErrorCount, v.Throughput,
+			formatLatency(v.Mean), formatLatency(v.P50), formatLatency(v.P90),
+			formatLatency(v.P99), formatLatency(v.P999), formatLatency(v.Max),
+			v.LateStarts, formatLatency(v.MaxDelay))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteKeyBucketTable is StatsSnapshotのKeyBucketsを表形式でwに書き出す
+// hotなkeyのbucketにabortやlock待ちが集中しているかを確認するために使う
+func WriteKeyBucketTable(w io.Writer, snapshots []*StatsSnapshot) error {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FuncName < snapshots[j].FuncName
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if _, err := fmt.Fprintln(tw, "FuncName\tKeyRank\tRuns\tErrors\tAborts\tAbort%\tAbortWait\tMean\tP99\t"); err != nil {
+		return err
+	}
+	for _, v := range snapshots {
+		for _, b := range v.KeyBuckets {
+			var abortRate float64
+			if b.Runs > 0 {
+				abortRate = float64(b.Aborts) / float64(b.Runs) * 100
+			}
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.2f\t%s\t%s\t%s\t\n",
+				v.FuncName, b.Bucket, b.Runs, b.Errors, b.Aborts, abortRate,
+				formatLatency(b.AbortWait), formatLatency(b.Mean), formatLatency(b.P99))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteOutcomeTable is StatsSnapshotのOutcomesを表形式でwに書き出す
+func WriteOutcomeTable(w io.Writer, snapshots []*StatsSnapshot) error {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].FuncName < snapshots[j].FuncName
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	if _, err := fmt.Fprintln(tw, "FuncName\tOutcome\tCount\t"); err != nil {
+		return err
+	}
+	for _, v := range snapshots {
+		var outcomes []string
+		for k := range v.Outcomes {
+			outcomes = append(outcomes, k)
+		}
+		sort.Strings(outcomes)
+		for _, outcome := range outcomes {
+			if _, err := fmt.Fprintf(tw, "%s\t%s\t%d\t\n", v.FuncName, outcome, v.Outcomes[outcome]); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteReport is 負荷をかけ終わった後に、runnersのStatsSnapshotを WriteStatsTable, WriteKeyBucketTable, WriteOutcomeTable でwに書き出す
+func WriteReport(w io.Writer, runners []*AppRunnner) error {
+	var snapshots []*StatsSnapshot
+	for _, ar := range runners {
+		snapshots = append(snapshots, ar.Stats()...)
+	}
+	if err := WriteStatsTable(w, snapshots); err != nil {
+		return fmt.Errorf("failed WriteStatsTable : %w", err)
+	}
+	if err := WriteKeyBucketTable(w, snapshots); err != nil {
+		return fmt.Errorf("failed WriteKeyBucketTable : %w", err)
+	}
+	if err := WriteOutcomeTable(w, snapshots); err != nil {
+		return fmt.Errorf("failed WriteOutcomeTable : %w", err)
+	}
+	return nil
+}
+
+func formatLatency(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.Round(time.Microsecond).String()
+	}
+}
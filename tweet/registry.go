@@ -0,0 +1,22 @@
+package tweet
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sinmetal/srunner"
+)
+
+func init() {
+	// TWEETはInsertのMutationしか使わないので、Preflightで確認するStatementは登録しない
+	srunner.RegisterRunner(srunner.BackendSpanner, "TWEET", "Tweet.Insert", newInsertRunner)
+}
+
+func newInsertRunner(ctx context.Context, env *srunner.RunnerEnv, spec *srunner.RunnerSpec) (srunner.Runnner, error) {
+	if env.Spanner == nil {
+		return nil, fmt.Errorf("spanner client is required")
+	}
+	return &InsertRunner{
+		Store: NewStore(env.Spanner),
+	}, nil
+}
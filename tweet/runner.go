@@ -0,0 +1,39 @@
+package tweet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
+	"github.com/sinmetal/srunner/randdata"
+)
+
+// InsertRunner is Tweetを1件Insertする
+type InsertRunner struct {
+	Store Store
+}
+
+func (r *InsertRunner) Run(ctx context.Context) error {
+	id := srunner.NewUUID(ctx).String()
+	now := time.Now()
+	rnd := srunner.RandFromContext(ctx)
+	author := randdata.GetAuthor(rnd)
+	favos := randdata.GetAuthors(rnd)
+	_, err := r.Store.Insert(ctx, &Tweet{
+		TweetID:       id,
+		Author:        author,
+		Content:       fmt.Sprintf("Hello. My name is %s. %s (%s*%s*%s)", author, now, srunner.NewUUID(ctx).String(), srunner.NewUUID(ctx).String(), srunner.NewUUID(ctx).String()),
+		Favos:         favos,
+		Sort:          rnd.Int63(),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		CommitedAt:    spanner.CommitTimestamp,
+		SchemaVersion: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed TweetStore.Insert() id=%s : %w", id, err)
+	}
+	return nil
+}
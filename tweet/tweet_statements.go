@@ -0,0 +1,102 @@
+package tweet
+
+import (
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
+)
+
+const queryHeavySQL = "SELECT * FROM Tweet WHERE Content Like  '%Hoge%' LIMIT 100"
+
+const queryAllSQL = "SELECT * FROM Tweet"
+
+const queryRandomSQL = `
+SELECT *
+FROM (
+  SELECT *
+  FROM ItemOrder
+  WHERE UserID = "sinmetal"
+  ORDER BY CommitedAt DESC
+  Limit 10
+) IO
+JOIN (
+  SELECT *
+  FROM ItemMaster
+  WHERE Price > %v) IM ON IO.ItemID = IM.ItemID
+JOIN User U ON IO.UserID = U.UserID
+`
+
+const queryResultStructSQL = `
+SELECT ARRAY(SELECT STRUCT(Id, Author)) As IdWithAuthor
+FROM Tweet@{FORCE_INDEX=TweetShardCreatedAtAscCreatedAtDesc}
+WHERE ShardCreatedAt = @ShardCreatedAt
+`
+
+const queryOrderByCreatedAtDescSQL = `
+SELECT c.Id, c.Author, c.Content, c.Count, c.Favos, c.Sort, c.ShardCreatedAt, c.CreatedAt, c.UpdatedAt, c.CommitedAt, c.SchemaVersion
+FROM UNNEST(GENERATE_ARRAY(@StartShard, @EndShard)) AS OneShardCreatedAt,
+     UNNEST(ARRAY(
+      SELECT AS STRUCT *
+      FROM Tweet@{FORCE_INDEX=TweetShardCreatedAtAscCreatedAtDesc}
+      WHERE ShardCreatedAt = OneShardCreatedAt
+      ORDER BY CreatedAt DESC LIMIT @Limit
+    )) AS c
+ORDER BY c.CreatedAt DESC, Id
+LIMIT @Limit
+`
+
+const updateDMLSQL = `UPDATE Tweet SET Count += 1, UpdatedAt = @UpdatedAt, CommitedAt = PENDING_COMMIT_TIMESTAMP() WHERE Id = @Id`
+
+// queryRandomStatement is QueryRandomのStatement. priceはSQLに埋め込む
+func queryRandomStatement(price int64) spanner.Statement {
+	return spanner.NewStatement(fmt.Sprintf(queryRandomSQL, price))
+}
+
+// queryResultStructStatement is QueryResultStructのStatement
+func queryResultStructStatement(orderByAsc bool, shardCreatedAt int, limit int) spanner.Statement {
+	sql := queryResultStructSQL
+	if orderByAsc {
+		sql += " ORDER BY CreatedAt"
+	} else {
+		sql += " ORDER BY CreatedAt DESC"
+	}
+	sql += " LIMIT @Limit;"
+
+	st := spanner.NewStatement(sql)
+	st.Params["ShardCreatedAt"] = shardCreatedAt
+	st.Params["Limit"] = limit
+	return st
+}
+
+// queryOrderByCreatedAtDescStatement is QueryOrderByCreatedAtDescのStatement
+func queryOrderByCreatedAtDescStatement(startShard int, endShard int, id string, limit int) spanner.Statement {
+	st := spanner.NewStatement(queryOrderByCreatedAtDescSQL)
+	st.Params["StartShard"] = startShard
+	st.Params["EndShard"] = endShard
+	st.Params["Id"] = id
+	st.Params["Limit"] = limit
+	return st
+}
+
+// updateDMLStatement is UpdateDMLのStatement
+func updateDMLStatement(id string, updatedAt time.Time) spanner.Statement {
+	st := spanner.NewStatement(updateDMLSQL)
+	st.Params["UpdatedAt"] = updatedAt
+	st.Params["Id"] = id
+	return st
+}
+
+// Statements is TweetStoreが実行するSQLを、実行時と同じ型のParamsで返す
+// TWEET RunnerはInsertしか使わないので、RegisterStatementsには登録していない
+func (s *defaultTweetStore) Statements() []*srunner.Statement {
+	return []*srunner.Statement{
+		srunner.NewSpannerStatement("Tweet.QueryRandom", queryRandomStatement(0), false),
+		srunner.NewSpannerStatement("Tweet.QueryHeavy", spanner.NewStatement(queryHeavySQL), false),
+		srunner.NewSpannerStatement("Tweet.QueryAll", spanner.NewStatement(queryAllSQL), false),
+		srunner.NewSpannerStatement("Tweet.QueryResultStruct", queryResultStructStatement(false, 0, 1), false),
+		srunner.NewSpannerStatement("Tweet.QueryOrderByCreatedAtDesc", queryOrderByCreatedAtDescStatement(0, 1, "", 1), false),
+		srunner.NewSpannerStatement("Tweet.UpdateDML", updateDMLStatement("", time.Now()), true),
+	}
+}
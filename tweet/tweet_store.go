@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"hash/crc32"
-	"math/rand"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner"
 	"github.com/sinmetal/srunner/internal/trace"
 	"github.com/sinmetal/srunner/spanners"
 	"go.opentelemetry.io/otel/attribute"
@@ -29,6 +29,7 @@ type Store interface {
 	QueryResultStruct(ctx context.Context, orderByAsc bool, limit int, tb *spanner.TimestampBound) ([]*TweetIDAndAuthor, error)
 	QueryOrderByCreatedAtDesc(ctx context.Context, startShard int, endShard int, pageOption *PageOptionForQueryOrderByCreatedAtDesc, limit int) ([]*Tweet, error)
 	QueryRandom(ctx context.Context) error
+	Statements() []*srunner.Statement
 }
 
 var tweetStore Store
@@ -173,23 +174,7 @@ func (s *defaultTweetStore) QueryRandom(ctx context.Context) error {
 	ctx, span := trace.StartSpan(ctx, "tweetstore.QueryRandom")
 	defer span.End()
 
-	sql := fmt.Sprintf(`
-SELECT * 
-FROM (
-  SELECT * 
-  FROM ItemOrder 
-  WHERE UserID = "sinmetal" 
-  ORDER BY CommitedAt DESC 
-  Limit 10
-) IO 
-JOIN (
-  SELECT * 
-  FROM ItemMaster 
-  WHERE Price > %v) IM ON IO.ItemID = IM.ItemID
-JOIN User U ON IO.UserID = U.UserID
-`, rand.Int63())
-
-	iter := s.sc.Single().QueryWithOptions(ctx, spanner.NewStatement(fmt.Sprintf(sql)),
+	iter := s.sc.Single().QueryWithOptions(ctx, queryRandomStatement(srunner.RandFromContext(ctx).Int63()),
 		spanner.QueryOptions{
 			RequestTag: spanners.AppTag(),
 		})
@@ -212,7 +197,7 @@ func (s *defaultTweetStore) QueryHeavy(ctx context.Context) ([]*Tweet, error) {
 	ctx, span := trace.StartSpan(ctx, "tweetstore.QueryHeavy")
 	defer span.End()
 
-	iter := s.sc.Single().QueryWithOptions(ctx, spanner.NewStatement("SELECT * FROM Tweet WHERE Content Like  '%Hoge%' LIMIT 100"),
+	iter := s.sc.Single().QueryWithOptions(ctx, spanner.NewStatement(queryHeavySQL),
 		spanner.QueryOptions{
 			RequestTag: spanners.AppTag(),
 		})
@@ -246,7 +231,7 @@ func (s *defaultTweetStore) QueryAll(ctx context.Context) (int, error) {
 	defer span.End()
 
 	iter := s.sc.Single().WithTimestampBound(spanner.ReadTimestamp(time.Now())).
-		QueryWithOptions(ctx, spanner.NewStatement("SELECT * FROM Tweet"),
+		QueryWithOptions(ctx, spanner.NewStatement(queryAllSQL),
 			spanner.QueryOptions{
 				RequestTag: spanners.AppTag(),
 			})
@@ -283,22 +268,7 @@ func (s *defaultTweetStore) QueryResultStruct(ctx context.Context, orderByAsc bo
 	ctx, span := trace.StartSpan(ctx, "tweetstore.QueryResultStruct")
 	defer span.End()
 
-	sql := `
-SELECT ARRAY(SELECT STRUCT(Id, Author)) As IdWithAuthor 
-FROM Tweet@{FORCE_INDEX=TweetShardCreatedAtAscCreatedAtDesc} 
-WHERE ShardCreatedAt = @ShardCreatedAt
-`
-	if orderByAsc {
-		sql += " ORDER BY CreatedAt"
-	} else {
-		sql += " ORDER BY CreatedAt DESC"
-	}
-	sql += " LIMIT @Limit;"
-
-	shardCreatedAt := rand.Intn(10)
-	st := spanner.NewStatement(sql)
-	st.Params["ShardCreatedAt"] = shardCreatedAt
-	st.Params["Limit"] = limit
+	st := queryResultStructStatement(orderByAsc, srunner.RandFromContext(ctx).Intn(10), limit)
 	roTx := s.sc.Single()
 	if timestampBound != nil {
 		roTx = roTx.WithTimestampBound(*timestampBound)
@@ -343,24 +313,7 @@ func (s *defaultTweetStore) QueryOrderByCreatedAtDesc(ctx context.Context, start
 	ctx, span := trace.StartSpan(ctx, "tweetstore.QueryOrderByCreatedAtDesc")
 	defer span.End()
 
-	sql := `
-SELECT c.Id, c.Author, c.Content, c.Count, c.Favos, c.Sort, c.ShardCreatedAt, c.CreatedAt, c.UpdatedAt, c.CommitedAt, c.SchemaVersion 
-FROM UNNEST(GENERATE_ARRAY(@StartShard, @EndShard)) AS OneShardCreatedAt,
-     UNNEST(ARRAY(
-      SELECT AS STRUCT *
-      FROM Tweet@{FORCE_INDEX=TweetShardCreatedAtAscCreatedAtDesc} 
-      WHERE ShardCreatedAt = OneShardCreatedAt
-      ORDER BY CreatedAt DESC LIMIT @Limit
-    )) AS c
-ORDER BY c.CreatedAt DESC, Id
-LIMIT @Limit
-`
-
-	st := spanner.NewStatement(sql)
-	st.Params["StartShard"] = startShard
-	st.Params["EndShard"] = endShard
-	st.Params["Id"] = pageOption.ID
-	st.Params["Limit"] = limit
+	st := queryOrderByCreatedAtDescStatement(startShard, endShard, pageOption.ID, limit)
 	iter := s.sc.Single().QueryWithOptions(ctx, st,
 		spanner.QueryOptions{
 			RequestTag: spanners.AppTag(),
@@ -433,13 +386,7 @@ func (s *defaultTweetStore) UpdateDML(ctx context.Context, id string) (time.Time
 	defer span.End()
 
 	resp, err := s.sc.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
-		stmt := spanner.Statement{
-			SQL: `UPDATE Tweet SET Count += 1, UpdatedAt = @UpdatedAt, CommitedAt = PENDING_COMMIT_TIMESTAMP() WHERE Id = @Id`,
-		}
-		stmt.Params = map[string]interface{}{
-			"@UpdatedAt": time.Now(),
-			"@Id":        id,
-		}
+		stmt := updateDMLStatement(id, time.Now())
 		_, err := txn.Update(ctx, stmt)
 		if err != nil {
 			return err
@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"github.com/sinmetal/srunner/internal/trace"
+	"github.com/sinmetal/srunner/schemacheck"
+	"github.com/sinmetal/srunner/spannertest"
 	"google.golang.org/api/iterator"
 )
 
@@ -83,26 +86,24 @@ func TestTweet_ToInsertOrUpdateMap(t *testing.T) {
 
 }
 
-func TestDefaultTweetStore_Insert(t *testing.T) {
-	ctx := context.Background()
+// TestTweetSchema is Tweet structとTweets Tableを比べる
+// storeのSQLには ddl/tweet.sql とずれているものがあるので go run ./cmd/schemacheck -packages tweet で確認する
+func TestTweetSchema(t *testing.T) {
+	s := schemacheck.Load(t, "tweet")
 
-	NewTestInstance(t)
+	schemacheck.Verify(t, schemacheck.CheckStruct(s, "Tweets", Tweet{}))
+}
 
-	dbName := RandString(8)
+func TestDefaultTweetStore_Insert(t *testing.T) {
+	ctx := context.Background()
 
-	statements := readDDLFile(t, "../ddl/tweet.sql")
-	NewDatabase(t, dbName, statements)
-
-	sc, err := spanner.NewClient(ctx, fmt.Sprintf("projects/fake/instances/fake/databases/%s", dbName))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer sc.Close()
+	trace.Init(ctx, "unit-test", "v0.0.0")
 
+	sc := spannertest.Setup(t, "tweet")
 	ts := NewStore(sc)
 
 	now := time.Now()
-	_, err = ts.Insert(ctx, &Tweet{
+	_, err := ts.Insert(ctx, &Tweet{
 		TweetID:    "test",
 		Author:     "sinmetal",
 		Content:    "hello world",
@@ -122,23 +123,13 @@ func TestDefaultTweetStore_QueryOrderByCreatedAtDesc(t *testing.T) {
 
 	ctx := context.Background()
 
-	NewTestInstance(t)
-
-	dbName := RandString(8)
-
-	statements := readDDLFile(t, "../ddl/tweet.sql")
-	NewDatabase(t, dbName, statements)
-
-	sc, err := spanner.NewClient(ctx, fmt.Sprintf("projects/fake/instances/fake/databases/%s", dbName))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer sc.Close()
+	trace.Init(ctx, "unit-test", "v0.0.0")
 
+	sc := spannertest.Setup(t, "tweet")
 	ts := NewStore(sc)
 	for i := 0; i < 100; i++ {
 		now := time.Now()
-		_, err = ts.Insert(ctx, &Tweet{
+		_, err := ts.Insert(ctx, &Tweet{
 			TweetID:    fmt.Sprintf("%d", i),
 			Author:     "sinmetal",
 			Content:    "hello world",